@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
 	"os"
@@ -8,45 +9,181 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/segolab/relay-ref/server/go/pkg/admission"
 	"github.com/segolab/relay-ref/server/go/pkg/api"
+	"github.com/segolab/relay-ref/server/go/pkg/audit"
+	"github.com/segolab/relay-ref/server/go/pkg/auth"
+	"github.com/segolab/relay-ref/server/go/pkg/delivery"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+	"github.com/segolab/relay-ref/server/go/pkg/openapi"
 	"github.com/segolab/relay-ref/server/go/pkg/ratelimit"
 	"github.com/segolab/relay-ref/server/go/pkg/store"
 )
 
 func main() {
-	cfg := api.LoadConfigFromEnv()
+	cfg, cfgErr := api.LoadConfigFromEnv()
 
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
 		Level: cfg.LogLevel,
 	}))
+	if cfgErr != nil {
+		logger.Error("invalid configuration", "err", cfgErr)
+		os.Exit(1)
+	}
 
 	relayStore := store.NewInMemoryRelayStore()
 	idem := store.NewInMemoryIdempotencyStore(cfg.IdempotencyTTL)
+	apiKeys := store.NewInMemoryAPIKeyStore()
+	subscriptions := store.NewInMemorySubscriptionStore()
+	routingRules := store.NewInMemoryRuleStore()
+	queues := delivery.NewQueues(cfg.QueueMaxDepth)
+	queues.MaxReceives = cfg.QueueMaxReceives
 
 	limiter := ratelimit.NewTokenBucketLimiter(ratelimit.Config{
-		PostRPS:   cfg.LimitPostRPS,
-		PostBurst: cfg.LimitPostBurst,
-		GetRPS:    cfg.LimitGetRPS,
-		GetBurst:  cfg.LimitGetBurst,
+		PostRPS:      cfg.LimitPostRPS,
+		PostBurst:    cfg.LimitPostBurst,
+		GetRPS:       cfg.LimitGetRPS,
+		GetBurst:     cfg.LimitGetBurst,
+		ReceiveRPS:   cfg.LimitReceiveRPS,
+		ReceiveBurst: cfg.LimitReceiveBurst,
 	})
 
+	var shadowLimiter ratelimit.Limiter
+	if cfg.ShadowPostRPS > 0 || cfg.ShadowGetRPS > 0 {
+		shadowLimiter = ratelimit.NewTokenBucketLimiter(ratelimit.Config{
+			PostRPS:   cfg.ShadowPostRPS,
+			PostBurst: cfg.ShadowPostBurst,
+			GetRPS:    cfg.ShadowGetRPS,
+			GetBurst:  cfg.ShadowGetBurst,
+		})
+	}
+
+	var admissionCtl *admission.Controller
+	if cfg.AdmissionMaxInFlight > 0 {
+		admissionCtl = admission.NewController(admission.Config{
+			MaxInFlight:     cfg.AdmissionMaxInFlight,
+			MinLimit:        cfg.AdmissionMinLimit,
+			Adaptive:        cfg.AdmissionAdaptive,
+			TargetLatency:   cfg.AdmissionTargetLatency,
+			PriorityReserve: cfg.AdmissionPriorityReserve,
+		})
+	}
+
+	var verifier *auth.Verifier
+	if cfg.JWTJWKS != "" {
+		verifier = &auth.Verifier{
+			Keys:     auth.NewJWKS(cfg.JWTJWKS, cfg.JWTJWKSRefresh, nil),
+			Issuer:   cfg.JWTIssuer,
+			Audience: cfg.JWTAudience,
+			Leeway:   30 * time.Second,
+		}
+	}
+
+	var auditSinks []audit.Sink
+	if cfg.AuditFile != "" {
+		fileSink, err := audit.OpenFileSink(cfg.AuditFile)
+		if err != nil {
+			logger.Error("open audit file failed", "err", err)
+			os.Exit(1)
+		}
+		defer fileSink.Close()
+		auditSinks = append(auditSinks, fileSink)
+	}
+	if cfg.AuditStdout {
+		auditSinks = append(auditSinks, audit.NewWriterSink(os.Stdout))
+	}
+	auditLog := audit.NewLog(logger, cfg.AuditBuffer, auditSinks...)
+	defer auditLog.Close()
+
+	var contract *openapi.Spec
+	if cfg.ValidateRequests {
+		var err error
+		if cfg.OpenAPISpec != "" {
+			contract, err = openapi.Load(cfg.OpenAPISpec)
+		} else {
+			contract, err = openapi.Embedded()
+		}
+		if err != nil {
+			logger.Error("load openapi spec failed", "path", cfg.OpenAPISpec, "err", err)
+			os.Exit(1)
+		}
+	}
+
 	app := api.NewApp(api.Dependencies{
-		Logger:      logger,
-		Config:      cfg,
-		RelayStore:  relayStore,
-		Idempotency: idem,
-		Limiter:     limiter,
+		Logger:        logger,
+		Config:        cfg,
+		RelayStore:    relayStore,
+		Idempotency:   idem,
+		Limiter:       limiter,
+		APIKeys:       apiKeys,
+		Subscriptions: subscriptions,
+		Rules:         routingRules,
+		Queues:        queues,
+		TokenVerifier: verifier,
+		Audit:         auditLog,
+		ShadowLimiter: shadowLimiter,
+		Admission:     admissionCtl,
+		Contract:      contract,
 	})
 
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	scheduler := &delivery.Scheduler{Log: logger, Store: relayStore, Interval: cfg.SchedulerInterval}
+	go scheduler.Run(ctx)
+	if cfg.DeliveryEnabled {
+		dispatcher := &delivery.Dispatcher{
+			Log:   logger,
+			Store: relayStore,
+			Sender: delivery.Drivers{
+				model.DestinationWebhook: delivery.WebhookSender{Client: &http.Client{}},
+				model.DestinationFile:    delivery.NewFileSink(cfg.FileSinkDir),
+				model.DestinationQueue:   queues,
+			},
+			Interval:    cfg.DeliveryInterval,
+			Concurrency: cfg.DeliveryConcurrency,
+			Timeout:     cfg.DeliveryTimeout,
+			MaxAttempts: cfg.DeliveryMaxAttempts,
+			BackoffBase: cfg.DeliveryBackoffBase,
+			BackoffMax:  cfg.DeliveryBackoffMax,
+
+			OrderingPolicy:          cfg.OrderingPolicy,
+			OrderingDeadLetterQueue: cfg.OrderingDeadLetterQueue,
+
+			CallbackMaxAttempts: cfg.CallbackMaxAttempts,
+			CallbackBackoffBase: cfg.CallbackBackoffBase,
+			CallbackBackoffMax:  cfg.CallbackBackoffMax,
+		}
+		if cfg.CallbackSecret != "" {
+			dispatcher.Callbacks = &delivery.CallbackSender{Client: &http.Client{}, Secret: cfg.CallbackSecret}
+		}
+		go dispatcher.Run(ctx)
+	}
+
 	srv := &http.Server{
 		Addr:              cfg.HTTPAddr,
 		Handler:           app.Router,
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 
+	if cfg.TLSCertFile != "" || (cfg.TLSClientAuth != "" && cfg.TLSClientAuth != api.ClientAuthNone) {
+		tlsCfg, err := api.NewTLSConfig(cfg)
+		if err != nil {
+			logger.Error("tls config failed", "err", err)
+			os.Exit(1)
+		}
+		srv.TLSConfig = tlsCfg
+	}
+
 	go func() {
-		logger.Info("server started", "addr", cfg.HTTPAddr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Info("server started", "addr", cfg.HTTPAddr, "tls", srv.TLSConfig != nil, "client_auth", cfg.TLSClientAuth)
+		var err error
+		if srv.TLSConfig != nil {
+			// Certificates are already loaded into TLSConfig.
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logger.Error("listen failed", "err", err)
 			os.Exit(1)
 		}
@@ -58,5 +195,6 @@ func main() {
 	<-sigCh
 
 	logger.Info("shutting down")
+	stop()
 	_ = srv.Close()
 }
@@ -5,4 +5,8 @@ go 1.22
 require (
 	github.com/go-chi/chi/v5 v5.1.0
 	github.com/google/uuid v1.6.0
+	golang.org/x/net v0.33.0
+	gopkg.in/yaml.v3 v3.0.1
 )
+
+require golang.org/x/text v0.21.0 // indirect
@@ -0,0 +1,116 @@
+package admission
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/segolab/relay-ref/server/go/pkg/metrics"
+)
+
+// Config configures a server-wide concurrency limit.
+//
+// With Adaptive disabled the limit is fixed at MaxInFlight. With Adaptive
+// enabled the limit follows an AIMD policy: it grows by roughly one slot per
+// window of requests completing under TargetLatency and is multiplied by
+// Backoff when a request exceeds it, staying within [MinLimit, MaxInFlight].
+type Config struct {
+	MaxInFlight   int
+	MinLimit      int
+	Adaptive      bool
+	TargetLatency time.Duration
+	Backoff       float64
+	// PriorityReserve is the fraction of the limit only priority requests
+	// may use, so they keep being admitted while normal traffic is shed.
+	PriorityReserve float64
+}
+
+type Controller struct {
+	cfg Config
+
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+}
+
+func NewController(cfg Config) *Controller {
+	if cfg.MinLimit < 1 {
+		cfg.MinLimit = 1
+	}
+	if cfg.MaxInFlight < cfg.MinLimit {
+		cfg.MaxInFlight = cfg.MinLimit
+	}
+	if cfg.Backoff <= 0 || cfg.Backoff >= 1 {
+		cfg.Backoff = 0.9
+	}
+	if cfg.PriorityReserve < 0 || cfg.PriorityReserve >= 1 {
+		cfg.PriorityReserve = 0
+	}
+	c := &Controller{cfg: cfg, limit: float64(cfg.MaxInFlight)}
+	metrics.AdmissionLimit.Set(int64(cfg.MaxInFlight))
+	metrics.AdmissionInFlight.Set(0)
+	return c
+}
+
+// Acquire admits a request if capacity is available. On success the caller
+// must invoke release with the observed request latency.
+func (c *Controller) Acquire(priority bool) (release func(latency time.Duration), ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	capacity := c.limit
+	if !priority {
+		capacity = math.Floor(c.limit * (1 - c.cfg.PriorityReserve))
+		if capacity < 1 {
+			capacity = 1
+		}
+	}
+	if float64(c.inflight) >= capacity {
+		if priority {
+			metrics.AdmissionShed.Add("priority", 1)
+		} else {
+			metrics.AdmissionShed.Add("normal", 1)
+		}
+		return nil, false
+	}
+
+	c.inflight++
+	metrics.AdmissionInFlight.Set(int64(c.inflight))
+
+	var once sync.Once
+	return func(latency time.Duration) {
+		once.Do(func() { c.release(latency) })
+	}, true
+}
+
+func (c *Controller) release(latency time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.inflight--
+	metrics.AdmissionInFlight.Set(int64(c.inflight))
+
+	if !c.cfg.Adaptive || c.cfg.TargetLatency <= 0 {
+		return
+	}
+	if latency > c.cfg.TargetLatency {
+		c.limit = math.Max(float64(c.cfg.MinLimit), c.limit*c.cfg.Backoff)
+	} else {
+		c.limit = math.Min(float64(c.cfg.MaxInFlight), c.limit+1/c.limit)
+	}
+	metrics.AdmissionLimit.Set(int64(c.limit))
+}
+
+// Limit returns the current concurrency limit.
+func (c *Controller) Limit() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return int(c.limit)
+}
+
+// InFlight returns the number of admitted requests still being served.
+func (c *Controller) InFlight() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.inflight
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segolab/relay-ref/server/go/pkg/audit"
+	"github.com/segolab/relay-ref/server/go/pkg/middleware"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+	"github.com/segolab/relay-ref/server/go/pkg/ratelimit"
+)
+
+// AdminHandlers serve operator-only endpoints under /v1/admin.
+type AdminHandlers struct {
+	log     *slog.Logger
+	cfg     Config
+	limiter ratelimit.Inspector
+	audit   *audit.Log
+}
+
+func NewAdminHandlers(log *slog.Logger, cfg Config, limiter ratelimit.Inspector, auditLog *audit.Log) *AdminHandlers {
+	return &AdminHandlers{log: log, cfg: cfg, limiter: limiter, audit: auditLog}
+}
+
+// ListAuditEvents returns recent audit events, newest first, filtered by
+// type, tenant and since (RFC 3339).
+func (h *AdminHandlers) ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := audit.Filter{Type: q.Get("type"), Tenant: q.Get("tenant")}
+	if v := q.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			WriteError(w, r, http.StatusBadRequest, "invalid_request", "since must be an RFC 3339 timestamp", nil)
+			return
+		}
+		f.Since = t
+	}
+	limit := 100
+	if v := q.Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 1 && n <= 1000 {
+			limit = n
+		}
+	}
+
+	resp := model.ListAuditEventsResponse{Items: []model.AuditEvent{}}
+	for _, e := range h.audit.Recent(f, limit) {
+		resp.Items = append(resp.Items, model.AuditEvent{
+			Time:      e.Time,
+			Type:      e.Type,
+			Tenant:    e.Tenant,
+			Actor:     e.Actor,
+			RequestID: e.RequestID,
+			SourceIP:  e.SourceIP,
+			Details:   e.Details,
+		})
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// GetRateLimits reports the buckets of one API key ID, optionally narrowed to
+// a single route group.
+func (h *AdminHandlers) GetRateLimits(w http.ResponseWriter, r *http.Request) {
+	keyID := strings.TrimSpace(r.URL.Query().Get("keyId"))
+	if keyID == "" {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "keyId is required", nil)
+		return
+	}
+	groups := ratelimit.RouteGroups
+	if g := r.URL.Query().Get("routeGroup"); g != "" {
+		if !slices.Contains(ratelimit.RouteGroups, g) {
+			WriteError(w, r, http.StatusBadRequest, "invalid_request", "unknown routeGroup", nil)
+			return
+		}
+		groups = []string{g}
+	}
+
+	now := time.Now().UTC()
+	resp := model.RateLimitStatusResponse{Buckets: []model.RateLimitBucket{}}
+	for _, g := range groups {
+		st, ok := h.limiter.Inspect(keyID, g, now)
+		if !ok {
+			continue
+		}
+		resp.Buckets = append(resp.Buckets, toBucket(st))
+	}
+
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (h *AdminHandlers) ResetRateLimit(w http.ResponseWriter, r *http.Request) {
+	var req model.ResetRateLimitRequest
+	if !decodeAdminRequest(w, r, &req) {
+		return
+	}
+	if req.KeyID == "" || !slices.Contains(ratelimit.RouteGroups, req.RouteGroup) {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "keyId and a known routeGroup are required", nil)
+		return
+	}
+
+	existed := h.limiter.Reset(req.KeyID, req.RouteGroup)
+	h.log.Info("rate limit bucket reset", "key_id", req.KeyID, "route_group", req.RouteGroup, "existed", existed)
+	middleware.RecordAudit(r, audit.TypeRateLimitReset, map[string]any{"keyId": req.KeyID, "routeGroup": req.RouteGroup})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandlers) BoostRateLimit(w http.ResponseWriter, r *http.Request) {
+	var req model.BoostRateLimitRequest
+	if !decodeAdminRequest(w, r, &req) {
+		return
+	}
+	if req.KeyID == "" || !slices.Contains(ratelimit.RouteGroups, req.RouteGroup) {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "keyId and a known routeGroup are required", nil)
+		return
+	}
+	if req.Tokens < 1 || req.TTLSeconds < 1 || req.TTLSeconds > 86400 {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "tokens must be >= 1 and ttlSeconds within 1..86400", nil)
+		return
+	}
+
+	st := h.limiter.Boost(req.KeyID, req.RouteGroup, req.Tokens, time.Duration(req.TTLSeconds)*time.Second, time.Now().UTC())
+	h.log.Info("rate limit bucket boosted", "key_id", req.KeyID, "route_group", req.RouteGroup, "tokens", req.Tokens, "ttl_seconds", req.TTLSeconds)
+	middleware.RecordAudit(r, audit.TypeRateLimitBoost, map[string]any{
+		"keyId": req.KeyID, "routeGroup": req.RouteGroup, "tokens": req.Tokens, "ttlSeconds": req.TTLSeconds,
+	})
+	_ = json.NewEncoder(w).Encode(toBucket(st))
+}
+
+func decodeAdminRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "invalid JSON", map[string]any{"err": err.Error()})
+		return false
+	}
+	return true
+}
+
+func toBucket(st ratelimit.BucketState) model.RateLimitBucket {
+	b := model.RateLimitBucket{
+		RouteGroup:    st.RouteGroup,
+		Policy:        model.RateLimitPolicy{RPS: st.RPS, Burst: st.Burst},
+		Tokens:        st.Tokens,
+		RecentDenials: st.RecentDenials,
+	}
+	if b.RecentDenials == nil {
+		b.RecentDenials = []time.Time{}
+	}
+	if st.BoostUntil != nil {
+		b.Boost = &model.RateLimitBoost{Tokens: st.BoostTokens, Until: *st.BoostUntil}
+	}
+	return b
+}
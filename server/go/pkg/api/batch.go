@@ -0,0 +1,223 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/segolab/relay-ref/server/go/pkg/audit"
+	"github.com/segolab/relay-ref/server/go/pkg/middleware"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+	"github.com/segolab/relay-ref/server/go/pkg/store"
+)
+
+// CreateRelayBatch enqueues several relays in one request. Each item is
+// validated and made idempotent on its own; the response reports a result
+// per item in request order.
+func (h *Handlers) CreateRelayBatch(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		WriteError(w, r, http.StatusUnauthorized, "unauthorized", "missing API key", nil)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.cfg.BatchMaxBodyBytes)
+	var req model.BatchCreateRelaysRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "invalid JSON", map[string]any{"err": err.Error()})
+		return
+	}
+	if len(req.Items) == 0 || len(req.Items) > h.cfg.BatchMaxItems {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "items must contain between 1 and the maximum batch size",
+			map[string]any{"maxItems": h.cfg.BatchMaxItems})
+		return
+	}
+
+	results := make([]model.BatchCreateRelayResult, len(req.Items))
+	seenKeys := map[string]int{}
+	failed := false
+	for i, item := range req.Items {
+		results[i] = model.BatchCreateRelayResult{Index: i}
+		var e *requestError
+		if int64(len(item.Payload)) > h.cfg.MaxBodyBytes {
+			// Items are held to the limit of POST /v1/relays.
+			e = &requestError{status: http.StatusBadRequest, code: "invalid_request", message: "payload exceeds the maximum relay size",
+				details: map[string]any{"maxBytes": h.cfg.MaxBodyBytes}}
+		} else {
+			e = h.checkCreate(principal, item.CreateRelayRequest)
+		}
+		key := strings.TrimSpace(item.IdempotencyKey)
+		if e == nil && len(key) > 128 {
+			e = &requestError{status: http.StatusBadRequest, code: "invalid_request", message: "idempotencyKey must be <= 128 characters"}
+		}
+		if e == nil && key != "" {
+			if j, dup := seenKeys[key]; dup {
+				e = &requestError{status: http.StatusBadRequest, code: "invalid_request", message: "duplicate idempotencyKey in batch",
+					details: map[string]any{"firstIndex": j}}
+			}
+			seenKeys[key] = i
+		}
+		if e != nil {
+			failed = true
+			results[i].Status = model.BatchItemError
+			results[i].Error = itemError(r, e)
+		}
+	}
+
+	if req.AllOrNothing {
+		if !failed {
+			failed = !h.enqueueAll(r, principal, req.Items, results)
+		}
+		if failed {
+			for i := range results {
+				if results[i].Status == "" {
+					results[i].Status = model.BatchItemSkipped
+				}
+			}
+			WriteError(w, r, http.StatusBadRequest, "batch_rejected", "one or more items are invalid; nothing was created",
+				map[string]any{"items": results})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(model.BatchCreateRelaysResponse{Items: results})
+		return
+	}
+
+	for i, item := range req.Items {
+		if results[i].Status == model.BatchItemError {
+			continue
+		}
+		key := strings.TrimSpace(item.IdempotencyKey)
+		relay, replayed, err := h.enqueue(principal, item.CreateRelayRequest, key, requestHash(item.CreateRelayRequest))
+		switch {
+		case store.IsIdempotencyConflict(err):
+			results[i].Status = model.BatchItemError
+			results[i].Error = itemError(r, idempotencyConflict(r, key))
+		case routeError(err) != nil:
+			results[i].Status = model.BatchItemError
+			results[i].Error = itemError(r, routeError(err))
+		case err != nil:
+			results[i].Status = model.BatchItemError
+			results[i].Error = itemError(r, &requestError{status: http.StatusInternalServerError, code: "internal", message: "failed to create relay"})
+		case replayed:
+			results[i].Status = model.BatchItemReplayed
+			results[i].Relay = relay
+		default:
+			results[i].Status = model.BatchItemCreated
+			results[i].Relay = relay
+		}
+	}
+
+	_ = json.NewEncoder(w).Encode(model.BatchCreateRelaysResponse{Items: results})
+}
+
+// enqueueAll creates the relays of an all-or-nothing batch whose items are
+// valid. Every relay is built before any is stored, and the idempotency keys
+// are claimed together, so either all items succeed or nothing is created.
+// It reports false after recording the failing items in results.
+func (h *Handlers) enqueueAll(r *http.Request, principal middleware.Principal, items []model.BatchCreateRelayItem, results []model.BatchCreateRelayResult) bool {
+	relays := make([]*model.Relay, len(items))
+	stored := make([]bool, len(items))
+	var keyed []int
+	var keys, hashes []string
+	ok := true
+	for i, item := range items {
+		relay, err := h.build(principal, item.CreateRelayRequest)
+		if err != nil {
+			results[i].Status = model.BatchItemError
+			results[i].Error = itemError(r, routeError(err))
+			ok = false
+			continue
+		}
+		relays[i] = relay
+		if key := strings.TrimSpace(item.IdempotencyKey); key != "" {
+			keyed = append(keyed, i)
+			keys = append(keys, key)
+			hashes = append(hashes, requestHash(item.CreateRelayRequest))
+		}
+	}
+	if !ok {
+		return false
+	}
+
+	refs, err := h.idem.GetOrCreateAll(principal.Tenant, keys, hashes, func(missing []int) ([]*model.Relay, error) {
+		out := make([]*model.Relay, len(missing))
+		for j, k := range missing {
+			h.store.Create(relays[keyed[k]])
+			stored[keyed[k]] = true
+			out[j] = &model.Relay{ID: relays[keyed[k]].ID}
+		}
+		return out, nil
+	})
+	var conflict *store.IdempotencyConflict
+	if errors.As(err, &conflict) {
+		i := keyed[conflict.Index]
+		results[i].Status = model.BatchItemError
+		results[i].Error = itemError(r, idempotencyConflict(r, keys[conflict.Index]))
+		return false
+	}
+	if err != nil {
+		for i := range results {
+			results[i].Status = model.BatchItemError
+			results[i].Error = itemError(r, &requestError{status: http.StatusInternalServerError, code: "internal", message: "failed to create relay"})
+		}
+		return false
+	}
+
+	for k, i := range keyed {
+		if !stored[i] {
+			// Recorded by an earlier request: return the stored relay.
+			relays[i], _ = h.store.Get(refs[k].ID)
+			results[i].Status = model.BatchItemReplayed
+		}
+	}
+	for i, relay := range relays {
+		if results[i].Status == "" {
+			if !stored[i] {
+				h.store.Create(relay)
+			}
+			results[i].Status = model.BatchItemCreated
+		}
+		results[i].Relay = relay
+	}
+	return true
+}
+
+func idempotencyConflict(r *http.Request, key string) *requestError {
+	middleware.RecordAudit(r, audit.TypeIdempotencyConflict, map[string]any{"idempotencyKey": key})
+	return &requestError{status: http.StatusConflict, code: "idempotency_conflict", message: "idempotency key reuse with different payload"}
+}
+
+func itemError(r *http.Request, e *requestError) *model.ErrorResponse {
+	return &model.ErrorResponse{
+		Code:      e.code,
+		Message:   e.message,
+		Details:   e.details,
+		RequestID: middleware.RequestIDFromContext(r.Context()),
+	}
+}
+
+// batchCost charges one rate-limit token per batch item. The body is read
+// here, bounded by maxBytes, and restored for the handler.
+func batchCost(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+			if err != nil {
+				WriteError(w, r, http.StatusBadRequest, "invalid_request", "failed to read request body", map[string]any{"err": err.Error()})
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(raw))
+
+			var shape struct {
+				Items []json.RawMessage `json:"items"`
+			}
+			if json.Unmarshal(raw, &shape) == nil && len(shape.Items) > 1 {
+				r = middleware.WithRateLimitCost(r, len(shape.Items))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
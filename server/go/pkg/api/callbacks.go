@@ -0,0 +1,24 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/segolab/relay-ref/server/go/pkg/delivery"
+	"github.com/segolab/relay-ref/server/go/pkg/middleware"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+)
+
+// GetCallbackSecret returns the secret the caller's tenant verifies status
+// callbacks with.
+func (h *Handlers) GetCallbackSecret(w http.ResponseWriter, r *http.Request) {
+	if h.cfg.CallbackSecret == "" {
+		WriteError(w, r, http.StatusNotFound, "not_found", "status callbacks are not enabled on this server", nil)
+		return
+	}
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	_ = json.NewEncoder(w).Encode(model.CallbackSecretResponse{
+		Tenant: principal.Tenant,
+		Secret: delivery.TenantSecret(h.cfg.CallbackSecret, principal.Tenant),
+	})
+}
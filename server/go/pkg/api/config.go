@@ -1,25 +1,136 @@
 package api
 
 import (
+	"fmt"
 	"log/slog"
 	"os"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/segolab/relay-ref/server/go/pkg/delivery"
+	"github.com/segolab/relay-ref/server/go/pkg/middleware"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
 )
 
-func LoadConfigFromEnv() Config {
-	return Config{
-		HTTPAddr:       getenv("RELAY_HTTP_ADDR", ":8429"),
-		APIKeys:        parseAPIKeys(getenv("RELAY_API_KEYS", "dev-key")),
-		MaxBodyBytes:   int64(getenvInt("RELAY_MAX_BODY_BYTES", 32768)),
-		IdempotencyTTL: time.Duration(getenvInt("RELAY_IDEMPOTENCY_TTL_SECONDS", 3600)) * time.Second,
-		LimitPostRPS:   getenvFloat("RELAY_LIMIT_POST_RPS", 10),
-		LimitPostBurst: getenvInt("RELAY_LIMIT_POST_BURST", 20),
-		LimitGetRPS:    getenvFloat("RELAY_LIMIT_GET_RPS", 50),
-		LimitGetBurst:  getenvInt("RELAY_LIMIT_GET_BURST", 100),
-		LogLevel:       slog.LevelInfo,
+// LoadConfigFromEnv reads the configuration from RELAY_* environment
+// variables and rejects values the server cannot run with.
+func LoadConfigFromEnv() (Config, error) {
+	apiKeys := parseAPIKeys(getenv("RELAY_API_KEYS", "dev-key"))
+	adminKeys := parseAPIKeys(getenv("RELAY_ADMIN_KEYS", ""))
+	for k := range adminKeys {
+		apiKeys[k] = struct{}{}
+	}
+
+	cfg := Config{
+		HTTPAddr:                 getenv("RELAY_HTTP_ADDR", ":8429"),
+		APIKeys:                  apiKeys,
+		AdminKeys:                adminKeys,
+		DefaultTenant:            getenv("RELAY_DEFAULT_TENANT", "default"),
+		JWTJWKS:                  getenv("RELAY_JWT_JWKS", ""),
+		JWTJWKSRefresh:           time.Duration(getenvInt("RELAY_JWT_JWKS_REFRESH_SECONDS", 300)) * time.Second,
+		JWTIssuer:                getenv("RELAY_JWT_ISSUER", ""),
+		JWTAudience:              getenv("RELAY_JWT_AUDIENCE", ""),
+		JWTTenantClaim:           getenv("RELAY_JWT_TENANT_CLAIM", "tenant"),
+		TLSCertFile:              getenv("RELAY_TLS_CERT_FILE", ""),
+		TLSKeyFile:               getenv("RELAY_TLS_KEY_FILE", ""),
+		TLSClientCAFile:          getenv("RELAY_TLS_CLIENT_CA_FILE", ""),
+		TLSClientAuth:            getenv("RELAY_TLS_CLIENT_AUTH", ClientAuthNone),
+		TLSClientTenants:         parseMapping(getenv("RELAY_TLS_CLIENT_TENANTS", "")),
+		TLSClientScopes:          parseList(getenv("RELAY_TLS_CLIENT_SCOPES", "relays:read,relays:write")),
+		MaxBodyBytes:             int64(getenvInt("RELAY_MAX_BODY_BYTES", 32768)),
+		BatchMaxItems:            getenvInt("RELAY_BATCH_MAX_ITEMS", 20),
+		BatchMaxBodyBytes:        int64(getenvInt("RELAY_BATCH_MAX_BODY_BYTES", 1048576)),
+		ReplayMaxItems:           getenvInt("RELAY_REPLAY_MAX_ITEMS", 1000),
+		SchedulerInterval:        time.Duration(getenvInt("RELAY_SCHEDULER_INTERVAL_MS", 1000)) * time.Millisecond,
+		DeliveryEnabled:          getenvBool("RELAY_DELIVERY_ENABLED", false),
+		DeliveryInterval:         time.Duration(getenvInt("RELAY_DELIVERY_INTERVAL_MS", 500)) * time.Millisecond,
+		DeliveryConcurrency:      getenvInt("RELAY_DELIVERY_CONCURRENCY", 8),
+		DeliveryTimeout:          time.Duration(getenvInt("RELAY_DELIVERY_TIMEOUT_SECONDS", 10)) * time.Second,
+		DeliveryMaxAttempts:      getenvInt("RELAY_DELIVERY_MAX_ATTEMPTS", 5),
+		DeliveryBackoffBase:      time.Duration(getenvInt("RELAY_DELIVERY_BACKOFF_BASE_MS", 1000)) * time.Millisecond,
+		DeliveryBackoffMax:       time.Duration(getenvInt("RELAY_DELIVERY_BACKOFF_MAX_SECONDS", 300)) * time.Second,
+		OrderingPolicy:           model.OrderingPolicy(strings.ToLower(strings.TrimSpace(getenv("RELAY_ORDERING_FAILURE_POLICY", "skip")))),
+		OrderingDeadLetterQueue:  getenv("RELAY_ORDERING_DEAD_LETTER_QUEUE", "ordering-dead-letters"),
+		CallbackSecret:           getenv("RELAY_CALLBACK_SECRET", ""),
+		CallbackMaxAttempts:      getenvInt("RELAY_CALLBACK_MAX_ATTEMPTS", 8),
+		CallbackBackoffBase:      time.Duration(getenvInt("RELAY_CALLBACK_BACKOFF_BASE_MS", 5000)) * time.Millisecond,
+		CallbackBackoffMax:       time.Duration(getenvInt("RELAY_CALLBACK_BACKOFF_MAX_SECONDS", 3600)) * time.Second,
+		FileSinkDir:              getenv("RELAY_FILE_SINK_DIR", "data/sink"),
+		QueueMaxDepth:            getenvInt("RELAY_QUEUE_MAX_DEPTH", 10000),
+		QueueMaxReceives:         getenvInt("RELAY_QUEUE_MAX_RECEIVES", 10),
+		QueueVisibilityTimeout:   time.Duration(getenvInt("RELAY_QUEUE_VISIBILITY_TIMEOUT_SECONDS", 30)) * time.Second,
+		QueueMaxWait:             time.Duration(getenvInt("RELAY_QUEUE_MAX_WAIT_SECONDS", 20)) * time.Second,
+		StrictEventTypeTenants:   parseAPIKeys(getenv("RELAY_STRICT_EVENT_TYPE_TENANTS", "")),
+		WatchHeartbeat:           time.Duration(getenvInt("RELAY_WATCH_HEARTBEAT_SECONDS", 15)) * time.Second,
+		WatchMaxStreams:          getenvInt("RELAY_WATCH_MAX_STREAMS", 10),
+		IdempotencyTTL:           time.Duration(getenvInt("RELAY_IDEMPOTENCY_TTL_SECONDS", 3600)) * time.Second,
+		LimitPostRPS:             getenvFloat("RELAY_LIMIT_POST_RPS", 10),
+		LimitPostBurst:           getenvInt("RELAY_LIMIT_POST_BURST", 20),
+		LimitGetRPS:              getenvFloat("RELAY_LIMIT_GET_RPS", 50),
+		LimitGetBurst:            getenvInt("RELAY_LIMIT_GET_BURST", 100),
+		LimitReceiveRPS:          getenvFloat("RELAY_LIMIT_RECEIVE_RPS", 20),
+		LimitReceiveBurst:        getenvInt("RELAY_LIMIT_RECEIVE_BURST", 40),
+		LimitPostMode:            parseLimitMode(getenv("RELAY_LIMIT_POST_MODE", "enforce")),
+		LimitGetMode:             parseLimitMode(getenv("RELAY_LIMIT_GET_MODE", "enforce")),
+		ShadowPostRPS:            getenvFloat("RELAY_SHADOW_LIMIT_POST_RPS", 0),
+		ShadowPostBurst:          getenvInt("RELAY_SHADOW_LIMIT_POST_BURST", 0),
+		ShadowGetRPS:             getenvFloat("RELAY_SHADOW_LIMIT_GET_RPS", 0),
+		ShadowGetBurst:           getenvInt("RELAY_SHADOW_LIMIT_GET_BURST", 0),
+		AdmissionMaxInFlight:     getenvInt("RELAY_ADMISSION_MAX_INFLIGHT", 0),
+		AdmissionMinLimit:        getenvInt("RELAY_ADMISSION_MIN_LIMIT", 1),
+		AdmissionAdaptive:        getenvBool("RELAY_ADMISSION_ADAPTIVE", false),
+		AdmissionTargetLatency:   time.Duration(getenvInt("RELAY_ADMISSION_TARGET_LATENCY_MS", 250)) * time.Millisecond,
+		AdmissionPriorityReserve: getenvFloat("RELAY_ADMISSION_PRIORITY_RESERVE", 0.1),
+		AdmissionPriorityKeys:    parseAPIKeys(getenv("RELAY_ADMISSION_PRIORITY_KEYS", "")),
+		AdmissionRetryAfter:      getenvInt("RELAY_ADMISSION_RETRY_AFTER_SECONDS", 1),
+		AuditFile:                getenv("RELAY_AUDIT_FILE", ""),
+		AuditStdout:              getenvBool("RELAY_AUDIT_STDOUT", false),
+		AuditBuffer:              getenvInt("RELAY_AUDIT_BUFFER", 1000),
+		ErrorFormat:              middleware.ErrorFormat(strings.ToLower(strings.TrimSpace(getenv("RELAY_ERROR_FORMAT", string(middleware.ErrorFormatJSON))))),
+		OpenAPISpec:              getenv("RELAY_OPENAPI_SPEC", ""),
+		ValidateRequests:         getenvBool("RELAY_OPENAPI_VALIDATE_REQUESTS", true),
+		ValidateResponses:        getenvBool("RELAY_OPENAPI_VALIDATE_RESPONSES", false),
+		LogLevel:                 slog.LevelInfo,
 	}
+	return cfg, cfg.validate()
+}
+
+func (c Config) validate() error {
+	// Both drive tickers, which panic on a non-positive interval.
+	if c.SchedulerInterval <= 0 {
+		return fmt.Errorf("RELAY_SCHEDULER_INTERVAL_MS must be positive")
+	}
+	if c.DeliveryInterval <= 0 {
+		return fmt.Errorf("RELAY_DELIVERY_INTERVAL_MS must be positive")
+	}
+	// No workers would never deliver, and a zero timeout fails every attempt.
+	if c.DeliveryConcurrency <= 0 {
+		return fmt.Errorf("RELAY_DELIVERY_CONCURRENCY must be positive")
+	}
+	if c.DeliveryTimeout <= 0 {
+		return fmt.Errorf("RELAY_DELIVERY_TIMEOUT_SECONDS must be positive")
+	}
+	// Each batch item costs a token, so a larger batch could never pass.
+	if c.LimitPostMode == LimitModeEnforce && c.BatchMaxItems > c.LimitPostBurst {
+		return fmt.Errorf("RELAY_BATCH_MAX_ITEMS (%d) must not exceed RELAY_LIMIT_POST_BURST (%d)", c.BatchMaxItems, c.LimitPostBurst)
+	}
+	switch c.OrderingPolicy {
+	case model.OrderingSkip, model.OrderingBlock:
+	default:
+		return fmt.Errorf("RELAY_ORDERING_FAILURE_POLICY must be skip or block, got %q", c.OrderingPolicy)
+	}
+	switch c.ErrorFormat {
+	case middleware.ErrorFormatJSON, middleware.ErrorFormatProblem:
+	default:
+		return fmt.Errorf("RELAY_ERROR_FORMAT must be json or problem, got %q", c.ErrorFormat)
+	}
+	if c.OrderingDeadLetterQueue != "" {
+		if err := delivery.ValidateDestination(model.Destination{Type: model.DestinationQueue, URL: "queue:" + c.OrderingDeadLetterQueue}); err != nil {
+			return fmt.Errorf("RELAY_ORDERING_DEAD_LETTER_QUEUE: %w", err)
+		}
+	}
+	return nil
 }
 
 func getenv(k, def string) string {
@@ -53,6 +164,18 @@ func getenvFloat(k string, def float64) float64 {
 	return f
 }
 
+func getenvBool(k string, def bool) bool {
+	v := strings.TrimSpace(os.Getenv(k))
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return def
+	}
+	return b
+}
+
 func parseAPIKeys(csv string) map[string]struct{} {
 	out := map[string]struct{}{}
 	for _, part := range strings.Split(csv, ",") {
@@ -63,3 +186,34 @@ func parseAPIKeys(csv string) map[string]struct{} {
 	}
 	return out
 }
+
+func parseLimitMode(v string) LimitMode {
+	if strings.EqualFold(strings.TrimSpace(v), string(LimitModeShadow)) {
+		return LimitModeShadow
+	}
+	return LimitModeEnforce
+}
+
+func parseList(csv string) []string {
+	var out []string
+	for _, part := range strings.Split(csv, ",") {
+		if v := strings.TrimSpace(part); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// parseMapping parses "a=b,c=d" pairs. The last "=" separates the value, so
+// keys such as URIs may contain "=".
+func parseMapping(csv string) map[string]string {
+	out := map[string]string{}
+	for _, part := range parseList(csv) {
+		i := strings.LastIndex(part, "=")
+		if i <= 0 {
+			continue
+		}
+		out[strings.TrimSpace(part[:i])] = strings.TrimSpace(part[i+1:])
+	}
+	return out
+}
@@ -0,0 +1,240 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/segolab/relay-ref/server/go/pkg/middleware"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+	"github.com/segolab/relay-ref/server/go/pkg/schema"
+	"github.com/segolab/relay-ref/server/go/pkg/store"
+)
+
+// eventTypeName is the form of registrable event type names; it keeps them
+// usable as a path segment.
+var eventTypeName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:-]{0,127}$`)
+
+// EventTypeHandlers manage the event-type registry under /v1/event-types.
+// Event types are scoped to the caller's tenant.
+type EventTypeHandlers struct {
+	log     *slog.Logger
+	cfg     Config
+	types   store.EventTypeStore
+	schemas *schemaCache
+}
+
+// NewEventTypeHandlers shares schemas with the relay handlers that enforce
+// them, so deleted event types are dropped from it.
+func NewEventTypeHandlers(log *slog.Logger, cfg Config, ts store.EventTypeStore, schemas *schemaCache) *EventTypeHandlers {
+	return &EventTypeHandlers{log: log, cfg: cfg, types: ts, schemas: schemas}
+}
+
+func (h *EventTypeHandlers) ListEventTypes(w http.ResponseWriter, r *http.Request) {
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	_ = json.NewEncoder(w).Encode(model.ListEventTypesResponse{Items: h.types.List(principal.Tenant)})
+}
+
+func (h *EventTypeHandlers) CreateEventType(w http.ResponseWriter, r *http.Request) {
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.cfg.MaxBodyBytes)
+	var req model.CreateEventTypeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "invalid JSON", map[string]any{"err": err.Error()})
+		return
+	}
+	if !eventTypeName.MatchString(req.Name) {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request",
+			"name must be 1-128 letters, digits, '.', '_', ':' or '-', starting with a letter or digit", nil)
+		return
+	}
+	if !allowsEventType(w, r, principal, req.Name) || !validEventTypeBody(w, r, req.Description, req.Schema) {
+		return
+	}
+
+	et, err := h.types.Create(&model.EventType{
+		Name:        req.Name,
+		Description: req.Description,
+		Schema:      req.Schema,
+		CreatedAt:   time.Now().UTC(),
+		Tenant:      principal.Tenant,
+	})
+	if errors.Is(err, store.ErrEventTypeExists) {
+		WriteError(w, r, http.StatusConflict, "conflict", "event type already exists", map[string]any{"name": req.Name})
+		return
+	}
+	h.log.Info("event type created", "event_type", et.Name, "tenant", et.Tenant)
+
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(et)
+}
+
+// UpdateEventType replaces the description and schema, adding a version.
+func (h *EventTypeHandlers) UpdateEventType(w http.ResponseWriter, r *http.Request) {
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	name := chi.URLParam(r, "name")
+	if !allowsEventType(w, r, principal, name) {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.cfg.MaxBodyBytes)
+	var req model.UpdateEventTypeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "invalid JSON", map[string]any{"err": err.Error()})
+		return
+	}
+	if !validEventTypeBody(w, r, req.Description, req.Schema) {
+		return
+	}
+	et, err := h.types.Update(principal.Tenant, name, req.Description, req.Schema, time.Now().UTC())
+	if err != nil {
+		WriteError(w, r, http.StatusNotFound, "not_found", "event type not found", nil)
+		return
+	}
+	h.log.Info("event type updated", "event_type", et.Name, "tenant", et.Tenant, "version", et.Version)
+	_ = json.NewEncoder(w).Encode(et)
+}
+
+func (h *EventTypeHandlers) GetEventType(w http.ResponseWriter, r *http.Request) {
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	et, ok := h.types.Get(principal.Tenant, chi.URLParam(r, "name"))
+	if !ok {
+		WriteError(w, r, http.StatusNotFound, "not_found", "event type not found", nil)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(et)
+}
+
+func (h *EventTypeHandlers) ListEventTypeVersions(w http.ResponseWriter, r *http.Request) {
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	versions, err := h.types.Versions(principal.Tenant, chi.URLParam(r, "name"))
+	if err != nil {
+		WriteError(w, r, http.StatusNotFound, "not_found", "event type not found", nil)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(model.ListEventTypeVersionsResponse{Items: versions})
+}
+
+func (h *EventTypeHandlers) DeleteEventType(w http.ResponseWriter, r *http.Request) {
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	name := chi.URLParam(r, "name")
+	if !allowsEventType(w, r, principal, name) {
+		return
+	}
+	if err := h.types.Delete(principal.Tenant, name); err != nil {
+		WriteError(w, r, http.StatusNotFound, "not_found", "event type not found", nil)
+		return
+	}
+	h.schemas.forget(principal.Tenant, name)
+	h.log.Info("event type deleted", "event_type", name, "tenant", principal.Tenant)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// allowsEventType rejects changes to event types the caller may not
+// publish, so a key restricted to some event types cannot relax the schemas
+// of others.
+func allowsEventType(w http.ResponseWriter, r *http.Request, principal middleware.Principal, name string) bool {
+	if !principal.AllowsEventType(name) {
+		WriteError(w, r, http.StatusForbidden, "forbidden", "eventType not permitted for this key", map[string]any{"eventType": name})
+		return false
+	}
+	return true
+}
+
+func validEventTypeBody(w http.ResponseWriter, r *http.Request, description string, raw json.RawMessage) bool {
+	if len(description) > 1024 {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "description must be <= 1024 characters", nil)
+		return false
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		return true
+	}
+	if len(raw) > schema.MaxSchemaBytes {
+		WriteError(w, r, http.StatusBadRequest, "invalid_schema", "schema is too large", map[string]any{"maxBytes": schema.MaxSchemaBytes})
+		return false
+	}
+	if _, err := schema.Compile(raw); err != nil {
+		WriteError(w, r, http.StatusBadRequest, "invalid_schema", "schema is not a supported JSON Schema", map[string]any{"err": err.Error()})
+		return false
+	}
+	return true
+}
+
+// schemaCache holds the compiled schema of each event type with a hash of
+// its source, so a schema is compiled once and recompiled when it changes.
+type schemaCache struct {
+	mu      sync.Mutex
+	schemas map[schemaKey]cachedSchema
+}
+
+type schemaKey struct{ tenant, name string }
+
+type cachedSchema struct {
+	sum    [sha256.Size]byte
+	schema *schema.Schema
+}
+
+func newSchemaCache() *schemaCache {
+	return &schemaCache{schemas: map[schemaKey]cachedSchema{}}
+}
+
+func (c *schemaCache) get(et *model.EventType) (*schema.Schema, error) {
+	k := schemaKey{et.Tenant, et.Name}
+	sum := sha256.Sum256(et.Schema)
+	c.mu.Lock()
+	cached, ok := c.schemas[k]
+	c.mu.Unlock()
+	if ok && cached.sum == sum {
+		return cached.schema, nil
+	}
+	s, err := schema.Compile(et.Schema)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.schemas[k] = cachedSchema{sum: sum, schema: s}
+	c.mu.Unlock()
+	return s, nil
+}
+
+// forget drops a deleted event type's schema.
+func (c *schemaCache) forget(tenant, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.schemas, schemaKey{tenant, name})
+}
+
+// checkEventType validates a payload against its registered event type.
+// Unregistered types pass unless the tenant is strict.
+func (h *Handlers) checkEventType(tenant string, req model.CreateRelayRequest) *requestError {
+	et, ok := h.types.Get(tenant, req.EventType)
+	if !ok {
+		if _, strict := h.cfg.StrictEventTypeTenants[tenant]; strict {
+			return &requestError{status: http.StatusUnprocessableEntity, code: "unknown_event_type", message: "eventType is not registered",
+				details: map[string]any{"eventType": req.EventType}}
+		}
+		return nil
+	}
+	if len(et.Schema) == 0 || string(et.Schema) == "null" {
+		return nil
+	}
+	s, err := h.schemas.get(et)
+	if err != nil {
+		// Schemas are compiled when registered, so this is a server fault.
+		h.log.Error("compile event type schema failed", "event_type", et.Name, "tenant", tenant, "err", err)
+		return &requestError{status: http.StatusInternalServerError, code: "internal", message: "event type schema is unusable"}
+	}
+	if errs := s.Validate(req.Payload); len(errs) > 0 {
+		return &requestError{status: http.StatusUnprocessableEntity, code: "invalid_payload", message: "payload does not match the event type schema",
+			details: map[string]any{"eventType": et.Name, "version": et.Version, "errors": errs}}
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"io"
 	"log/slog"
 	"net/http"
@@ -14,9 +15,13 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 
+	"github.com/segolab/relay-ref/server/go/pkg/audit"
+	"github.com/segolab/relay-ref/server/go/pkg/delivery"
 	"github.com/segolab/relay-ref/server/go/pkg/middleware"
 	"github.com/segolab/relay-ref/server/go/pkg/model"
+	"github.com/segolab/relay-ref/server/go/pkg/rules"
 	"github.com/segolab/relay-ref/server/go/pkg/store"
+	"github.com/segolab/relay-ref/server/go/pkg/transform"
 )
 
 type Handlers struct {
@@ -24,15 +29,22 @@ type Handlers struct {
 	cfg   Config
 	store store.RelayStore
 	idem  store.IdempotencyStore
+	subs  store.SubscriptionStore
+	rules store.RuleStore
+	types store.EventTypeStore
+	// schemas caches compiled event type schemas for checkEventType.
+	schemas *schemaCache
+	// watchers counts open watch streams per credential.
+	watchers streamCounter
 }
 
-func NewHandlers(log *slog.Logger, cfg Config, s store.RelayStore, idem store.IdempotencyStore) *Handlers {
-	return &Handlers{log: log, cfg: cfg, store: s, idem: idem}
+func NewHandlers(log *slog.Logger, cfg Config, s store.RelayStore, idem store.IdempotencyStore, subs store.SubscriptionStore, rs store.RuleStore, ts store.EventTypeStore) *Handlers {
+	return &Handlers{log: log, cfg: cfg, store: s, idem: idem, subs: subs, rules: rs, types: ts, schemas: newSchemaCache()}
 }
 
 func (h *Handlers) CreateRelay(w http.ResponseWriter, r *http.Request) {
-	apiKey := middleware.APIKeyFromContext(r.Context())
-	if apiKey == "" {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
 		WriteError(w, r, http.StatusUnauthorized, "unauthorized", "missing API key", nil)
 		return
 	}
@@ -50,95 +62,347 @@ func (h *Handlers) CreateRelay(w http.ResponseWriter, r *http.Request) {
 		WriteError(w, r, http.StatusBadRequest, "invalid_request", "invalid JSON", map[string]any{"err": err.Error()})
 		return
 	}
-	if err := validateCreate(req); err != nil {
-		WriteError(w, r, http.StatusBadRequest, "invalid_request", err.Error(), nil)
+	if e := h.checkCreate(principal, req); e != nil {
+		WriteError(w, r, e.status, e.code, e.message, e.details)
 		return
 	}
-	if !isJSONObject(req.Payload) {
-		WriteError(w, r, http.StatusBadRequest, "invalid_request", "payload must be a JSON object", nil)
+
+	idemKey := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+
+	sum := sha256.Sum256(raw)
+	relay, _, err := h.enqueue(principal, req, idemKey, hex.EncodeToString(sum[:]))
+	if err != nil {
+		if store.IsIdempotencyConflict(err) {
+			middleware.RecordAudit(r, audit.TypeIdempotencyConflict, map[string]any{"idempotencyKey": idemKey})
+			WriteError(w, r, http.StatusConflict, "idempotency_conflict", "idempotency key reuse with different payload", nil)
+			return
+		}
+		if e := routeError(err); e != nil {
+			WriteError(w, r, e.status, e.code, e.message, e.details)
+			return
+		}
+		WriteError(w, r, http.StatusInternalServerError, "internal", "failed to create relay", map[string]any{"err": err.Error()})
 		return
 	}
 
-	payloadHash := sha256.Sum256(raw)
-	hashHex := hex.EncodeToString(payloadHash[:])
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(relay)
+}
 
-	idemKey := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+// requestError describes why a create request was refused.
+type requestError struct {
+	status  int
+	code    string
+	message string
+	details map[string]any
+}
+
+// checkCreate validates a decoded create request and the caller's
+// permissions for it.
+func (h *Handlers) checkCreate(principal middleware.Principal, req model.CreateRelayRequest) *requestError {
+	if err := validateCreate(req); err != nil {
+		return &requestError{status: http.StatusBadRequest, code: "invalid_request", message: err.Error()}
+	}
+	if !isJSONObject(req.Payload) {
+		return &requestError{status: http.StatusBadRequest, code: "invalid_request", message: "payload must be a JSON object"}
+	}
+	if !principal.AllowsEventType(req.EventType) {
+		return &requestError{status: http.StatusForbidden, code: "forbidden", message: "eventType not permitted for this key",
+			details: map[string]any{"eventType": req.EventType}}
+	}
+	if e := h.checkEventType(principal.Tenant, req); e != nil {
+		return e
+	}
+	for _, d := range destinations(req) {
+		if !principal.AllowsDestination(d.URL) {
+			return &requestError{status: http.StatusForbidden, code: "forbidden", message: "destination host not permitted for this key",
+				details: map[string]any{"url": d.URL}}
+		}
+	}
+	if req.CallbackURL != "" {
+		if h.cfg.CallbackSecret == "" {
+			return &requestError{status: http.StatusBadRequest, code: "invalid_request", message: "status callbacks are not enabled on this server"}
+		}
+		if !principal.AllowsDestination(req.CallbackURL) {
+			return &requestError{status: http.StatusForbidden, code: "forbidden", message: "callback host not permitted for this key",
+				details: map[string]any{"url": req.CallbackURL}}
+		}
+	}
+	return nil
+}
 
+// build makes the relay for a validated request, applying routing rules
+// and subscriptions, without storing it.
+func (h *Handlers) build(principal middleware.Principal, req model.CreateRelayRequest) (*model.Relay, error) {
+	relay := newRelay(principal.Tenant, req, time.Now().UTC())
+	if err := h.resolve(relay); err != nil {
+		return nil, err
+	}
+	return relay, nil
+}
+
+// resolve applies the tenant's rules to a new relay: a matching drop rule
+// drops it, and one without destinations is routed to the matching
+// subscriptions and route rules.
+func (h *Handlers) resolve(relay *model.Relay) error {
+	drop, routes := h.matchRules(relay)
+	switch {
+	case drop != nil:
+		reason := "dropped by rule " + drop.Name
+		relay.Status = model.RelayStatusDropped
+		relay.FailureReason = &reason
+		relay.Deliveries = nil
+	case len(relay.Deliveries) == 0:
+		return h.route(relay, routes)
+	}
+	return nil
+}
+
+// enqueue stores a relay for a validated request. With an idempotency key,
+// hash fingerprints the request and replayed reports whether an earlier
+// relay was returned instead.
+func (h *Handlers) enqueue(principal middleware.Principal, req model.CreateRelayRequest, idemKey, hash string) (relay *model.Relay, replayed bool, err error) {
 	createFn := func() (*model.Relay, error) {
-		now := time.Now().UTC()
-		relay := &model.Relay{
-			ID:            uuid.New(),
-			EventType:     req.EventType,
-			Destination:   req.Destination,
-			Payload:       req.Payload,
-			Metadata:      req.Metadata,
-			Status:        model.RelayStatusQueued,
-			CreatedAt:     now,
-			DeliveredAt:   nil,
-			FailureReason: nil,
+		relay, err := h.build(principal, req)
+		if err != nil {
+			return nil, err
 		}
 		h.store.Create(relay)
 		return relay, nil
 	}
 
-	var relay *model.Relay
+	if idemKey == "" {
+		relay, err = createFn()
+		return relay, false, err
+	}
 
-	if idemKey != "" {
-		res, err := h.idem.GetOrCreate(apiKey, idemKey, hashHex, createFn)
+	// The idempotency store only remembers the relay ID, so a deleted relay's
+	// payload does not outlive it there; replays read the current state.
+	// Scoped by tenant rather than key so retries survive key rotation.
+	ref, err := h.idem.GetOrCreate(principal.Tenant, idemKey, hash, func() (*model.Relay, error) {
+		created, err := createFn()
 		if err != nil {
-			if store.IsIdempotencyConflict(err) {
-				WriteError(w, r, http.StatusConflict, "idempotency_conflict", "idempotency key reuse with different payload", nil)
-				return
-			}
-			WriteError(w, r, http.StatusInternalServerError, "internal", "idempotency failure", map[string]any{"err": err.Error()})
-			return
+			return nil, err
 		}
-		relay = res
-	} else {
-		relay, err = createFn()
-		if err != nil {
-			WriteError(w, r, http.StatusInternalServerError, "internal", "failed to create relay", map[string]any{"err": err.Error()})
-			return
+		relay = created
+		return &model.Relay{ID: created.ID}, nil
+	})
+	if err != nil || relay != nil {
+		return relay, false, err
+	}
+	relay, ok := h.store.Get(ref.ID)
+	if !ok {
+		return nil, false, store.ErrRelayNotFound
+	}
+	return relay, true, nil
+}
+
+// newRelay builds the relay for a validated request, with one pending
+// delivery per destination.
+func newRelay(tenant string, req model.CreateRelayRequest, now time.Time) *model.Relay {
+	relay := &model.Relay{
+		ID:            uuid.New(),
+		EventType:     req.EventType,
+		Payload:       req.Payload,
+		Metadata:      req.Metadata,
+		Status:        model.RelayStatusQueued,
+		CreatedAt:     now,
+		DeliveredAt:   nil,
+		FailureReason: nil,
+		CallbackURL:   req.CallbackURL,
+		OrderingKey:   req.OrderingKey,
+		Tenant:        tenant,
+	}
+	for _, d := range destinations(req) {
+		relay.Deliveries = append(relay.Deliveries, model.Delivery{Destination: d, Status: model.DeliveryStatusPending})
+	}
+	if len(relay.Deliveries) > 0 {
+		dest := relay.Deliveries[0].Destination
+		relay.Destination = &dest
+	}
+	if at := deliverAt(req, now); at != nil {
+		relay.Status = model.RelayStatusScheduled
+		relay.DeliverAt = at
+	}
+	relay.ExpiresAt = expiresAt(req, now)
+	return relay
+}
+
+// destinations returns the request's destinations, whichever form it used.
+// It is empty for relays routed by subscription.
+func destinations(req model.CreateRelayRequest) []model.Destination {
+	if len(req.Destinations) > 0 {
+		return req.Destinations
+	}
+	if req.Destination == (model.Destination{}) {
+		return nil
+	}
+	return []model.Destination{req.Destination}
+}
+
+var (
+	errNoSubscribers = errors.New("no matching subscription")
+	errTooManyRoutes = errors.New("too many matching subscriptions and rules")
+)
+
+// routeError describes why a relay could not be routed, or returns nil if
+// err is not a routing error.
+func routeError(err error) *requestError {
+	switch {
+	case errors.Is(err, errNoSubscribers):
+		return &requestError{status: http.StatusUnprocessableEntity, code: "no_subscribers", message: "no subscription matches this relay"}
+	case errors.Is(err, errTooManyRoutes):
+		return &requestError{status: http.StatusUnprocessableEntity, code: "too_many_destinations",
+			message: "more subscriptions and rules match this relay than it may have destinations",
+			details: map[string]any{"maxDestinations": maxDestinations}}
+	}
+	return nil
+}
+
+// matchRules evaluates the tenant's rules against a new relay, in order. It
+// returns the first matching drop rule, if any, and the matching route
+// rules.
+func (h *Handlers) matchRules(relay *model.Relay) (drop *model.Rule, routes []*model.Rule) {
+	list := h.rules.Compiled(relay.Tenant)
+	if len(list) == 0 {
+		return nil, nil
+	}
+	env, err := rules.NewEnv(relay.EventType, relay.Metadata, relay.Payload)
+	if err != nil {
+		return nil, nil
+	}
+	for _, c := range list {
+		if !c.Cond.Eval(env) {
+			continue
+		}
+		rule := c.Rule
+		if rule.Action == model.RuleActionDrop {
+			return rule, nil
 		}
+		routes = append(routes, rule)
 	}
+	return nil, routes
+}
 
-	w.WriteHeader(http.StatusCreated)
-	_ = json.NewEncoder(w).Encode(relay)
+// route adds a delivery for every subscription matching the relay and for
+// every matching route rule. It fails with errNoSubscribers if there is
+// none, and with errTooManyRoutes if there are more than maxDestinations.
+func (h *Handlers) route(relay *model.Relay, routes []*model.Rule) error {
+	subs := h.subs.Match(relay.Tenant, relay.EventType, relay.Metadata)
+	switch n := len(subs) + len(routes); {
+	case n == 0:
+		return errNoSubscribers
+	case n > maxDestinations:
+		return errTooManyRoutes
+	}
+	for _, sub := range subs {
+		id := sub.ID
+		relay.Deliveries = append(relay.Deliveries, model.Delivery{
+			Destination:    sub.Destination,
+			SubscriptionID: &id,
+			Status:         model.DeliveryStatusPending,
+		})
+	}
+	for _, rule := range routes {
+		id := rule.ID
+		relay.Deliveries = append(relay.Deliveries, model.Delivery{
+			Destination: *rule.Destination,
+			RuleID:      &id,
+			Status:      model.DeliveryStatusPending,
+		})
+	}
+	dest := relay.Deliveries[0].Destination
+	relay.Destination = &dest
+	return nil
+}
+
+// requestHash fingerprints a batch item for idempotency checks. Single
+// creates fingerprint their raw body instead, so reusing a key across the
+// two endpoints is a conflict.
+func requestHash(req model.CreateRelayRequest) string {
+	raw, _ := json.Marshal(req)
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
 }
 
 func (h *Handlers) GetRelay(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
-	id, err := uuid.Parse(idStr)
-	if err != nil {
-		WriteError(w, r, http.StatusBadRequest, "invalid_request", "invalid relay id", nil)
+	relay, ok := h.ownedRelay(w, r)
+	if !ok {
 		return
 	}
+	_ = json.NewEncoder(w).Encode(relay)
+}
 
-	relay, ok := h.store.Get(id)
+// CancelRelay stops a relay that has not been delivered yet.
+func (h *Handlers) CancelRelay(w http.ResponseWriter, r *http.Request) {
+	relay, ok := h.ownedRelay(w, r)
 	if !ok {
-		WriteError(w, r, http.StatusNotFound, "not_found", "relay not found", nil)
 		return
 	}
-
+	relay, err := h.store.Cancel(relay.ID, time.Now().UTC())
+	if err != nil {
+		writeRelayError(w, r, err)
+		return
+	}
+	h.log.Info("relay cancelled", "relay_id", relay.ID, "tenant", relay.Tenant)
+	middleware.RecordAudit(r, audit.TypeRelayCancelled, map[string]any{"relayId": relay.ID.String()})
 	_ = json.NewEncoder(w).Encode(relay)
 }
 
-func (h *Handlers) ListRelays(w http.ResponseWriter, r *http.Request) {
-	pageSize := 50
-	if v := r.URL.Query().Get("pageSize"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n >= 1 && n <= 200 {
-			pageSize = n
-		}
+// DeleteRelay erases a relay's payload and metadata, leaving a tombstone so
+// clients can still see that it existed and what happened to it.
+func (h *Handlers) DeleteRelay(w http.ResponseWriter, r *http.Request) {
+	relay, ok := h.ownedRelay(w, r)
+	if !ok {
+		return
 	}
+	relay, err := h.store.Delete(relay.ID, time.Now().UTC())
+	if err != nil {
+		writeRelayError(w, r, err)
+		return
+	}
+	h.log.Info("relay deleted", "relay_id", relay.ID, "tenant", relay.Tenant)
+	middleware.RecordAudit(r, audit.TypeRelayDeleted, map[string]any{"relayId": relay.ID.String()})
+	_ = json.NewEncoder(w).Encode(relay)
+}
 
-	pageToken := r.URL.Query().Get("pageToken")
-	offset, err := store.DecodePageToken(pageToken)
+// ownedRelay loads the relay named by the {id} path parameter, writing 400
+// or 404 unless it exists and belongs to the caller's tenant.
+func (h *Handlers) ownedRelay(w http.ResponseWriter, r *http.Request) (*model.Relay, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
 	if err != nil {
-		WriteError(w, r, http.StatusBadRequest, "invalid_request", "invalid pageToken", nil)
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "invalid relay id", nil)
+		return nil, false
+	}
+
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	relay, ok := h.store.Get(id)
+	if !ok || relay.Tenant != principal.Tenant {
+		WriteError(w, r, http.StatusNotFound, "not_found", "relay not found", nil)
+		return nil, false
+	}
+	return relay, true
+}
+
+func writeRelayError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrRelayNotFound):
+		WriteError(w, r, http.StatusNotFound, "not_found", "relay not found", nil)
+	case errors.Is(err, store.ErrRelayNotCancellable):
+		WriteError(w, r, http.StatusConflict, "conflict", "relay is no longer pending", nil)
+	default:
+		WriteError(w, r, http.StatusInternalServerError, "internal", "relay update failed", map[string]any{"err": err.Error()})
+	}
+}
+
+func (h *Handlers) ListRelays(w http.ResponseWriter, r *http.Request) {
+	pageSize, offset, ok := pageParams(w, r)
+	if !ok {
 		return
 	}
 
-	items, nextOffset := h.store.List(pageSize, offset)
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	items, nextOffset := h.store.List(principal.Tenant, pageSize, offset)
 
 	resp := model.ListRelaysResponse{
 		Items:         items,
@@ -152,22 +416,131 @@ func (h *Handlers) ListRelays(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(resp)
 }
 
+// pageParams reads pageSize and pageToken, writing a 400 for a bad token.
+func pageParams(w http.ResponseWriter, r *http.Request) (pageSize, offset int, ok bool) {
+	pageSize = 50
+	if v := r.URL.Query().Get("pageSize"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 1 && n <= 200 {
+			pageSize = n
+		}
+	}
+	offset, err := store.DecodePageToken(r.URL.Query().Get("pageToken"))
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "invalid pageToken", nil)
+		return 0, 0, false
+	}
+	return pageSize, offset, true
+}
+
 func validateCreate(req model.CreateRelayRequest) error {
 	if strings.TrimSpace(req.EventType) == "" || len(req.EventType) > 128 {
 		return errf("eventType is required and must be <= 128 characters")
 	}
-	if req.Destination.Type != "webhook" {
-		return errf("destination.type must be 'webhook'")
+	if len(req.Destinations) > 0 {
+		if req.Destination != (model.Destination{}) {
+			return errf("destination and destinations are mutually exclusive")
+		}
+		if len(req.Destinations) > maxDestinations {
+			return errf("destinations must contain at most 10 entries")
+		}
 	}
-	if strings.TrimSpace(req.Destination.URL) == "" || len(req.Destination.URL) > 2048 {
-		return errf("destination.url is required and must be <= 2048 characters")
+	seen := map[string]bool{}
+	for _, d := range destinations(req) {
+		if err := validateDestination(d); err != nil {
+			return err
+		}
+		if seen[d.URL] {
+			return errf("destinations must not repeat a url")
+		}
+		seen[d.URL] = true
 	}
 	if len(req.Payload) == 0 {
 		return errf("payload is required")
 	}
+	if len(req.OrderingKey) > 128 {
+		return errf("orderingKey must be <= 128 characters")
+	}
+	if req.CallbackURL != "" {
+		if err := (delivery.WebhookSender{}).Validate(model.Destination{URL: req.CallbackURL}); err != nil {
+			return errf("callbackUrl must be an http or https URL of at most 2048 characters")
+		}
+	}
+	if req.DeliverAt != nil && req.DelaySeconds != 0 {
+		return errf("deliverAt and delaySeconds are mutually exclusive")
+	}
+	if req.DelaySeconds < 0 || time.Duration(req.DelaySeconds)*time.Second > maxScheduleDelay {
+		return errf("delaySeconds must be within 0..2592000")
+	}
+	if req.DeliverAt != nil && time.Until(*req.DeliverAt) > maxScheduleDelay {
+		return errf("deliverAt must be at most 30 days ahead")
+	}
+	if req.ExpiresAt != nil && req.TTLSeconds != 0 {
+		return errf("expiresAt and ttlSeconds are mutually exclusive")
+	}
+	if req.TTLSeconds < 0 || time.Duration(req.TTLSeconds)*time.Second > maxScheduleDelay {
+		return errf("ttlSeconds must be within 0..2592000")
+	}
+	if req.ExpiresAt != nil && time.Until(*req.ExpiresAt) <= 0 {
+		return errf("expiresAt must be in the future")
+	}
+	if req.ExpiresAt != nil && time.Until(*req.ExpiresAt) > maxScheduleDelay {
+		return errf("expiresAt must be at most 30 days ahead")
+	}
+	now := time.Now().UTC()
+	if exp, at := expiresAt(req, now), deliverAt(req, now); exp != nil && at != nil && !exp.After(*at) {
+		return errf("relay would expire before it is delivered")
+	}
+	return nil
+}
+
+func validateDestination(d model.Destination) error {
+	if err := delivery.ValidateDestination(d); err != nil {
+		return err
+	}
+	if _, err := transform.Compile(d.Transform); err != nil {
+		return errf("destination.transform: " + err.Error())
+	}
 	return nil
 }
 
+// maxDestinations bounds the fan-out of a single relay.
+const maxDestinations = 10
+
+// maxScheduleDelay bounds how far ahead a relay can be scheduled or expire.
+const maxScheduleDelay = 30 * 24 * time.Hour
+
+// expiresAt resolves the requested expiry; nil means the relay never
+// expires.
+func expiresAt(req model.CreateRelayRequest, now time.Time) *time.Time {
+	switch {
+	case req.ExpiresAt != nil:
+		at := req.ExpiresAt.UTC()
+		return &at
+	case req.TTLSeconds > 0:
+		at := now.Add(time.Duration(req.TTLSeconds) * time.Second)
+		return &at
+	}
+	return nil
+}
+
+// deliverAt resolves the requested delivery time. It returns nil when the
+// relay should be queued immediately.
+func deliverAt(req model.CreateRelayRequest, now time.Time) *time.Time {
+	var at time.Time
+	switch {
+	case req.DeliverAt != nil:
+		at = req.DeliverAt.UTC()
+	case req.DelaySeconds > 0:
+		at = now.Add(time.Duration(req.DelaySeconds) * time.Second)
+	default:
+		return nil
+	}
+	if !at.After(now) {
+		return nil
+	}
+	return &at
+}
+
 func isJSONObject(raw json.RawMessage) bool {
 	// Minimal check: first non-space must be '{'
 	for _, b := range raw {
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/segolab/relay-ref/server/go/pkg/audit"
+	"github.com/segolab/relay-ref/server/go/pkg/middleware"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+	"github.com/segolab/relay-ref/server/go/pkg/store"
+)
+
+// KeyHandlers manage API keys at runtime under /v1/admin/keys.
+type KeyHandlers struct {
+	log  *slog.Logger
+	cfg  Config
+	keys store.APIKeyStore
+}
+
+func NewKeyHandlers(log *slog.Logger, cfg Config, keys store.APIKeyStore) *KeyHandlers {
+	return &KeyHandlers{log: log, cfg: cfg, keys: keys}
+}
+
+func (h *KeyHandlers) ListKeys(w http.ResponseWriter, r *http.Request) {
+	resp := model.ListAPIKeysResponse{Items: []model.APIKeyInfo{}}
+	for _, k := range h.keys.List() {
+		resp.Items = append(resp.Items, toKeyInfo(k))
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (h *KeyHandlers) CreateKey(w http.ResponseWriter, r *http.Request) {
+	var req model.CreateAPIKeyRequest
+	if !decodeAdminRequest(w, r, &req) {
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	req.Tenant = strings.TrimSpace(req.Tenant)
+	if req.Name == "" || len(req.Name) > 128 || req.Tenant == "" || len(req.Tenant) > 128 {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "name and tenant are required and must be <= 128 characters", nil)
+		return
+	}
+	if req.ExpiresInSeconds < 0 {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "expiresInSeconds must not be negative", nil)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "at least one scope is required", nil)
+		return
+	}
+	for _, sc := range req.Scopes {
+		if !slices.Contains(middleware.KnownScopes, sc) {
+			WriteError(w, r, http.StatusBadRequest, "invalid_request", "unknown scope", map[string]any{"scope": sc})
+			return
+		}
+	}
+
+	for _, host := range req.DestinationHosts {
+		if !middleware.ValidDestinationHost(host) {
+			WriteError(w, r, http.StatusBadRequest, "invalid_request", `destinationHosts entries must be host names or "*." followed by a domain`,
+				map[string]any{"host": host})
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	secret, hash := store.GenerateAPIKey()
+	k := &store.APIKey{
+		ID:        store.APIKeyIDFromHash(hash),
+		Name:      req.Name,
+		Tenant:    req.Tenant,
+		Hash:      hash,
+		CreatedAt: now,
+
+		Scopes:            req.Scopes,
+		EventTypePrefixes: req.EventTypePrefixes,
+		DestinationHosts:  req.DestinationHosts,
+	}
+	if req.ExpiresInSeconds > 0 {
+		exp := now.Add(time.Duration(req.ExpiresInSeconds) * time.Second)
+		k.ExpiresAt = &exp
+	}
+	h.keys.Put(k)
+	h.log.Info("api key created", "key_id", k.ID, "tenant", k.Tenant, "scopes", k.Scopes)
+	middleware.RecordAudit(r, audit.TypeKeyCreated, map[string]any{"keyId": k.ID, "keyTenant": k.Tenant, "scopes": k.Scopes})
+
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(model.APIKeySecretResponse{Key: toKeyInfo(k), Secret: secret})
+}
+
+func (h *KeyHandlers) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	k, err := h.keys.Revoke(chi.URLParam(r, "id"), time.Now().UTC())
+	if err != nil {
+		writeKeyError(w, r, err)
+		return
+	}
+	h.log.Info("api key revoked", "key_id", k.ID, "tenant", k.Tenant)
+	middleware.RecordAudit(r, audit.TypeKeyRevoked, map[string]any{"keyId": k.ID, "keyTenant": k.Tenant})
+	_ = json.NewEncoder(w).Encode(toKeyInfo(k))
+}
+
+func (h *KeyHandlers) RotateKey(w http.ResponseWriter, r *http.Request) {
+	var req model.RotateAPIKeyRequest
+	if r.ContentLength != 0 && !decodeAdminRequest(w, r, &req) {
+		return
+	}
+	if req.GracePeriodSeconds < 0 || req.GracePeriodSeconds > 7*86400 {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "gracePeriodSeconds must be within 0..604800", nil)
+		return
+	}
+
+	oldID := chi.URLParam(r, "id")
+	k, secret, err := h.keys.Rotate(oldID, time.Duration(req.GracePeriodSeconds)*time.Second, time.Now().UTC())
+	if err != nil {
+		writeKeyError(w, r, err)
+		return
+	}
+	h.log.Info("api key rotated", "old_key_id", oldID, "key_id", k.ID, "tenant", k.Tenant)
+	middleware.RecordAudit(r, audit.TypeKeyRotated, map[string]any{"oldKeyId": oldID, "keyId": k.ID, "keyTenant": k.Tenant})
+
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(model.APIKeySecretResponse{Key: toKeyInfo(k), Secret: secret})
+}
+
+func writeKeyError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrAPIKeyNotFound):
+		WriteError(w, r, http.StatusNotFound, "not_found", "api key not found", nil)
+	case errors.Is(err, store.ErrAPIKeyRevoked):
+		WriteError(w, r, http.StatusConflict, "conflict", "api key is revoked", nil)
+	default:
+		WriteError(w, r, http.StatusInternalServerError, "internal", "api key failure", map[string]any{"err": err.Error()})
+	}
+}
+
+func toKeyInfo(k *store.APIKey) model.APIKeyInfo {
+	return model.APIKeyInfo{
+		ID:         k.ID,
+		Name:       k.Name,
+		Tenant:     k.Tenant,
+		CreatedAt:  k.CreatedAt,
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		RevokedAt:  k.RevokedAt,
+
+		Scopes:            k.Scopes,
+		EventTypePrefixes: k.EventTypePrefixes,
+		DestinationHosts:  k.DestinationHosts,
+	}
+}
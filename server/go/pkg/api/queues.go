@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/segolab/relay-ref/server/go/pkg/delivery"
+	"github.com/segolab/relay-ref/server/go/pkg/middleware"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+)
+
+// maxReceiveMessages bounds one receive call.
+const maxReceiveMessages = 100
+
+// maxVisibilityTimeout bounds leases and nack delays.
+const maxVisibilityTimeout = 12 * time.Hour
+
+// QueueHandlers let consumers pull from the tenant's in-process queues,
+// which relays with a queue destination are delivered to. Received
+// messages are leased until acked, nacked or the visibility timeout
+// passes.
+type QueueHandlers struct {
+	log    *slog.Logger
+	cfg    Config
+	queues *delivery.Queues
+}
+
+func NewQueueHandlers(log *slog.Logger, cfg Config, queues *delivery.Queues) *QueueHandlers {
+	return &QueueHandlers{log: log, cfg: cfg, queues: queues}
+}
+
+func (h *QueueHandlers) ReceiveMessages(w http.ResponseWriter, r *http.Request) {
+	name, ok := queueName(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.cfg.MaxBodyBytes)
+	var req model.ReceiveMessagesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "invalid JSON", map[string]any{"err": err.Error()})
+		return
+	}
+	if req.MaxMessages == 0 {
+		req.MaxMessages = 1
+	}
+	if req.MaxMessages < 1 || req.MaxMessages > maxReceiveMessages {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "maxMessages must be within 1..100", nil)
+		return
+	}
+	visibility := time.Duration(req.VisibilityTimeoutSeconds) * time.Second
+	if visibility == 0 {
+		visibility = h.cfg.QueueVisibilityTimeout
+	}
+	if visibility < 0 || visibility > maxVisibilityTimeout {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "visibilityTimeoutSeconds must be within 1..43200", nil)
+		return
+	}
+	wait := time.Duration(req.WaitSeconds) * time.Second
+	if wait < 0 || wait > h.cfg.QueueMaxWait {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "waitSeconds exceeds the server maximum",
+			map[string]any{"maxWaitSeconds": int(h.cfg.QueueMaxWait / time.Second)})
+		return
+	}
+
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	receive := h.queues.Receive
+	if req.DeadLetter {
+		receive = h.queues.ReceiveDeadLetters
+	}
+	msgs := receive(r.Context(), principal.Tenant, name, req.MaxMessages, visibility, wait)
+	_ = json.NewEncoder(w).Encode(model.ReceiveMessagesResponse{Items: msgs})
+}
+
+func (h *QueueHandlers) AckMessage(w http.ResponseWriter, r *http.Request) {
+	name, ok := queueName(w, r)
+	if !ok {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, h.cfg.MaxBodyBytes)
+	var req model.AckMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ReceiptHandle == "" {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "receiptHandle is required", nil)
+		return
+	}
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	if err := h.queues.Ack(principal.Tenant, name, req.ReceiptHandle); err != nil {
+		writeReceiptError(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *QueueHandlers) NackMessage(w http.ResponseWriter, r *http.Request) {
+	name, ok := queueName(w, r)
+	if !ok {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, h.cfg.MaxBodyBytes)
+	var req model.NackMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ReceiptHandle == "" {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "receiptHandle is required", nil)
+		return
+	}
+	delay := time.Duration(req.DelaySeconds) * time.Second
+	if delay < 0 || delay > maxVisibilityTimeout {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "delaySeconds must be within 0..43200", nil)
+		return
+	}
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	if err := h.queues.Nack(principal.Tenant, name, req.ReceiptHandle, delay); err != nil {
+		writeReceiptError(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// queueName validates the {name} path parameter.
+func queueName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name := chi.URLParam(r, "name")
+	if err := delivery.ValidateDestination(model.Destination{Type: model.DestinationQueue, URL: "queue:" + name}); err != nil {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", err.Error(), nil)
+		return "", false
+	}
+	return name, true
+}
+
+func writeReceiptError(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, r, http.StatusNotFound, "not_found", "no message holds this receipt handle; it was acked or its lease expired", nil)
+}
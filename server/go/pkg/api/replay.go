@@ -0,0 +1,220 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/segolab/relay-ref/server/go/pkg/audit"
+	"github.com/segolab/relay-ref/server/go/pkg/middleware"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+)
+
+// RedeliverRelay queues a fresh copy of a finished relay. The copy links
+// back to the original through redeliveryOf; the original is unchanged.
+func (h *Handlers) RedeliverRelay(w http.ResponseWriter, r *http.Request) {
+	orig, ok := h.ownedRelay(w, r)
+	if !ok {
+		return
+	}
+	switch {
+	case orig.DeletedAt != nil:
+		WriteError(w, r, http.StatusConflict, "conflict", "relay has been deleted", nil)
+		return
+	case orig.Status.Pending():
+		WriteError(w, r, http.StatusConflict, "conflict", "relay is still pending", nil)
+		return
+	}
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	if e := h.checkCreate(principal, asCreateRequest(orig)); e != nil {
+		WriteError(w, r, e.status, e.code, e.message, e.details)
+		return
+	}
+
+	relay, err := h.redeliver(orig, time.Now().UTC())
+	if err != nil {
+		e := routeError(err)
+		WriteError(w, r, e.status, e.code, e.message, e.details)
+		return
+	}
+	h.log.Info("relay redelivered", "relay_id", relay.ID, "redelivery_of", orig.ID, "tenant", relay.Tenant)
+	middleware.RecordAudit(r, audit.TypeRelayRedelivered, map[string]any{"relayId": orig.ID.String(), "newRelayId": relay.ID.String()})
+
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(relay)
+}
+
+// ReplayRelays redelivers every relay matching a filter, or with dryRun
+// only counts them. Each redelivered relay costs one rate-limit token; see
+// replayCost.
+func (h *Handlers) ReplayRelays(w http.ResponseWriter, r *http.Request) {
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.cfg.MaxBodyBytes)
+	var req model.ReplayRelaysRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "invalid JSON", map[string]any{"err": err.Error()})
+		return
+	}
+	if err := normalizeReplayFilter(&req.Filter); err != nil {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", err.Error(), nil)
+		return
+	}
+
+	if req.DryRun {
+		resp := model.ReplayRelaysResponse{Matched: h.store.Count(principal.Tenant, req.Filter), DryRun: true, Created: []uuid.UUID{}}
+		_ = json.NewEncoder(w).Encode(resp)
+		return
+	}
+	matches, ok := r.Context().Value(replayMatchesCtxKey{}).([]*model.Relay)
+	if !ok {
+		if matches, ok = h.replayMatches(principal, req.Filter); !ok {
+			h.replayTooLarge(w, r)
+			return
+		}
+	}
+	resp := model.ReplayRelaysResponse{Matched: len(matches), Created: []uuid.UUID{}}
+
+	now := time.Now().UTC()
+	for _, orig := range matches {
+		relay, err := h.redeliver(orig, now)
+		if err != nil {
+			h.log.Info("replayed relay could not be routed", "relay_id", orig.ID, "tenant", orig.Tenant, "err", err)
+			continue
+		}
+		resp.Created = append(resp.Created, relay.ID)
+	}
+	h.log.Info("relays replayed", "tenant", principal.Tenant, "count", len(resp.Created))
+	middleware.RecordAudit(r, audit.TypeRelaysReplayed, map[string]any{"filter": req.Filter, "count": len(resp.Created)})
+
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// redeliver stores a new relay redelivering orig. A dropped relay never had
+// destinations, so it is routed afresh under the tenant's current rules and
+// subscriptions; it fails as route does if that is not possible.
+func (h *Handlers) redeliver(orig *model.Relay, now time.Time) (*model.Relay, error) {
+	origID := orig.ID
+	relay := newRelay(orig.Tenant, asCreateRequest(orig), now)
+	relay.RedeliveryOf = &origID
+	if orig.Status == model.RelayStatusDropped {
+		if err := h.resolve(relay); err != nil {
+			return nil, err
+		}
+	}
+	h.store.Create(relay)
+	return relay, nil
+}
+
+// replayMatches returns the relays a replay would redeliver: those matching
+// f that the caller would also be allowed to create. It reports false,
+// without checking any, once f matches more than ReplayMaxItems relays.
+func (h *Handlers) replayMatches(principal middleware.Principal, f model.RelayFilter) ([]*model.Relay, bool) {
+	found := h.store.Find(principal.Tenant, f, h.cfg.ReplayMaxItems+1)
+	if len(found) > h.cfg.ReplayMaxItems {
+		return nil, false
+	}
+	var out []*model.Relay
+	for _, rl := range found {
+		if h.checkCreate(principal, asCreateRequest(rl)) == nil {
+			out = append(out, rl)
+		}
+	}
+	return out, true
+}
+
+func (h *Handlers) replayTooLarge(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, r, http.StatusBadRequest, "invalid_request", "filter matches too many relays; narrow it",
+		map[string]any{"maxItems": h.cfg.ReplayMaxItems})
+}
+
+// normalizeReplayFilter defaults the status to failed. Pending relays
+// cannot be replayed.
+func normalizeReplayFilter(f *model.RelayFilter) error {
+	switch f.Status {
+	case "":
+		f.Status = model.RelayStatusFailed
+	case model.RelayStatusQueued, model.RelayStatusScheduled:
+		return errf("pending relays cannot be replayed")
+	case model.RelayStatusDelivered, model.RelayStatusFailed, model.RelayStatusCancelled, model.RelayStatusExpired,
+		model.RelayStatusDropped:
+	default:
+		return errf("unknown status")
+	}
+	if f.CreatedAfter != nil && f.CreatedBefore != nil && !f.CreatedAfter.Before(*f.CreatedBefore) {
+		return errf("createdAfter must be before createdBefore")
+	}
+	return nil
+}
+
+// asCreateRequest rebuilds the request a relay was created from, minus
+// scheduling and expiry. Only the destinations whose delivery failed or was
+// skipped are included, so a partial fan-out is not re-sent where it
+// succeeded; a relay delivered everywhere is sent everywhere again.
+func asCreateRequest(rl *model.Relay) model.CreateRelayRequest {
+	req := model.CreateRelayRequest{
+		EventType:   rl.EventType,
+		Payload:     rl.Payload,
+		Metadata:    rl.Metadata,
+		CallbackURL: rl.CallbackURL,
+		OrderingKey: rl.OrderingKey,
+	}
+	var dests []model.Destination
+	for _, d := range rl.Deliveries {
+		if d.Status == model.DeliveryStatusFailed || d.Status == model.DeliveryStatusSkipped {
+			dests = append(dests, d.Destination)
+		}
+	}
+	if len(dests) == 0 {
+		for _, d := range rl.Deliveries {
+			dests = append(dests, d.Destination)
+		}
+	}
+	switch {
+	case len(dests) > 1:
+		req.Destinations = dests
+	case len(dests) == 1:
+		req.Destination = dests[0]
+	case rl.Destination != nil:
+		req.Destination = *rl.Destination
+	}
+	return req
+}
+
+type replayMatchesCtxKey struct{}
+
+// replayCost charges one rate-limit token per relay a replay would
+// redeliver. Dry runs cost a single token. A filter matching more than
+// ReplayMaxItems relays is refused here, before any are checked. The matches
+// are passed on to the handler, so exactly the relays charged for are
+// redelivered; the body is restored for it too.
+func (h *Handlers) replayCost(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.cfg.MaxBodyBytes))
+		if err != nil {
+			WriteError(w, r, http.StatusBadRequest, "invalid_request", "failed to read request body", map[string]any{"err": err.Error()})
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(raw))
+
+		var req model.ReplayRelaysRequest
+		if json.Unmarshal(raw, &req) == nil && !req.DryRun && normalizeReplayFilter(&req.Filter) == nil {
+			principal, _ := middleware.PrincipalFromContext(r.Context())
+			matches, ok := h.replayMatches(principal, req.Filter)
+			if !ok {
+				h.replayTooLarge(w, r)
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), replayMatchesCtxKey{}, matches))
+			if n := len(matches); n > 1 {
+				r = middleware.WithRateLimitCost(r, n)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -3,33 +3,180 @@ package api
 import (
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/segolab/relay-ref/server/go/pkg/admission"
+	"github.com/segolab/relay-ref/server/go/pkg/audit"
+	"github.com/segolab/relay-ref/server/go/pkg/auth"
+	"github.com/segolab/relay-ref/server/go/pkg/delivery"
+	"github.com/segolab/relay-ref/server/go/pkg/metrics"
 	"github.com/segolab/relay-ref/server/go/pkg/middleware"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+	"github.com/segolab/relay-ref/server/go/pkg/openapi"
 	"github.com/segolab/relay-ref/server/go/pkg/ratelimit"
 	"github.com/segolab/relay-ref/server/go/pkg/store"
 )
 
 type Config struct {
-	HTTPAddr       string
-	APIKeys        map[string]struct{}
-	MaxBodyBytes   int64
-	IdempotencyTTL time.Duration
-	LimitPostRPS   float64
-	LimitPostBurst int
-	LimitGetRPS    float64
-	LimitGetBurst  int
-	LogLevel       slog.Level
+	HTTPAddr     string
+	MaxBodyBytes int64
+	// BatchMaxItems and BatchMaxBodyBytes bound POST /v1/relays:batch.
+	BatchMaxItems     int
+	BatchMaxBodyBytes int64
+	// ReplayMaxItems bounds how many relays one POST /v1/relays:replay may
+	// redeliver.
+	ReplayMaxItems int
+	// SchedulerInterval is how often scheduled relays are checked for
+	// promotion to queued.
+	SchedulerInterval time.Duration
+	// Delivery* configure the dispatcher. It is off unless DeliveryEnabled
+	// is set; relays then stay queued.
+	DeliveryEnabled     bool
+	DeliveryInterval    time.Duration
+	DeliveryConcurrency int
+	DeliveryTimeout     time.Duration
+	DeliveryMaxAttempts int
+	DeliveryBackoffBase time.Duration
+	DeliveryBackoffMax  time.Duration
+	// OrderingPolicy is how the dispatcher treats an ordered relay that
+	// runs out of attempts. Under model.OrderingSkip it is also sent to the
+	// tenant's OrderingDeadLetterQueue, unless that is empty.
+	OrderingPolicy          model.OrderingPolicy
+	OrderingDeadLetterQueue string
+	// CallbackSecret is the key each tenant's callback signing secret is
+	// derived from; relays may only ask for callbacks when it is set.
+	// Callback* is their retry policy.
+	CallbackSecret      string
+	CallbackMaxAttempts int
+	CallbackBackoffBase time.Duration
+	CallbackBackoffMax  time.Duration
+	// FileSinkDir is where file destinations are appended.
+	FileSinkDir string
+	// QueueMaxDepth bounds each in-process queue. QueueMaxReceives is how
+	// often a message is leased before it moves to the dead-letter queue.
+	QueueMaxDepth    int
+	QueueMaxReceives int
+	// QueueVisibilityTimeout is the default lease of received messages;
+	// QueueMaxWait bounds long polling.
+	QueueVisibilityTimeout time.Duration
+	QueueMaxWait           time.Duration
+	// StrictEventTypeTenants reject relays whose eventType is not
+	// registered under /v1/event-types; other tenants accept them
+	// unvalidated.
+	StrictEventTypeTenants map[string]struct{}
+	// WatchHeartbeat is how often idle watch streams send a keepalive;
+	// WatchMaxStreams bounds the streams one credential may hold open.
+	WatchHeartbeat  time.Duration
+	WatchMaxStreams int
+	IdempotencyTTL  time.Duration
+	LimitPostRPS    float64
+	LimitPostBurst  int
+	LimitGetRPS     float64
+	LimitGetBurst   int
+	// LimitReceiveRPS and LimitReceiveBurst limit each queue consumer
+	// (API key) across receive, ack and nack.
+	LimitReceiveRPS   float64
+	LimitReceiveBurst int
+	// APIKeys and AdminKeys are plaintext keys from the environment. They are
+	// hashed into the API key store at startup under DefaultTenant; admin
+	// keys are also valid API keys.
+	APIKeys       map[string]struct{}
+	AdminKeys     map[string]struct{}
+	DefaultTenant string
+	// JWT* enable bearer authentication alongside API keys. JWTJWKS is a
+	// file path or http(s) URL; empty disables bearer auth.
+	JWTJWKS        string
+	JWTJWKSRefresh time.Duration
+	JWTIssuer      string
+	JWTAudience    string
+	JWTTenantClaim string
+	// TLS* enable native TLS. With TLSClientAuth "request" or "require",
+	// verified client certificates authenticate as TLSClientTenants[identity]
+	// with TLSClientScopes; see middleware.ClientCertAuthenticator.
+	TLSCertFile      string
+	TLSKeyFile       string
+	TLSClientCAFile  string
+	TLSClientAuth    string
+	TLSClientTenants map[string]string
+	TLSClientScopes  []string
+	// LimitPostMode and LimitGetMode select whether the primary limiter is
+	// enforced or only evaluated in shadow (dry-run) mode for a route group.
+	LimitPostMode LimitMode
+	LimitGetMode  LimitMode
+	// Shadow* configure an optional second, typically stricter, policy that
+	// is always evaluated in shadow mode. Zero RPS disables it for a group.
+	ShadowPostRPS   float64
+	ShadowPostBurst int
+	ShadowGetRPS    float64
+	ShadowGetBurst  int
+	// Admission* configure the server-wide concurrency limit. Zero
+	// AdmissionMaxInFlight disables it.
+	AdmissionMaxInFlight     int
+	AdmissionMinLimit        int
+	AdmissionAdaptive        bool
+	AdmissionTargetLatency   time.Duration
+	AdmissionPriorityReserve float64
+	// AdmissionPriorityKeys holds API key IDs, not secrets.
+	AdmissionPriorityKeys map[string]struct{}
+	AdmissionRetryAfter   int
+	// Audit* configure audit sinks: a hash-chained JSONL file and/or stdout.
+	// AuditBuffer bounds the events kept in memory for the admin API and
+	// those queued for the sinks.
+	AuditFile   string
+	AuditStdout bool
+	AuditBuffer int
+	// ValidateRequests checks requests against the contract, by default
+	// the copy of api/openapi.yaml built into the binary; OpenAPISpec names
+	// another file to load instead. ValidateResponses also checks
+	// responses, for tests.
+	ValidateRequests  bool
+	OpenAPISpec       string
+	ValidateResponses bool
+	// ErrorFormat is the default error body format; clients can always
+	// request problem details via Accept.
+	ErrorFormat middleware.ErrorFormat
+	LogLevel    slog.Level
 }
 
+type LimitMode string
+
+const (
+	LimitModeEnforce LimitMode = "enforce"
+	LimitModeShadow  LimitMode = "shadow"
+)
+
 type Dependencies struct {
 	Logger      *slog.Logger
 	Config      Config
 	RelayStore  store.RelayStore
 	Idempotency store.IdempotencyStore
 	Limiter     ratelimit.Limiter
+	// APIKeys is optional; nil uses an in-memory store. Config.APIKeys are
+	// seeded into it either way.
+	APIKeys store.APIKeyStore
+	// Subscriptions is optional; nil uses an in-memory store.
+	Subscriptions store.SubscriptionStore
+	// Rules is optional; nil uses an in-memory store.
+	Rules store.RuleStore
+	// EventTypes is optional; nil uses an in-memory store.
+	EventTypes store.EventTypeStore
+	// Queues is optional; nil creates one sized by Config.QueueMaxDepth.
+	// Share it with the dispatcher's queue driver.
+	Queues *delivery.Queues
+	// Audit is optional; nil keeps a query-only in-memory window.
+	Audit *audit.Log
+	// TokenVerifier is optional; nil disables bearer authentication.
+	TokenVerifier *auth.Verifier
+	// ShadowLimiter is optional; see Config.Shadow*.
+	ShadowLimiter ratelimit.Limiter
+	// Admission is optional; nil disables load shedding.
+	Admission *admission.Controller
+	// Contract is optional; nil disables request validation. See
+	// Config.ValidateRequests.
+	Contract *openapi.Spec
 }
 
 type App struct {
@@ -37,30 +184,268 @@ type App struct {
 }
 
 func NewApp(d Dependencies) *App {
-	h := NewHandlers(d.Logger, d.Config, d.RelayStore, d.Idempotency)
+	if d.APIKeys == nil {
+		d.APIKeys = store.NewInMemoryAPIKeyStore()
+	}
+	seedAPIKeys(d.APIKeys, d.Config, time.Now().UTC())
+	if d.Audit == nil {
+		d.Audit = audit.NewLog(d.Logger, d.Config.AuditBuffer)
+	}
+
+	if d.Subscriptions == nil {
+		d.Subscriptions = store.NewInMemorySubscriptionStore()
+	}
+	if d.Rules == nil {
+		d.Rules = store.NewInMemoryRuleStore()
+	}
+	if d.EventTypes == nil {
+		d.EventTypes = store.NewInMemoryEventTypeStore()
+	}
+	if d.Queues == nil {
+		d.Queues = delivery.NewQueues(d.Config.QueueMaxDepth)
+		d.Queues.MaxReceives = d.Config.QueueMaxReceives
+	}
+
+	h := NewHandlers(d.Logger, d.Config, d.RelayStore, d.Idempotency, d.Subscriptions, d.Rules, d.EventTypes)
 
 	r := chi.NewRouter()
 
-	// Global middleware
-	r.Use(middleware.Recover(d.Logger))
+	// Global middleware. Recover runs inside RequestID and Errors so that
+	// panic responses carry the request ID in the configured format.
 	r.Use(middleware.RequestID())
+	r.Use(middleware.Errors(d.Config.ErrorFormat))
+	r.Use(middleware.Audit(d.Audit))
+	r.Use(middleware.Recover(d.Logger))
 	r.Use(middleware.RespondJSON())
+	r.NotFound(func(w http.ResponseWriter, req *http.Request) {
+		WriteError(w, req, http.StatusNotFound, "not_found", "no such endpoint", nil)
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, req *http.Request) {
+		var allowed []string
+		for _, m := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete} {
+			if r.Match(chi.NewRouteContext(), m, req.URL.Path) {
+				allowed = append(allowed, m)
+			}
+		}
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		WriteError(w, req, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed for this endpoint",
+			map[string]any{"allow": allowed})
+	})
 
 	// System endpoints (no auth)
 	r.Get("/healthz", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
 	r.Get("/readyz", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+	r.Method(http.MethodGet, "/metrics", metrics.Handler())
 
 	// API group
 	r.Route("/v1", func(r chi.Router) {
-		r.Use(middleware.APIKeyAuth(d.Config.APIKeys))
+		authenticators := []middleware.Authenticator{middleware.APIKeyAuthenticator{Keys: d.APIKeys}}
+		if d.TokenVerifier != nil {
+			authenticators = append(authenticators, middleware.BearerAuthenticator{
+				Verifier:    d.TokenVerifier,
+				TenantClaim: d.Config.JWTTenantClaim,
+			})
+		}
+		if d.Config.TLSClientAuth == ClientAuthRequest || d.Config.TLSClientAuth == ClientAuthRequire {
+			authenticators = append(authenticators, middleware.ClientCertAuthenticator{
+				Tenants: d.Config.TLSClientTenants,
+				Scopes:  d.Config.TLSClientScopes,
+			})
+		}
+		r.Use(middleware.Authenticate(authenticators...))
+		if d.Admission != nil {
+			r.Use(exceptLongPolls(middleware.Admission(d.Admission, d.Config.AdmissionRetryAfter, admissionPriority(d.Config))))
+		}
+		// Requests are validated against the contract only once they have
+		// passed the scope check and rate limits, so that rejected callers
+		// cannot make the server parse and validate their bodies.
+		var validate []func(http.Handler) http.Handler
+		if d.Contract != nil {
+			validate = append(validate, middleware.Contract(d.Contract, middleware.ContractOptions{
+				MaxBodyBytes:      max(d.Config.MaxBodyBytes, d.Config.BatchMaxBodyBytes),
+				ValidateResponses: d.Config.ValidateResponses,
+			}, d.Logger))
+		}
+		limited := func(routeGroup string) []func(http.Handler) http.Handler {
+			return append(rateLimits(d, routeGroup), validate...)
+		}
 		// Rate limiting by route-group (keeps diagrams clean and matches “per route” policy)
-		r.With(middleware.RateLimit(d.Limiter, "post_relays")).
+		write := middleware.RequireScope(middleware.ScopeRelaysWrite)
+		read := middleware.RequireScope(middleware.ScopeRelaysRead)
+		r.With(write).With(limited("post_relays")...).
 			Post("/relays", h.CreateRelay)
-		r.With(middleware.RateLimit(d.Limiter, "get_relays")).
+		r.With(write, batchCost(d.Config.BatchMaxBodyBytes)).With(limited("post_relays")...).
+			Post("/relays:batch", h.CreateRelayBatch)
+		r.With(read).With(limited("get_relays")...).
 			Get("/relays", h.ListRelays)
-		r.With(middleware.RateLimit(d.Limiter, "get_relays")).
+		r.With(read).With(limited("get_relays")...).
+			Get("/relays:watch", h.WatchRelays)
+		r.With(read).With(limited("get_relays")...).
 			Get("/relays/{id}", h.GetRelay)
+		r.With(write).With(limited("post_relays")...).
+			Post("/relays/{id}:cancel", h.CancelRelay)
+		r.With(write).With(limited("post_relays")...).
+			Delete("/relays/{id}", h.DeleteRelay)
+		r.With(write).With(limited("post_relays")...).
+			Post("/relays/{id}:redeliver", h.RedeliverRelay)
+		r.With(write, h.replayCost).With(limited("post_relays")...).
+			Post("/relays:replay", h.ReplayRelays)
+		r.With(read).With(limited("get_relays")...).
+			Post("/transforms:preview", h.PreviewTransform)
+		r.With(write).With(limited("get_relays")...).
+			Get("/callback-secret", h.GetCallbackSecret)
+
+		sh := NewSubscriptionHandlers(d.Logger, d.Config, d.Subscriptions)
+		subsRead := middleware.RequireScope(middleware.ScopeSubscriptionsRead)
+		subsWrite := middleware.RequireScope(middleware.ScopeSubscriptionsWrite)
+		r.With(subsRead).With(limited("get_relays")...).
+			Get("/subscriptions", sh.ListSubscriptions)
+		r.With(subsWrite).With(limited("post_relays")...).
+			Post("/subscriptions", sh.CreateSubscription)
+		r.With(subsRead).With(limited("get_relays")...).
+			Get("/subscriptions/{id}", sh.GetSubscription)
+		r.With(subsWrite).With(limited("post_relays")...).
+			Delete("/subscriptions/{id}", sh.DeleteSubscription)
+
+		rh := NewRuleHandlers(d.Logger, d.Config, d.Rules)
+		r.With(subsRead).With(limited("get_relays")...).
+			Get("/rules", rh.ListRules)
+		r.With(subsWrite).With(limited("post_relays")...).
+			Post("/rules", rh.CreateRule)
+		r.With(subsRead).With(limited("get_relays")...).
+			Get("/rules/{id}", rh.GetRule)
+		r.With(subsWrite).With(limited("post_relays")...).
+			Delete("/rules/{id}", rh.DeleteRule)
+		r.With(subsRead).With(limited("get_relays")...).
+			Post("/rules:test", rh.TestRule)
+
+		eh := NewEventTypeHandlers(d.Logger, d.Config, d.EventTypes, h.schemas)
+		r.With(subsRead).With(limited("get_relays")...).
+			Get("/event-types", eh.ListEventTypes)
+		r.With(subsWrite).With(limited("post_relays")...).
+			Post("/event-types", eh.CreateEventType)
+		r.With(subsRead).With(limited("get_relays")...).
+			Get("/event-types/{name}", eh.GetEventType)
+		r.With(subsWrite).With(limited("post_relays")...).
+			Put("/event-types/{name}", eh.UpdateEventType)
+		r.With(subsWrite).With(limited("post_relays")...).
+			Delete("/event-types/{name}", eh.DeleteEventType)
+		r.With(subsRead).With(limited("get_relays")...).
+			Get("/event-types/{name}/versions", eh.ListEventTypeVersions)
+
+		qh := NewQueueHandlers(d.Logger, d.Config, d.Queues)
+		consume := middleware.RequireScope(middleware.ScopeQueuesConsume)
+		r.With(consume).With(limited("receive_messages")...).
+			Post("/queues/{name}:receive", qh.ReceiveMessages)
+		r.With(consume).With(limited("receive_messages")...).
+			Post("/queues/{name}:ack", qh.AckMessage)
+		r.With(consume).With(limited("receive_messages")...).
+			Post("/queues/{name}:nack", qh.NackMessage)
+
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(middleware.RequireScope(middleware.ScopeAdmin))
+			r.Use(validate...)
+			kh := NewKeyHandlers(d.Logger, d.Config, d.APIKeys)
+			r.Get("/keys", kh.ListKeys)
+			r.Post("/keys", kh.CreateKey)
+			r.Post("/keys/{id}:revoke", kh.RevokeKey)
+			r.Post("/keys/{id}:rotate", kh.RotateKey)
+			insp, _ := d.Limiter.(ratelimit.Inspector)
+			ah := NewAdminHandlers(d.Logger, d.Config, insp, d.Audit)
+			r.Get("/audit", ah.ListAuditEvents)
+			if insp != nil {
+				r.Get("/ratelimits", ah.GetRateLimits)
+				r.Post("/ratelimits:reset", ah.ResetRateLimit)
+				r.Post("/ratelimits:boost", ah.BoostRateLimit)
+			}
+		})
 	})
 
 	return &App{Router: r}
 }
+
+// rateLimits returns the limiter chain for a route group: the primary
+// limiter (enforced or shadowed), followed by the shadow limiter if one is
+// configured for the group.
+func rateLimits(d Dependencies, routeGroup string) []func(http.Handler) http.Handler {
+	var mode LimitMode
+	var shadowRPS float64
+	switch routeGroup {
+	case "post_relays":
+		mode, shadowRPS = d.Config.LimitPostMode, d.Config.ShadowPostRPS
+	default:
+		mode, shadowRPS = d.Config.LimitGetMode, d.Config.ShadowGetRPS
+	}
+
+	var mws []func(http.Handler) http.Handler
+	if mode == LimitModeShadow {
+		mws = append(mws, middleware.ShadowRateLimit(d.Limiter, routeGroup, d.Logger))
+	} else {
+		mws = append(mws, middleware.RateLimit(d.Limiter, routeGroup))
+	}
+	if d.ShadowLimiter != nil && shadowRPS > 0 {
+		mws = append(mws, middleware.ShadowRateLimit(d.ShadowLimiter, routeGroup, d.Logger))
+	}
+	return mws
+}
+
+// exceptLongPolls skips mw for watch streams and queue receives, which
+// may stay open for long and would hold an admission slot all the while.
+func exceptLongPolls(mw func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		wrapped := mw(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1/relays:watch" ||
+				strings.HasPrefix(r.URL.Path, "/v1/queues/") && strings.HasSuffix(r.URL.Path, ":receive") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			wrapped.ServeHTTP(w, r)
+		})
+	}
+}
+
+// admissionPriority favors reads and explicitly listed API keys when the
+// server is shedding load.
+func admissionPriority(cfg Config) func(*http.Request) bool {
+	return func(r *http.Request) bool {
+		if r.Method == http.MethodGet {
+			return true
+		}
+		p, _ := middleware.PrincipalFromContext(r.Context())
+		_, ok := cfg.AdmissionPriorityKeys[p.ID]
+		return ok
+	}
+}
+
+// seedAPIKeys hashes the configured plaintext keys into the key store. Their
+// IDs are derived from the hash, so they are stable across restarts.
+func seedAPIKeys(keys store.APIKeyStore, cfg Config, now time.Time) {
+	tenant := cfg.DefaultTenant
+	if tenant == "" {
+		tenant = "default"
+	}
+	seed := func(secret string, scopes []string) {
+		hash := store.HashAPIKey(secret)
+		keys.Put(&store.APIKey{
+			ID:        store.APIKeyIDFromHash(hash),
+			Name:      "env",
+			Tenant:    tenant,
+			Hash:      hash,
+			CreatedAt: now,
+			Scopes:    scopes,
+		})
+	}
+	for secret := range cfg.APIKeys {
+		if _, admin := cfg.AdminKeys[secret]; !admin {
+			seed(secret, []string{
+				middleware.ScopeRelaysRead, middleware.ScopeRelaysWrite,
+				middleware.ScopeSubscriptionsRead, middleware.ScopeSubscriptionsWrite,
+				middleware.ScopeQueuesConsume,
+			})
+		}
+	}
+	for secret := range cfg.AdminKeys {
+		seed(secret, []string{middleware.ScopeAdmin})
+	}
+}
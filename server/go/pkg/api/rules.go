@@ -0,0 +1,169 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/segolab/relay-ref/server/go/pkg/middleware"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+	"github.com/segolab/relay-ref/server/go/pkg/rules"
+	"github.com/segolab/relay-ref/server/go/pkg/store"
+)
+
+// maxRules bounds the rules of one tenant, all of which are evaluated
+// against each relay it creates.
+const maxRules = 100
+
+// RuleHandlers manage content-based routing rules under /v1/rules. Rules
+// are scoped to the caller's tenant.
+type RuleHandlers struct {
+	log   *slog.Logger
+	cfg   Config
+	rules store.RuleStore
+}
+
+func NewRuleHandlers(log *slog.Logger, cfg Config, rs store.RuleStore) *RuleHandlers {
+	return &RuleHandlers{log: log, cfg: cfg, rules: rs}
+}
+
+func (h *RuleHandlers) ListRules(w http.ResponseWriter, r *http.Request) {
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	_ = json.NewEncoder(w).Encode(model.ListRulesResponse{Items: h.rules.List(principal.Tenant)})
+}
+
+func (h *RuleHandlers) CreateRule(w http.ResponseWriter, r *http.Request) {
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.cfg.MaxBodyBytes)
+	var req model.CreateRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "invalid JSON", map[string]any{"err": err.Error()})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 128 {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "name is required and must be <= 128 characters", nil)
+		return
+	}
+	cond, err := rules.Compile(req.Condition)
+	if err != nil {
+		writeConditionError(w, r, err)
+		return
+	}
+	switch req.Action {
+	case model.RuleActionRoute:
+		if req.Destination == nil {
+			WriteError(w, r, http.StatusBadRequest, "invalid_request", "route rules require a destination", nil)
+			return
+		}
+		if err := validateDestination(*req.Destination); err != nil {
+			WriteError(w, r, http.StatusBadRequest, "invalid_request", err.Error(), nil)
+			return
+		}
+		if !principal.AllowsDestination(req.Destination.URL) {
+			WriteError(w, r, http.StatusForbidden, "forbidden", "destination host not permitted for this key", nil)
+			return
+		}
+	case model.RuleActionDrop:
+		if req.Destination != nil {
+			WriteError(w, r, http.StatusBadRequest, "invalid_request", "drop rules take no destination", nil)
+			return
+		}
+	default:
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "action must be route or drop", nil)
+		return
+	}
+
+	rule := &model.Rule{
+		ID:          uuid.New(),
+		Name:        req.Name,
+		Condition:   req.Condition,
+		Action:      req.Action,
+		Destination: req.Destination,
+		CreatedAt:   time.Now().UTC(),
+		Tenant:      principal.Tenant,
+	}
+	if err := h.rules.Create(rule, cond, maxRules); err != nil {
+		WriteError(w, r, http.StatusConflict, "conflict", "tenant has the maximum number of rules",
+			map[string]any{"maxRules": maxRules})
+		return
+	}
+	h.log.Info("rule created", "rule_id", rule.ID, "tenant", rule.Tenant, "action", rule.Action)
+
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(rule)
+}
+
+func (h *RuleHandlers) GetRule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := h.ownedRule(w, r)
+	if !ok {
+		return
+	}
+	_ = json.NewEncoder(w).Encode(rule)
+}
+
+func (h *RuleHandlers) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := h.ownedRule(w, r)
+	if !ok {
+		return
+	}
+	if err := h.rules.Delete(rule.ID); err != nil {
+		WriteError(w, r, http.StatusNotFound, "not_found", "rule not found", nil)
+		return
+	}
+	h.log.Info("rule deleted", "rule_id", rule.ID, "tenant", rule.Tenant)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *RuleHandlers) ownedRule(w http.ResponseWriter, r *http.Request) (*model.Rule, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "invalid rule id", nil)
+		return nil, false
+	}
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	rule, ok := h.rules.Get(id)
+	if !ok || rule.Tenant != principal.Tenant {
+		WriteError(w, r, http.StatusNotFound, "not_found", "rule not found", nil)
+		return nil, false
+	}
+	return rule, true
+}
+
+// TestRule evaluates a condition against a sample relay without storing
+// anything.
+func (h *RuleHandlers) TestRule(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.cfg.MaxBodyBytes)
+	var req model.TestRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "invalid JSON", map[string]any{"err": err.Error()})
+		return
+	}
+	expr, err := rules.Compile(req.Condition)
+	if err != nil {
+		writeConditionError(w, r, err)
+		return
+	}
+	env, err := rules.NewEnv(req.EventType, req.Metadata, req.Payload)
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "invalid payload", map[string]any{"err": err.Error()})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(model.TestRuleResponse{Matched: expr.Eval(env)})
+}
+
+func writeConditionError(w http.ResponseWriter, r *http.Request, err error) {
+	details := map[string]any{"err": err.Error()}
+	var se *rules.SyntaxError
+	if errors.As(err, &se) {
+		details["position"] = se.Pos
+	}
+	WriteError(w, r, http.StatusBadRequest, "invalid_condition", "condition is not a valid expression", details)
+}
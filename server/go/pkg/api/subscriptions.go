@@ -0,0 +1,162 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/segolab/relay-ref/server/go/pkg/middleware"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+	"github.com/segolab/relay-ref/server/go/pkg/store"
+)
+
+// maxSubscriptions bounds the subscriptions of one tenant, all of which are
+// matched against each relay it routes.
+const maxSubscriptions = 100
+
+// SubscriptionHandlers manage /v1/subscriptions. Subscriptions are scoped
+// to the caller's tenant like relays.
+type SubscriptionHandlers struct {
+	log  *slog.Logger
+	cfg  Config
+	subs store.SubscriptionStore
+}
+
+func NewSubscriptionHandlers(log *slog.Logger, cfg Config, subs store.SubscriptionStore) *SubscriptionHandlers {
+	return &SubscriptionHandlers{log: log, cfg: cfg, subs: subs}
+}
+
+func (h *SubscriptionHandlers) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	pageSize, offset, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	items, nextOffset := h.subs.List(principal.Tenant, pageSize, offset)
+	resp := model.ListSubscriptionsResponse{Items: items}
+	if nextOffset >= 0 {
+		resp.NextPageToken = store.EncodePageToken(nextOffset)
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (h *SubscriptionHandlers) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.cfg.MaxBodyBytes)
+	var req model.CreateSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "invalid JSON", map[string]any{"err": err.Error()})
+		return
+	}
+	if req.Match == "" {
+		req.Match = model.MatchExact
+	}
+	if err := validateSubscription(req); err != nil {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", err.Error(), nil)
+		return
+	}
+	if !allowsPattern(principal, req.EventType, req.Match) {
+		WriteError(w, r, http.StatusForbidden, "forbidden", "eventType pattern not permitted for this key",
+			map[string]any{"eventType": req.EventType})
+		return
+	}
+	if !principal.AllowsDestination(req.Destination.URL) {
+		WriteError(w, r, http.StatusForbidden, "forbidden", "destination host not permitted for this key", nil)
+		return
+	}
+
+	sub := &model.Subscription{
+		ID:          uuid.New(),
+		EventType:   req.EventType,
+		Match:       req.Match,
+		Metadata:    req.Metadata,
+		Destination: req.Destination,
+		CreatedAt:   time.Now().UTC(),
+		Tenant:      principal.Tenant,
+	}
+	if err := h.subs.Create(sub, maxSubscriptions); err != nil {
+		WriteError(w, r, http.StatusConflict, "conflict", "tenant has the maximum number of subscriptions",
+			map[string]any{"maxSubscriptions": maxSubscriptions})
+		return
+	}
+	h.log.Info("subscription created", "subscription_id", sub.ID, "tenant", sub.Tenant, "event_type", sub.EventType, "match", sub.Match)
+
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(sub)
+}
+
+func (h *SubscriptionHandlers) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.ownedSubscription(w, r)
+	if !ok {
+		return
+	}
+	_ = json.NewEncoder(w).Encode(sub)
+}
+
+func (h *SubscriptionHandlers) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.ownedSubscription(w, r)
+	if !ok {
+		return
+	}
+	if err := h.subs.Delete(sub.ID); err != nil {
+		WriteError(w, r, http.StatusNotFound, "not_found", "subscription not found", nil)
+		return
+	}
+	h.log.Info("subscription deleted", "subscription_id", sub.ID, "tenant", sub.Tenant)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *SubscriptionHandlers) ownedSubscription(w http.ResponseWriter, r *http.Request) (*model.Subscription, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "invalid subscription id", nil)
+		return nil, false
+	}
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	sub, ok := h.subs.Get(id)
+	if !ok || sub.Tenant != principal.Tenant {
+		WriteError(w, r, http.StatusNotFound, "not_found", "subscription not found", nil)
+		return nil, false
+	}
+	return sub, true
+}
+
+// allowsPattern reports whether every event type pattern can match is
+// allowed for principal: the part of the pattern that is fixed must start
+// with one of the key's event type prefixes. A glob's fixed part ends at
+// its first special character, so "*" is only allowed for unrestricted
+// keys.
+func allowsPattern(principal middleware.Principal, pattern string, match model.MatchType) bool {
+	if match == model.MatchGlob {
+		if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+			pattern = pattern[:i]
+		}
+	}
+	return principal.AllowsEventType(pattern)
+}
+
+func validateSubscription(req model.CreateSubscriptionRequest) error {
+	if strings.TrimSpace(req.EventType) == "" || len(req.EventType) > 128 {
+		return errf("eventType is required and must be <= 128 characters")
+	}
+	switch req.Match {
+	case model.MatchExact, model.MatchPrefix:
+	case model.MatchGlob:
+		if _, err := path.Match(req.EventType, ""); err != nil {
+			return errf("eventType is not a valid glob pattern")
+		}
+	default:
+		return errf("match must be one of exact, prefix, glob")
+	}
+	if len(req.Metadata) > 16 {
+		return errf("metadata filter must have at most 16 entries")
+	}
+	return validateDestination(req.Destination)
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	ClientAuthNone    = "none"
+	ClientAuthRequest = "request"
+	ClientAuthRequire = "require"
+)
+
+// NewTLSConfig builds the server TLS configuration. With a client CA bundle,
+// client certificates are verified against it: "request" verifies them when
+// presented, "require" rejects handshakes without one. Client certificate
+// auth without a server certificate is an error rather than plain HTTP.
+func NewTLSConfig(cfg Config) (*tls.Config, error) {
+	if cfg.TLSCertFile == "" {
+		return nil, fmt.Errorf("client auth %q requires a server certificate", cfg.TLSClientAuth)
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load server certificate: %w", err)
+	}
+	tc := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if cfg.TLSClientAuth == "" || cfg.TLSClientAuth == ClientAuthNone {
+		return tc, nil
+	}
+	if cfg.TLSClientCAFile == "" {
+		return nil, errors.New("client certificate auth requires a client CA bundle")
+	}
+	pemBytes, err := os.ReadFile(cfg.TLSClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read client CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemBytes) {
+		return nil, errors.New("client CA bundle contains no certificates")
+	}
+	tc.ClientCAs = pool
+
+	switch cfg.TLSClientAuth {
+	case ClientAuthRequest:
+		tc.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		tc.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown client auth mode %q", cfg.TLSClientAuth)
+	}
+	return tc, nil
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+	"github.com/segolab/relay-ref/server/go/pkg/transform"
+)
+
+// PreviewTransform renders a destination transform against a sample relay,
+// returning the body and headers a webhook would receive.
+func (h *Handlers) PreviewTransform(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.cfg.MaxBodyBytes)
+	var req model.PreviewTransformRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, http.StatusBadRequest, "invalid_request", "invalid JSON", map[string]any{"err": err.Error()})
+		return
+	}
+	tmpl, err := transform.Compile(&req.Transform)
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, "invalid_transform", "transform is not valid", map[string]any{"err": err.Error()})
+		return
+	}
+	sample := &model.Relay{
+		ID:        uuid.New(),
+		EventType: req.EventType,
+		Payload:   req.Payload,
+		Metadata:  req.Metadata,
+		CreatedAt: time.Now().UTC(),
+	}
+	out, err := tmpl.Render(sample)
+	if err != nil {
+		WriteError(w, r, http.StatusUnprocessableEntity, "render_failed", "transform failed to render the sample", map[string]any{"err": err.Error()})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(model.PreviewTransformResponse{Body: string(out.Body), Headers: out.Headers})
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segolab/relay-ref/server/go/pkg/middleware"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+)
+
+// knownStatuses are the values accepted by the watch status filter.
+var knownStatuses = []model.RelayStatus{
+	model.RelayStatusQueued, model.RelayStatusDelivered, model.RelayStatusFailed,
+	model.RelayStatusCancelled, model.RelayStatusScheduled, model.RelayStatusExpired,
+	model.RelayStatusDropped,
+}
+
+// WatchRelays streams the caller's relay status changes as Server-Sent
+// Events. Each event's id is the change's sequence number; a client that
+// reconnects with Last-Event-ID (or ?lastEventId=) resumes after it, as
+// long as the change is still in the tenant's bounded change log.
+// Otherwise, or if the ID is ahead of the log (e.g. after a restart), a
+// "truncated" event tells it to reconcile with GET /v1/relays first. Each
+// credential may hold at most Config.WatchMaxStreams streams.
+func (h *Handlers) WatchRelays(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	eventTypes := splitList(q["eventType"])
+	var statuses []model.RelayStatus
+	for _, s := range splitList(q["status"]) {
+		if !slices.Contains(knownStatuses, model.RelayStatus(s)) {
+			WriteError(w, r, http.StatusBadRequest, "invalid_request", "unknown status filter", map[string]any{"status": s})
+			return
+		}
+		statuses = append(statuses, model.RelayStatus(s))
+	}
+
+	changes := h.store.Changes()
+	after := changes.Last()
+	ahead := false
+	resume := r.Header.Get("Last-Event-ID")
+	if resume == "" {
+		resume = q.Get("lastEventId")
+	}
+	if resume != "" {
+		n, err := strconv.ParseUint(resume, 10, 64)
+		if err != nil {
+			WriteError(w, r, http.StatusBadRequest, "invalid_request", "invalid Last-Event-ID", nil)
+			return
+		}
+		// An ID ahead of the log names changes this server no longer
+		// has; resume from the current position.
+		if ahead = n > after; !ahead {
+			after = n
+		}
+	}
+
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	if !h.watchers.acquire(principal.ID, h.watchMaxStreams()) {
+		WriteError(w, r, http.StatusTooManyRequests, "too_many_streams", "too many open watch streams for this credential",
+			map[string]any{"maxStreams": h.watchMaxStreams()})
+		return
+	}
+	defer h.watchers.release(principal.ID)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		WriteError(w, r, http.StatusInternalServerError, "internal", "streaming unsupported", nil)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": watching\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(h.watchHeartbeat())
+	defer heartbeat.Stop()
+	for {
+		batch, truncated, wake := changes.Since(principal.Tenant, after)
+		if truncated || ahead {
+			ahead = false
+			fmt.Fprintf(w, "event: truncated\ndata: {\"after\":%d}\n\n", after)
+		}
+		for _, c := range batch {
+			after = c.Seq
+			if (len(eventTypes) > 0 && !slices.Contains(eventTypes, c.EventType)) ||
+				(len(statuses) > 0 && !slices.Contains(statuses, c.Status)) {
+				continue
+			}
+			data, _ := json.Marshal(c)
+			fmt.Fprintf(w, "id: %d\nevent: status\ndata: %s\n\n", c.Seq, data)
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-wake:
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		}
+	}
+}
+
+func (h *Handlers) watchMaxStreams() int {
+	if h.cfg.WatchMaxStreams > 0 {
+		return h.cfg.WatchMaxStreams
+	}
+	return 10
+}
+
+// streamCounter counts open watch streams per credential.
+type streamCounter struct {
+	mu    sync.Mutex
+	count map[string]int
+}
+
+func (c *streamCounter) acquire(id string, max int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.count == nil {
+		c.count = make(map[string]int)
+	}
+	if c.count[id] >= max {
+		return false
+	}
+	c.count[id]++
+	return true
+}
+
+func (c *streamCounter) release(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.count[id]--; c.count[id] <= 0 {
+		delete(c.count, id)
+	}
+}
+
+func (h *Handlers) watchHeartbeat() time.Duration {
+	if h.cfg.WatchHeartbeat > 0 {
+		return h.cfg.WatchHeartbeat
+	}
+	return 15 * time.Second
+}
+
+// splitList flattens repeated and comma-separated query values.
+func splitList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,190 @@
+package audit
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Event types recorded by the server.
+const (
+	TypeAuthFailure         = "auth.failure"
+	TypeAuthzDenied         = "authz.denied"
+	TypeKeyCreated          = "key.created"
+	TypeKeyRevoked          = "key.revoked"
+	TypeKeyRotated          = "key.rotated"
+	TypeRateLimitReset      = "admin.ratelimit_reset"
+	TypeRateLimitBoost      = "admin.ratelimit_boost"
+	TypeIdempotencyConflict = "idempotency.conflict"
+	TypeRateLimitDenied     = "ratelimit.denied"
+	TypeRelayCancelled      = "relay.cancelled"
+	TypeRelayDeleted        = "relay.deleted"
+	TypeRelayRedelivered    = "relay.redelivered"
+	TypeRelaysReplayed      = "relay.replayed"
+)
+
+// Event is one security-relevant occurrence. PrevHash and Hash are only set
+// by sinks that chain records (see FileSink).
+type Event struct {
+	Time      time.Time      `json:"time"`
+	Type      string         `json:"type"`
+	Tenant    string         `json:"tenant,omitempty"`
+	Actor     string         `json:"actor,omitempty"`
+	RequestID string         `json:"requestId,omitempty"`
+	SourceIP  string         `json:"sourceIp,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+	PrevHash  string         `json:"prevHash,omitempty"`
+	Hash      string         `json:"hash,omitempty"`
+}
+
+// Sink persists events.
+type Sink interface {
+	Write(e Event) error
+}
+
+// Filter narrows Recent. Zero fields match everything.
+type Filter struct {
+	Type   string
+	Tenant string
+	Since  time.Time
+}
+
+func (f Filter) match(e Event) bool {
+	if f.Type != "" && e.Type != f.Type {
+		return false
+	}
+	if f.Tenant != "" && e.Tenant != f.Tenant {
+		return false
+	}
+	return f.Since.IsZero() || !e.Time.Before(f.Since)
+}
+
+// Log fans events out to its sinks and keeps a bounded in-memory window of
+// recent events for querying. Sinks are written by a single goroutine, in
+// record order, from a queue of the same size as the window; Record only
+// blocks while that queue is full. Sink failures are logged, never
+// returned, so auditing cannot fail a request.
+type Log struct {
+	log   *slog.Logger
+	sinks []Sink
+
+	mu     sync.Mutex
+	recent []Event
+	next   int
+	full   bool
+
+	// closing guards queue against sends after Close.
+	closing sync.RWMutex
+	closed  bool
+	queue   chan queued
+	done    chan struct{}
+}
+
+// queued is an event for the sinks, or a flush marker when flushed is set.
+type queued struct {
+	e       Event
+	flushed chan struct{}
+}
+
+func NewLog(logger *slog.Logger, size int, sinks ...Sink) *Log {
+	if size < 1 {
+		size = 1000
+	}
+	l := &Log{
+		log:    logger,
+		sinks:  sinks,
+		recent: make([]Event, size),
+		queue:  make(chan queued, size),
+		done:   make(chan struct{}),
+	}
+	if len(sinks) > 0 {
+		go l.write()
+	} else {
+		close(l.done)
+	}
+	return l
+}
+
+func (l *Log) Record(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	l.mu.Lock()
+	l.recent[l.next] = e
+	l.next = (l.next + 1) % len(l.recent)
+	if l.next == 0 {
+		l.full = true
+	}
+	l.mu.Unlock()
+
+	if len(l.sinks) == 0 {
+		return
+	}
+	l.closing.RLock()
+	defer l.closing.RUnlock()
+	if l.closed {
+		l.log.Error("audit event recorded after close", "type", e.Type)
+		return
+	}
+	l.queue <- queued{e: e}
+}
+
+// Flush waits until every event recorded so far has been written.
+func (l *Log) Flush() {
+	l.closing.RLock()
+	if l.closed || len(l.sinks) == 0 {
+		l.closing.RUnlock()
+		return
+	}
+	flushed := make(chan struct{})
+	l.queue <- queued{flushed: flushed}
+	l.closing.RUnlock()
+	<-flushed
+}
+
+// Close writes the queued events and stops the writer. Later events only
+// reach the in-memory window.
+func (l *Log) Close() {
+	l.closing.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.queue)
+	}
+	l.closing.Unlock()
+	<-l.done
+}
+
+func (l *Log) write() {
+	defer close(l.done)
+	for q := range l.queue {
+		if q.flushed != nil {
+			close(q.flushed)
+			continue
+		}
+		for _, s := range l.sinks {
+			if err := s.Write(q.e); err != nil {
+				l.log.Error("audit sink write failed", "type", q.e.Type, "err", err)
+			}
+		}
+	}
+}
+
+// Recent returns up to limit matching events, newest first.
+func (l *Log) Recent(f Filter, limit int) []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := l.next
+	if l.full {
+		n = len(l.recent)
+	}
+	out := []Event{}
+	for i := 1; i <= n && len(out) < limit; i++ {
+		e := l.recent[(l.next-i+len(l.recent))%len(l.recent)]
+		if f.match(e) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
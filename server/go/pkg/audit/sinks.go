@@ -0,0 +1,155 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// WriterSink writes one JSON object per line, e.g. to stdout.
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+func (s *WriterSink) Write(e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return json.NewEncoder(s.w).Encode(e)
+}
+
+// FileSink appends hash-chained JSON lines. Each record's Hash is the
+// SHA-256 of the record serialized with Hash empty and PrevHash set to the
+// previous record's Hash, so editing, removing or reordering lines breaks
+// the chain (see VerifyChain). The chain resumes across restarts; a last
+// line left incomplete by a crash is truncated first.
+type FileSink struct {
+	mu   sync.Mutex
+	f    *os.File
+	prev string
+}
+
+func OpenFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	prev, err := resumeChain(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("read audit chain: %w", err)
+	}
+	return &FileSink{f: f, prev: prev}, nil
+}
+
+func (s *FileSink) Write(e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e.PrevHash = s.prev
+	hash, err := chainHash(e)
+	if err != nil {
+		return err
+	}
+	e.Hash = hash
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := s.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	s.prev = hash
+	return nil
+}
+
+func (s *FileSink) Close() error {
+	return s.f.Close()
+}
+
+var ErrChainBroken = errors.New("audit chain broken")
+
+// VerifyChain checks every record read from r and returns the number of
+// valid records before the first inconsistency.
+func VerifyChain(r io.Reader) (int, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	prev := ""
+	n := 0
+	for sc.Scan() {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return n, fmt.Errorf("%w: record %d: %v", ErrChainBroken, n+1, err)
+		}
+		if e.PrevHash != prev {
+			return n, fmt.Errorf("%w: record %d: prevHash mismatch", ErrChainBroken, n+1)
+		}
+		want, err := chainHash(e)
+		if err != nil {
+			return n, err
+		}
+		if e.Hash != want {
+			return n, fmt.Errorf("%w: record %d: hash mismatch", ErrChainBroken, n+1)
+		}
+		prev = e.Hash
+		n++
+	}
+	return n, sc.Err()
+}
+
+func chainHash(e Event) (string, error) {
+	e.Hash = ""
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// resumeChain returns the hash of the last record in f. An unterminated
+// last line can only be a write cut short, so it is truncated away.
+func resumeChain(f *os.File) (string, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	r := bufio.NewReader(f)
+	var offset int64
+	last := ""
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				return last, f.Truncate(offset)
+			}
+			return last, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		offset += int64(len(line))
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			return "", err
+		}
+		last = e.Hash
+	}
+}
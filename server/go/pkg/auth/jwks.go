@@ -0,0 +1,283 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JSONWebKey is the subset of RFC 7517 fields needed for signature keys.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC / OKP
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+var (
+	ErrUnknownKey = errors.New("unknown signing key")
+	// ErrKeyAlgMismatch means a key restricted by its "alg" member was
+	// used with a token of another algorithm.
+	ErrKeyAlgMismatch = errors.New("token alg does not match key")
+	// errUnsupportedKey marks keys of a type or curve this package does
+	// not verify; they are skipped when loading a set.
+	errUnsupportedKey = errors.New("unsupported key")
+)
+
+// JWKS serves public keys from a JWKS document loaded from a local file or
+// an http(s) URL. Keys are cached for refresh; an unknown kid triggers an
+// early reload (at most once per MinReloadInterval) so rotated keys are
+// picked up. Concurrent callers share one fetch, which runs without
+// holding the cache lock. Keys of unsupported types or curves are skipped.
+type JWKS struct {
+	source  string
+	client  *http.Client
+	refresh time.Duration
+	// MinReloadInterval bounds how often unknown kids cause a reload.
+	MinReloadInterval time.Duration
+
+	mu       sync.Mutex
+	keys     map[string]jwk
+	loadedAt time.Time
+	// loading is closed when the fetch in flight, if any, completes;
+	// loadErr is its outcome.
+	loading chan struct{}
+	loadErr error
+}
+
+type jwk struct {
+	pub crypto.PublicKey
+	alg string
+}
+
+func NewJWKS(source string, refresh time.Duration, client *http.Client) *JWKS {
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	if refresh <= 0 {
+		refresh = 5 * time.Minute
+	}
+	return &JWKS{
+		source:            source,
+		client:            client,
+		refresh:           refresh,
+		MinReloadInterval: 10 * time.Second,
+	}
+}
+
+// Key returns the public key for kid, checking the key's "alg" member, if
+// any, against the token's alg.
+func (j *JWKS) Key(ctx context.Context, kid, alg string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	seen := j.loadedAt
+	stale := j.keys == nil || time.Since(seen) > j.refresh
+	j.mu.Unlock()
+	if stale {
+		if err := j.reload(ctx, seen); err != nil && !j.loaded() {
+			return nil, err
+		}
+	}
+	k, ok, seen, reload := j.lookup(kid)
+	if !ok && reload {
+		if err := j.reload(ctx, seen); err != nil {
+			return nil, err
+		}
+		k, ok, _, _ = j.lookup(kid)
+	}
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if k.alg != "" && k.alg != alg {
+		return nil, ErrKeyAlgMismatch
+	}
+	return k.pub, nil
+}
+
+// lookup returns the cached key for kid, when the cache was loaded and,
+// if the key is missing, whether an early reload is allowed.
+func (j *JWKS) lookup(kid string) (jwk, bool, time.Time, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	k, ok := j.keys[kid]
+	return k, ok, j.loadedAt, !ok && time.Since(j.loadedAt) >= j.MinReloadInterval
+}
+
+func (j *JWKS) loaded() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.keys != nil
+}
+
+// reload replaces the cached keys loaded at seen, or joins the reload
+// already in flight; if another reload has finished since seen it returns
+// that reload's outcome. On failure the previous keys are kept. The fetch
+// is detached from ctx so that one cancelled request does not fail the
+// others waiting on it.
+func (j *JWKS) reload(ctx context.Context, seen time.Time) error {
+	j.mu.Lock()
+	if j.loading == nil && j.loadedAt.After(seen) {
+		defer j.mu.Unlock()
+		return j.loadErr
+	}
+	if done := j.loading; done != nil {
+		j.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		return j.loadErr
+	}
+	done := make(chan struct{})
+	j.loading = done
+	j.loadedAt = time.Now()
+	j.mu.Unlock()
+
+	keys, err := j.load(context.WithoutCancel(ctx))
+
+	j.mu.Lock()
+	if err == nil {
+		j.keys = keys
+	}
+	j.loadErr = err
+	j.loading = nil
+	j.mu.Unlock()
+	close(done)
+	return err
+}
+
+// load fetches and parses the key set.
+func (j *JWKS) load(ctx context.Context) (map[string]jwk, error) {
+	raw, err := j.fetch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load jwks: %w", err)
+	}
+	var set JSONWebKeySet
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("parse jwks: %w", err)
+	}
+
+	keys := make(map[string]jwk, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.PublicKey()
+		if errors.Is(err, errUnsupportedKey) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse jwk %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = jwk{pub: pub, alg: k.Alg}
+	}
+	return keys, nil
+}
+
+func (j *JWKS) fetch(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(j.source, "http://") && !strings.HasPrefix(j.source, "https://") {
+		return os.ReadFile(j.source)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// PublicKey decodes the key material.
+func (k JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("%w: curve %q", errUnsupportedKey, k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("%w: curve %q", errUnsupportedKey, k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("%w: type %q", errUnsupportedKey, k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,82 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+)
+
+// CallbackSender POSTs a StatusCallback to a finished relay's callback URL.
+// Requests carry X-Relay-Signature: t=<unix seconds>,v1=<hex HMAC-SHA256 of
+// "<t>.<body>" keyed with the relay tenant's secret>, so producers can
+// verify them. Tenant secrets are derived from Secret by TenantSecret; one
+// tenant cannot sign callbacks another tenant would accept.
+type CallbackSender struct {
+	Client *http.Client
+	Secret string
+}
+
+func (s CallbackSender) Send(ctx context.Context, r *model.Relay) error {
+	body, err := json.Marshal(model.StatusCallback{
+		RelayID:       r.ID,
+		EventType:     r.EventType,
+		Status:        r.Status,
+		FailureReason: r.FailureReason,
+		DeliveredAt:   r.DeliveredAt,
+		Deliveries:    r.Deliveries,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Relay-Id", r.ID.String())
+	req.Header.Set("X-Relay-Signature", "t="+strconv.FormatInt(ts, 10)+",v1="+SignCallback(TenantSecret(s.Secret, r.Tenant), ts, body))
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("callback responded %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SignCallback returns the hex v1 signature of a callback body sent at ts.
+func SignCallback(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// TenantSecret returns the callback signing secret of tenant: the hex
+// HMAC-SHA256 of the tenant name keyed with the server's secret.
+func TenantSecret(secret, tenant string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("callback:"))
+	mac.Write([]byte(tenant))
+	return hex.EncodeToString(mac.Sum(nil))
+}
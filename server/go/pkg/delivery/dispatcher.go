@@ -0,0 +1,193 @@
+package delivery
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/segolab/relay-ref/server/go/pkg/metrics"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+	"github.com/segolab/relay-ref/server/go/pkg/store"
+)
+
+// Dispatcher attempts the pending deliveries of queued relays. Each
+// destination of a relay is retried on its own schedule, with exponential
+// backoff, until it succeeds or MaxAttempts is reached.
+type Dispatcher struct {
+	Log    *slog.Logger
+	Store  store.RelayStore
+	Sender Sender
+
+	Interval    time.Duration
+	Concurrency int
+	// Timeout bounds a single attempt; claims are leased for twice as long
+	// so a stuck attempt is eventually retried.
+	Timeout     time.Duration
+	MaxAttempts int
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// OrderingPolicy applies to relays with an ordering key; under
+	// model.OrderingBlock they are retried past MaxAttempts. Under
+	// model.OrderingSkip a relay that runs out of attempts is also sent
+	// through Sender to the tenant's queue named OrderingDeadLetterQueue,
+	// if set.
+	OrderingPolicy          model.OrderingPolicy
+	OrderingDeadLetterQueue string
+
+	// Callbacks, if set, sends the status callbacks of finished relays.
+	// They are retried under their own policy.
+	Callbacks           *CallbackSender
+	CallbackMaxAttempts int
+	CallbackBackoffBase time.Duration
+	CallbackBackoffMax  time.Duration
+}
+
+// Run polls until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	t := time.NewTicker(d.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			d.Tick(ctx, now.UTC())
+		}
+	}
+}
+
+// Tick claims up to Concurrency due deliveries and callbacks, attempts them
+// in parallel and waits for the results. A quarter of the slots (at least
+// one) is reserved for callbacks so that they are not starved by a steady
+// flow of deliveries; slots either side leaves unused go to the other. It
+// returns the number of attempts made.
+func (d *Dispatcher) Tick(ctx context.Context, now time.Time) int {
+	var callbacks []*model.Relay
+	if d.Callbacks != nil {
+		callbacks = d.Store.ClaimCallbacks(now, 2*d.Timeout, d.callbackReserve())
+	}
+	tasks := d.Store.ClaimDeliveries(now, 2*d.Timeout, d.Concurrency-len(callbacks))
+	if d.Callbacks != nil && len(callbacks)+len(tasks) < d.Concurrency {
+		callbacks = append(callbacks, d.Store.ClaimCallbacks(now, 2*d.Timeout, d.Concurrency-len(callbacks)-len(tasks))...)
+	}
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		wg.Add(1)
+		go func(task store.DeliveryTask) {
+			defer wg.Done()
+			d.attempt(ctx, task)
+		}(task)
+	}
+	for _, relay := range callbacks {
+		wg.Add(1)
+		go func(relay *model.Relay) {
+			defer wg.Done()
+			d.callback(ctx, relay)
+		}(relay)
+	}
+	wg.Wait()
+	return len(tasks) + len(callbacks)
+}
+
+// callbackReserve is the number of slots per tick claimed for callbacks
+// before deliveries.
+func (d *Dispatcher) callbackReserve() int {
+	return min(d.Concurrency, max(1, d.Concurrency/4))
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, task store.DeliveryTask) {
+	delivery := task.Relay.Deliveries[task.Index]
+	actx, cancel := context.WithTimeout(ctx, d.Timeout)
+	err := d.Sender.Send(actx, task.Relay, delivery)
+	cancel()
+
+	now := time.Now().UTC()
+	var retryAt *time.Time
+	outcome := "delivered"
+	if err != nil {
+		outcome = "failed"
+		blocking := task.Relay.OrderingKey != "" && d.OrderingPolicy == model.OrderingBlock
+		if blocking || delivery.Attempts+1 < d.MaxAttempts {
+			at := now.Add(backoff(d.BackoffBase, d.BackoffMax, delivery.Attempts+1))
+			retryAt = &at
+			outcome = "retry"
+		}
+	}
+	metrics.DeliveryAttempts.Add(outcome, 1)
+	if outcome == "failed" && task.Relay.OrderingKey != "" && d.OrderingDeadLetterQueue != "" {
+		// Dead-letter before completing, which lets the next relay go.
+		d.deadLetter(ctx, task.Relay, delivery)
+	}
+
+	relay, cerr := d.Store.CompleteDelivery(task.Relay.ID, task.Index, now, err, retryAt)
+	if cerr != nil {
+		d.Log.Error("record delivery failed", "relay_id", task.Relay.ID, "destination", task.Index, "err", cerr)
+		return
+	}
+	log := d.Log.With("relay_id", relay.ID, "tenant", relay.Tenant, "url", delivery.Destination.URL,
+		"attempt", delivery.Attempts+1, "outcome", outcome)
+	if err != nil {
+		log.Warn("delivery attempt failed", "err", err, "retry_at", retryAt)
+		return
+	}
+	log.Info("delivery attempt succeeded")
+}
+
+// deadLetter sends an ordered delivery that ran out of attempts to the
+// tenant's dead-letter queue.
+func (d *Dispatcher) deadLetter(ctx context.Context, relay *model.Relay, failed model.Delivery) {
+	dl := model.Delivery{Destination: model.Destination{
+		Type: model.DestinationQueue,
+		URL:  "queue:" + d.OrderingDeadLetterQueue,
+	}}
+	actx, cancel := context.WithTimeout(ctx, d.Timeout)
+	err := d.Sender.Send(actx, relay, dl)
+	cancel()
+	if err != nil {
+		d.Log.Error("dead-letter ordered relay failed", "relay_id", relay.ID, "tenant", relay.Tenant,
+			"url", failed.Destination.URL, "queue", d.OrderingDeadLetterQueue, "err", err)
+	}
+}
+
+func (d *Dispatcher) callback(ctx context.Context, relay *model.Relay) {
+	cb := relay.Callback
+	actx, cancel := context.WithTimeout(ctx, d.Timeout)
+	err := d.Callbacks.Send(actx, relay)
+	cancel()
+
+	now := time.Now().UTC()
+	var retryAt *time.Time
+	outcome := "delivered"
+	if err != nil {
+		outcome = "failed"
+		if cb.Attempts+1 < d.CallbackMaxAttempts {
+			at := now.Add(backoff(d.CallbackBackoffBase, d.CallbackBackoffMax, cb.Attempts+1))
+			retryAt = &at
+			outcome = "retry"
+		}
+	}
+	metrics.CallbackAttempts.Add(outcome, 1)
+
+	if _, cerr := d.Store.CompleteCallback(relay.ID, now, err, retryAt); cerr != nil {
+		d.Log.Error("record callback failed", "relay_id", relay.ID, "err", cerr)
+		return
+	}
+	log := d.Log.With("relay_id", relay.ID, "tenant", relay.Tenant, "url", relay.CallbackURL,
+		"attempt", cb.Attempts+1, "outcome", outcome)
+	if err != nil {
+		log.Warn("callback attempt failed", "err", err, "retry_at", retryAt)
+		return
+	}
+	log.Info("callback attempt succeeded")
+}
+
+// backoff returns the delay before retry n (n >= 1): base doubled per
+// attempt, capped at max.
+func backoff(base, max time.Duration, n int) time.Duration {
+	delay := base
+	for i := 1; i < n && delay < max; i++ {
+		delay *= 2
+	}
+	return min(delay, max)
+}
@@ -0,0 +1,97 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+	"github.com/segolab/relay-ref/server/go/pkg/transform"
+)
+
+// Driver delivers relays to one destination type.
+type Driver interface {
+	Sender
+	// Validate checks a destination of the driver's type when it is
+	// configured, before any relay is sent to it.
+	Validate(d model.Destination) error
+}
+
+// Drivers dispatches each delivery to the driver registered for its
+// destination type. It is the Sender used by the Dispatcher.
+type Drivers map[string]Driver
+
+func (ds Drivers) Send(ctx context.Context, r *model.Relay, d model.Delivery) error {
+	driver, ok := ds[d.Destination.Type]
+	if !ok {
+		return fmt.Errorf("no driver for destination type %q", d.Destination.Type)
+	}
+	return driver.Send(ctx, r, d)
+}
+
+// Validate checks d with the driver registered for its type.
+func (ds Drivers) Validate(d model.Destination) error {
+	driver, ok := ds[d.Type]
+	if !ok {
+		return fmt.Errorf("destination.type must be one of webhook, file, queue")
+	}
+	return driver.Validate(d)
+}
+
+// builtins holds a driver of each built-in type for ValidateDestination.
+// Their Validate methods do not depend on configuration.
+var builtins = Drivers{
+	model.DestinationWebhook: WebhookSender{},
+	model.DestinationFile:    &FileSink{},
+	model.DestinationQueue:   &Queues{},
+}
+
+// ValidateDestination checks a destination against the built-in drivers,
+// so it does not depend on which drivers a server has configured.
+func ValidateDestination(d model.Destination) error {
+	return builtins.Validate(d)
+}
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// localName returns the name in a "file:<name>" or "queue:<name>" URL.
+func localName(d model.Destination) (string, error) {
+	u, err := url.Parse(d.URL)
+	if err != nil || u.Scheme != d.Type || u.Opaque == "" {
+		return "", fmt.Errorf("destination.url must be %s:<name>", d.Type)
+	}
+	if !namePattern.MatchString(u.Opaque) {
+		return "", fmt.Errorf("destination name must be 1-64 letters, digits, '.', '_' or '-'")
+	}
+	return u.Opaque, nil
+}
+
+// message renders a delivery as the record written by local drivers.
+func message(r *model.Relay, d model.Delivery) (model.QueueMessage, error) {
+	out, err := transform.Apply(d.Destination.Transform, r)
+	if err != nil {
+		return model.QueueMessage{}, fmt.Errorf("transform: %w", err)
+	}
+	body := json.RawMessage(out.Body)
+	if !json.Valid(body) {
+		body, _ = json.Marshal(string(out.Body))
+	}
+	msg := model.QueueMessage{
+		ID:         uuid.New(),
+		RelayID:    r.ID,
+		EventType:  r.EventType,
+		Metadata:   r.Metadata,
+		Body:       body,
+		Attempt:    d.Attempts + 1,
+		EnqueuedAt: time.Now().UTC(),
+	}
+	if len(out.Headers) > 0 {
+		msg.Headers = out.Headers
+	}
+	return msg, nil
+}
@@ -0,0 +1,80 @@
+package delivery
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+)
+
+// FileSink appends relays as NDJSON lines to Dir/<tenant>/<name>.ndjson,
+// where <tenant> is the tenant if it is a valid destination name and a hash
+// of it otherwise. Each line is a model.QueueMessage. A retried attempt may append the same
+// relay again; consumers should dedupe on relayId.
+type FileSink struct {
+	Dir string
+
+	mu sync.Mutex
+}
+
+func NewFileSink(dir string) *FileSink {
+	return &FileSink{Dir: dir}
+}
+
+func (s *FileSink) Validate(d model.Destination) error {
+	_, err := localName(d)
+	return err
+}
+
+func (s *FileSink) Send(_ context.Context, r *model.Relay, d model.Delivery) error {
+	name, err := localName(d.Destination)
+	if err != nil {
+		return err
+	}
+	msg, err := message(r, d)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	dir := filepath.Join(s.Dir, tenantDir(r.Tenant))
+	path := filepath.Join(dir, name+".ndjson")
+	if rel, err := filepath.Rel(s.Dir, path); err != nil || !filepath.IsLocal(rel) {
+		return fmt.Errorf("file destination %q escapes the sink directory", path)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// tenantDir names a tenant's directory. Tenants that are not valid
+// destination names, such as "..", are hashed; the "_" prefix cannot start
+// a valid name, so the two never collide.
+func tenantDir(tenant string) string {
+	if namePattern.MatchString(tenant) {
+		return tenant
+	}
+	sum := sha256.Sum256([]byte(tenant))
+	return "_" + hex.EncodeToString(sum[:16])
+}
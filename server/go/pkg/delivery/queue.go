@@ -0,0 +1,258 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+)
+
+var (
+	// ErrQueueFull is returned by Send when a queue holds MaxDepth
+	// messages. The dispatcher retries the delivery later.
+	ErrQueueFull = errors.New("queue is full")
+	// ErrReceiptNotFound means a receipt handle does not name a message
+	// still held by its lease: the message was acked, or its lease expired
+	// and it was received again.
+	ErrReceiptNotFound = errors.New("receipt not found")
+)
+
+// Queues is an in-process driver holding named queues per tenant. A relay
+// counts as delivered once it is in the queue. Consumers lease messages
+// with Receive and settle them with Ack or Nack; a lease that expires
+// makes the message visible again. A message received MaxReceives times
+// moves to the queue's dead-letter queue instead of being leased again.
+type Queues struct {
+	// MaxDepth bounds each queue, leased messages included; zero means
+	// 10000.
+	MaxDepth int
+	// MaxReceives bounds the leases of a message; zero means 10.
+	MaxReceives int
+
+	mu sync.Mutex
+	m  map[string][]*queueEntry
+	// wake holds, per queue, a channel closed when a message may have
+	// become visible, to release that queue's long-polling receivers.
+	wake map[string]chan struct{}
+}
+
+type queueEntry struct {
+	msg       model.QueueMessage
+	visibleAt time.Time
+}
+
+func NewQueues(maxDepth int) *Queues {
+	return &Queues{MaxDepth: maxDepth, m: make(map[string][]*queueEntry), wake: make(map[string]chan struct{})}
+}
+
+func (q *Queues) Validate(d model.Destination) error {
+	_, err := localName(d)
+	return err
+}
+
+func (q *Queues) Send(_ context.Context, r *model.Relay, d model.Delivery) error {
+	name, err := localName(d.Destination)
+	if err != nil {
+		return err
+	}
+	msg, err := message(r, d)
+	if err != nil {
+		return err
+	}
+	k := queueKey(r.Tenant, name)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.m[k]) >= q.maxDepth() {
+		return ErrQueueFull
+	}
+	q.m[k] = append(q.m[k], &queueEntry{msg: msg, visibleAt: msg.EnqueuedAt})
+	q.notify(k)
+	return nil
+}
+
+// Receive leases up to max visible messages from a tenant's queue in
+// enqueue order, hiding them for visibility. If none are visible it waits
+// up to wait for one, or until ctx is done.
+func (q *Queues) Receive(ctx context.Context, tenant, name string, max int, visibility, wait time.Duration) []model.QueueMessage {
+	return q.receive(ctx, queueKey(tenant, name), max, visibility, wait)
+}
+
+// ReceiveDeadLetters is Receive for the dead-letter queue of a queue.
+// Dead letters are never dead-lettered again.
+func (q *Queues) ReceiveDeadLetters(ctx context.Context, tenant, name string, max int, visibility, wait time.Duration) []model.QueueMessage {
+	return q.receive(ctx, deadLetterKey(queueKey(tenant, name)), max, visibility, wait)
+}
+
+func (q *Queues) receive(ctx context.Context, k string, max int, visibility, wait time.Duration) []model.QueueMessage {
+	deadline := time.Now().Add(wait)
+	for {
+		now := time.Now().UTC()
+		msgs, next, wake := q.lease(k, max, visibility, now)
+		remaining := deadline.Sub(now)
+		if len(msgs) > 0 || remaining <= 0 {
+			return msgs
+		}
+		// Wake on a new message, an expiring lease or the deadline.
+		if !next.IsZero() && next.Sub(now) < remaining {
+			remaining = next.Sub(now)
+		}
+		timer := time.NewTimer(remaining)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return msgs
+		case <-wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// lease takes visible messages and reports when the next leased message
+// becomes visible again. Visible messages that were already received
+// MaxReceives times move to the dead-letter queue while it has room.
+func (q *Queues) lease(k string, max int, visibility time.Duration, now time.Time) ([]model.QueueMessage, time.Time, chan struct{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := []model.QueueMessage{}
+	var next time.Time
+	kept := q.m[k][:0]
+	for _, e := range q.m[k] {
+		if e.visibleAt.After(now) {
+			if next.IsZero() || e.visibleAt.Before(next) {
+				next = e.visibleAt
+			}
+			kept = append(kept, e)
+			continue
+		}
+		if e.msg.ReceiveCount >= q.maxReceives() && !isDeadLetterKey(k) {
+			if dk := deadLetterKey(k); len(q.m[dk]) < q.maxDepth() {
+				e.msg.ReceiptHandle = ""
+				q.m[dk] = append(q.m[dk], e)
+				q.notify(dk)
+				continue
+			}
+			kept = append(kept, e)
+			continue
+		}
+		kept = append(kept, e)
+		if len(out) == max {
+			continue
+		}
+		e.visibleAt = now.Add(visibility)
+		e.msg.ReceiptHandle = uuid.NewString()
+		e.msg.ReceiveCount++
+		out = append(out, e.msg)
+	}
+	clear(q.m[k][len(kept):])
+	q.m[k] = kept
+	if len(kept) == 0 {
+		delete(q.m, k)
+	}
+	return out, next, q.waker(k)
+}
+
+// Ack deletes a leased message, from the queue or its dead-letter queue.
+func (q *Queues) Ack(tenant, name, receipt string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	k, i, ok := q.find(queueKey(tenant, name), receipt)
+	if !ok {
+		return ErrReceiptNotFound
+	}
+	q.m[k] = append(q.m[k][:i], q.m[k][i+1:]...)
+	if len(q.m[k]) == 0 {
+		delete(q.m, k)
+	}
+	return nil
+}
+
+// Nack releases a leased message, making it visible again after delay.
+func (q *Queues) Nack(tenant, name, receipt string, delay time.Duration) error {
+	now := time.Now().UTC()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	k, i, ok := q.find(queueKey(tenant, name), receipt)
+	if !ok {
+		return ErrReceiptNotFound
+	}
+	e := q.m[k][i]
+	e.msg.ReceiptHandle = ""
+	e.visibleAt = now.Add(delay)
+	// Waiting receivers may be sleeping until a later lease expiry.
+	q.notify(k)
+	return nil
+}
+
+// find locates the message leased under receipt in queue k or its
+// dead-letter queue. Must be called with q.mu held.
+func (q *Queues) find(k, receipt string) (string, int, bool) {
+	if receipt == "" {
+		return "", 0, false
+	}
+	for _, key := range []string{k, deadLetterKey(k)} {
+		for i, e := range q.m[key] {
+			if e.msg.ReceiptHandle == receipt {
+				return key, i, true
+			}
+		}
+	}
+	return "", 0, false
+}
+
+// waker returns the channel notify closes for queue k. Must be called with
+// q.mu held.
+func (q *Queues) waker(k string) chan struct{} {
+	if q.wake == nil {
+		q.wake = make(map[string]chan struct{})
+	}
+	ch, ok := q.wake[k]
+	if !ok {
+		ch = make(chan struct{})
+		q.wake[k] = ch
+	}
+	return ch
+}
+
+// notify wakes the receivers waiting on queue k. Must be called with q.mu
+// held.
+func (q *Queues) notify(k string) {
+	if ch, ok := q.wake[k]; ok {
+		close(ch)
+		delete(q.wake, k)
+	}
+}
+
+func (q *Queues) maxReceives() int {
+	if q.MaxReceives > 0 {
+		return q.MaxReceives
+	}
+	return 10
+}
+
+func (q *Queues) maxDepth() int {
+	if q.MaxDepth > 0 {
+		return q.MaxDepth
+	}
+	return 10000
+}
+
+func queueKey(tenant, name string) string {
+	return tenant + "\x00" + name
+}
+
+func deadLetterKey(k string) string {
+	if isDeadLetterKey(k) {
+		return k
+	}
+	return k + "\x00dead"
+}
+
+func isDeadLetterKey(k string) bool {
+	return strings.HasSuffix(k, "\x00dead")
+}
@@ -0,0 +1,53 @@
+// Package delivery moves relays through their lifecycle after they have
+// been accepted by the API.
+package delivery
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/segolab/relay-ref/server/go/pkg/metrics"
+	"github.com/segolab/relay-ref/server/go/pkg/store"
+)
+
+// Scheduler drives the time-based transitions: it expires pending relays
+// whose ExpiresAt has passed and promotes scheduled relays to queued once
+// their DeliverAt has passed. Cancelled and deleted relays drop out of both
+// indexes on their own; see store.RelayStore.
+type Scheduler struct {
+	Log      *slog.Logger
+	Store    store.RelayStore
+	Interval time.Duration
+}
+
+// Run polls until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	t := time.NewTicker(s.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			s.Tick(now.UTC())
+		}
+	}
+}
+
+// Tick applies every transition due at now and returns how many relays it
+// promoted. Expiry runs first, so a relay whose expiry is due is never
+// promoted.
+func (s *Scheduler) Tick(now time.Time) int {
+	for _, r := range s.Store.ExpireDue(now) {
+		s.Log.Info("relay expired", "relay_id", r.ID, "tenant", r.Tenant, "expires_at", r.ExpiresAt)
+		metrics.RelaysExpired.Add(1)
+	}
+
+	due := s.Store.PromoteDue(now)
+	for _, r := range due {
+		s.Log.Debug("relay promoted", "relay_id", r.ID, "tenant", r.Tenant, "deliver_at", r.DeliverAt)
+	}
+	metrics.SchedulerPromoted.Add(int64(len(due)))
+	return len(due)
+}
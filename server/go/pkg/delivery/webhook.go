@@ -0,0 +1,72 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+	"github.com/segolab/relay-ref/server/go/pkg/transform"
+)
+
+// Sender makes one delivery attempt to one destination.
+type Sender interface {
+	Send(ctx context.Context, r *model.Relay, d model.Delivery) error
+}
+
+// WebhookSender POSTs the payload, or the body rendered by the
+// destination's transform, to the destination URL. Any 2xx response counts
+// as delivered.
+type WebhookSender struct {
+	Client *http.Client
+}
+
+func (s WebhookSender) Validate(d model.Destination) error {
+	u, err := url.Parse(d.URL)
+	if strings.TrimSpace(d.URL) == "" || len(d.URL) > 2048 || err != nil {
+		return errors.New("destination.url is required and must be <= 2048 characters")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("destination.url must be an http or https URL")
+	}
+	return nil
+}
+
+func (s WebhookSender) Send(ctx context.Context, r *model.Relay, d model.Delivery) error {
+	out, err := transform.Apply(d.Destination.Transform, r)
+	if err != nil {
+		return fmt.Errorf("transform: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.Destination.URL, bytes.NewReader(out.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range out.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("X-Relay-Id", r.ID.String())
+	req.Header.Set("X-Relay-Event-Type", r.EventType)
+	req.Header.Set("X-Relay-Attempt", strconv.Itoa(d.Attempts+1))
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %d", resp.StatusCode)
+	}
+	return nil
+}
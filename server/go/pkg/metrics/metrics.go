@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+)
+
+// Process-local counters, exported via expvar (GET /metrics).
+// No metrics backend is required; values reset on restart.
+var (
+	// RateLimitShadowDenied counts requests a shadow policy would have
+	// rejected, keyed by route group.
+	RateLimitShadowDenied = expvar.NewMap("ratelimit_shadow_denied")
+
+	// AdmissionLimit and AdmissionInFlight report the server-wide
+	// concurrency limit and current usage.
+	AdmissionLimit    = expvar.NewInt("admission_limit")
+	AdmissionInFlight = expvar.NewInt("admission_inflight")
+	// AdmissionShed counts requests rejected with 503, keyed by
+	// "priority" or "normal".
+	AdmissionShed = expvar.NewMap("admission_shed")
+
+	// SchedulerPromoted counts scheduled relays moved to queued.
+	SchedulerPromoted = expvar.NewInt("scheduler_promoted")
+	// RelaysExpired counts pending relays that expired undelivered.
+	RelaysExpired = expvar.NewInt("relays_expired")
+	// DeliveryAttempts counts delivery attempts, keyed by outcome:
+	// "delivered", "retry" or "failed".
+	DeliveryAttempts = expvar.NewMap("delivery_attempts")
+	// CallbackAttempts counts status callback attempts, keyed like
+	// DeliveryAttempts.
+	CallbackAttempts = expvar.NewMap("callback_attempts")
+)
+
+// Handler serves all registered values as JSON.
+func Handler() http.Handler {
+	return expvar.Handler()
+}
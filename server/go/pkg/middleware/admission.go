@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/segolab/relay-ref/server/go/pkg/admission"
+)
+
+// Admission sheds load with 503 before any handler work is done when the
+// server-wide concurrency limit is reached. isPriority marks requests that
+// may use the capacity reserved for priority traffic.
+func Admission(c *admission.Controller, retryAfterSeconds int, isPriority func(*http.Request) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			release, ok := c.Acquire(isPriority(r))
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+				WriteError(w, r, http.StatusServiceUnavailable, "overloaded", "server is shedding load",
+					map[string]any{"retryAfterSeconds": retryAfterSeconds})
+				return
+			}
+
+			start := time.Now()
+			defer func() { release(time.Since(start)) }()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/segolab/relay-ref/server/go/pkg/audit"
+)
+
+const auditCtxKey ctxKey = "audit"
+
+// Audit makes l available to RecordAudit for the rest of the chain.
+func Audit(l *audit.Log) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), auditCtxKey, l)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RecordAudit records an event enriched with the caller, request ID and
+// source IP. It is a no-op when no audit log is installed.
+func RecordAudit(r *http.Request, eventType string, details map[string]any) {
+	l, _ := r.Context().Value(auditCtxKey).(*audit.Log)
+	if l == nil {
+		return
+	}
+	e := audit.Event{Type: eventType, Details: details}
+	if p, ok := PrincipalFromContext(r.Context()); ok {
+		e.Tenant = p.Tenant
+		e.Actor = p.ID
+	}
+	if id := RequestIDFromContext(r.Context()); id != nil {
+		e.RequestID = *id
+	}
+	// RemoteAddr is the direct peer; forwarding headers are not trusted.
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		e.SourceIP = host
+	} else {
+		e.SourceIP = r.RemoteAddr
+	}
+	l.Record(e)
+}
@@ -2,36 +2,124 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strings"
+	"time"
+
+	"github.com/segolab/relay-ref/server/go/pkg/audit"
+	"github.com/segolab/relay-ref/server/go/pkg/auth"
+	"github.com/segolab/relay-ref/server/go/pkg/store"
 )
 
 type ctxKey string
 
-const apiKeyCtxKey ctxKey = "api_key"
+const principalCtxKey ctxKey = "principal"
+
+// Principal is the authenticated caller. ID is stable and non-secret; it
+// keys rate limiting. Tenant scopes the data the caller can see, and Scopes
+// with the optional restrictions scope what it can do.
+type Principal struct {
+	ID                string
+	Tenant            string
+	Scopes            []string
+	EventTypePrefixes []string
+	DestinationHosts  []string
+}
+
+// Authenticator resolves one kind of credential. It returns ErrNoCredential
+// when the request does not carry that kind, so the next one can be tried.
+type Authenticator interface {
+	Authenticate(r *http.Request) (Principal, error)
+}
+
+var (
+	ErrNoCredential      = errors.New("no credential")
+	ErrInvalidCredential = errors.New("invalid credential")
+)
 
-func APIKeyAuth(allowed map[string]struct{}) func(http.Handler) http.Handler {
+// Authenticate accepts the first credential type present on the request. A
+// present but invalid credential is rejected rather than falling through.
+func Authenticate(authenticators ...Authenticator) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			k := strings.TrimSpace(r.Header.Get("X-API-Key"))
-			if k == "" {
-				w.WriteHeader(http.StatusUnauthorized)
-				return
-			}
-			if _, ok := allowed[k]; !ok {
-				w.WriteHeader(http.StatusUnauthorized)
+			for _, a := range authenticators {
+				p, err := a.Authenticate(r)
+				if errors.Is(err, ErrNoCredential) {
+					continue
+				}
+				if err != nil {
+					RecordAudit(r, audit.TypeAuthFailure, map[string]any{"reason": "invalid", "path": r.URL.Path})
+					WriteError(w, r, http.StatusUnauthorized, "unauthorized", "invalid credentials", nil)
+					return
+				}
+				ctx := context.WithValue(r.Context(), principalCtxKey, p)
+				next.ServeHTTP(w, r.WithContext(ctx))
 				return
 			}
-			ctx := context.WithValue(r.Context(), apiKeyCtxKey, k)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			RecordAudit(r, audit.TypeAuthFailure, map[string]any{"reason": "missing", "path": r.URL.Path})
+			WriteError(w, r, http.StatusUnauthorized, "unauthorized", "missing credentials", nil)
 		})
 	}
 }
 
-func APIKeyFromContext(ctx context.Context) string {
-	v := ctx.Value(apiKeyCtxKey)
-	if s, ok := v.(string); ok {
-		return s
+// APIKeyAuthenticator accepts the X-API-Key header.
+type APIKeyAuthenticator struct {
+	Keys store.APIKeyStore
+}
+
+func (a APIKeyAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	k := strings.TrimSpace(r.Header.Get("X-API-Key"))
+	if k == "" {
+		return Principal{}, ErrNoCredential
+	}
+	key, ok := a.Keys.Authenticate(k, time.Now().UTC())
+	if !ok {
+		return Principal{}, ErrInvalidCredential
 	}
-	return ""
+	return Principal{
+		ID:                key.ID,
+		Tenant:            key.Tenant,
+		Scopes:            key.Scopes,
+		EventTypePrefixes: key.EventTypePrefixes,
+		DestinationHosts:  key.DestinationHosts,
+	}, nil
+}
+
+// BearerAuthenticator accepts "Authorization: Bearer <JWT>". The tenant is
+// read from TenantClaim and scopes from the "scope" or "scp" claim.
+type BearerAuthenticator struct {
+	Verifier    *auth.Verifier
+	TenantClaim string
+}
+
+func (a BearerAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return Principal{}, ErrNoCredential
+	}
+	claims, err := a.Verifier.Verify(r.Context(), strings.TrimSpace(token), time.Now().UTC())
+	if err != nil {
+		return Principal{}, ErrInvalidCredential
+	}
+
+	tenant := claims.String(a.TenantClaim)
+	sub := claims.String("sub")
+	if tenant == "" || sub == "" {
+		return Principal{}, ErrInvalidCredential
+	}
+	scopes := claims.Strings("scope")
+	if len(scopes) == 0 {
+		scopes = claims.Strings("scp")
+	}
+	return Principal{
+		ID:     "jwt:" + claims.String("iss") + "#" + sub,
+		Tenant: tenant,
+		Scopes: scopes,
+	}, nil
+}
+
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalCtxKey).(Principal)
+	return p, ok
 }
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"crypto/x509"
+	"net/http"
+)
+
+// ClientCertAuthenticator accepts a client certificate verified during the
+// TLS handshake. The identity is the first URI SAN, else the first DNS SAN,
+// else the subject common name. It maps to a tenant through Tenants;
+// unmapped certificates are rejected, whatever their subject says.
+type ClientCertAuthenticator struct {
+	Tenants map[string]string
+	Scopes  []string
+}
+
+func (a ClientCertAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return Principal{}, ErrNoCredential
+	}
+	leaf := r.TLS.VerifiedChains[0][0]
+
+	identity := certIdentity(leaf)
+	if identity == "" {
+		return Principal{}, ErrInvalidCredential
+	}
+	tenant := a.Tenants[identity]
+	if tenant == "" {
+		return Principal{}, ErrInvalidCredential
+	}
+
+	return Principal{
+		ID:     "cert:" + identity,
+		Tenant: tenant,
+		Scopes: a.Scopes,
+	}, nil
+}
+
+func certIdentity(c *x509.Certificate) string {
+	if len(c.URIs) > 0 {
+		return c.URIs[0].String()
+	}
+	if len(c.DNSNames) > 0 {
+		return c.DNSNames[0]
+	}
+	return c.Subject.CommonName
+}
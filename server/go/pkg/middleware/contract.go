@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+
+	"github.com/segolab/relay-ref/server/go/pkg/openapi"
+)
+
+// ContractOptions configure Contract.
+type ContractOptions struct {
+	// MaxBodyBytes bounds the request bodies validated; larger ones are
+	// passed on unvalidated for the handler to reject.
+	MaxBodyBytes int64
+	// ValidateResponses also checks JSON responses and replaces any that
+	// break the contract with a 500. It buffers responses, so it is meant
+	// for tests.
+	ValidateResponses bool
+}
+
+// Contract rejects requests that do not match the OpenAPI operation they
+// address with 400 invalid_request, listing each openapi.Violation under
+// details.errors. Requests the spec does not describe pass through.
+func Contract(spec *openapi.Spec, opts ContractOptions, log *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			op, params := spec.Find(r.Method, r.URL.Path)
+			if op == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var body []byte
+			if r.Body != nil && r.Body != http.NoBody {
+				buf, err := io.ReadAll(io.LimitReader(r.Body, opts.MaxBodyBytes+1))
+				if err == nil && int64(len(buf)) <= opts.MaxBodyBytes {
+					body = buf
+				}
+				r.Body = readCloser{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+			} else if r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch {
+				body = []byte{}
+			}
+
+			if v := op.ValidateRequest(r, params, body); len(v) > 0 {
+				WriteError(w, r, http.StatusBadRequest, "invalid_request", "request does not match the API contract",
+					map[string]any{"operation": op.ID, "errors": v})
+				return
+			}
+			if !opts.ValidateResponses {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &contractRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.passthrough {
+				return
+			}
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			if v := op.ValidateResponse(rec.status, rec.buf.Bytes()); len(v) > 0 {
+				log.Error("response breaks the API contract", "operation", op.ID, "status", rec.status, "violations", v)
+				WriteError(w, r, http.StatusInternalServerError, "contract_violation", "response does not match the API contract",
+					map[string]any{"operation": op.ID, "status": rec.status, "errors": v})
+				return
+			}
+			w.WriteHeader(rec.status)
+			_, _ = w.Write(rec.buf.Bytes())
+		})
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// contractRecorder buffers JSON responses for validation. Other responses,
+// such as event streams and problem details, are written through.
+type contractRecorder struct {
+	http.ResponseWriter
+	status      int
+	buf         bytes.Buffer
+	passthrough bool
+}
+
+func (c *contractRecorder) WriteHeader(status int) {
+	if c.status != 0 {
+		return
+	}
+	c.status = status
+	if mt, _, _ := mime.ParseMediaType(c.Header().Get("Content-Type")); mt != "application/json" {
+		c.passthrough = true
+		c.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (c *contractRecorder) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.passthrough {
+		return c.ResponseWriter.Write(b)
+	}
+	return c.buf.Write(b)
+}
+
+func (c *contractRecorder) Flush() {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok && c.passthrough {
+		f.Flush()
+	}
+}
+
+func (c *contractRecorder) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
@@ -1,27 +1,56 @@
 package middleware
 
 import (
+	"context"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/segolab/relay-ref/server/go/pkg/audit"
+	"github.com/segolab/relay-ref/server/go/pkg/metrics"
 	"github.com/segolab/relay-ref/server/go/pkg/ratelimit"
 )
 
+const rateLimitCostCtxKey ctxKey = "rate_limit_cost"
+
+// WithRateLimitCost sets how many tokens the rate limiters further down the
+// chain charge for the request (default 1).
+func WithRateLimitCost(r *http.Request, cost int) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), rateLimitCostCtxKey, cost))
+}
+
+func rateLimitCost(r *http.Request) int {
+	if n, ok := r.Context().Value(rateLimitCostCtxKey).(int); ok && n > 0 {
+		return n
+	}
+	return 1
+}
+
 func RateLimit(l ratelimit.Limiter, routeGroup string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			apiKey := APIKeyFromContext(r.Context())
-			res := l.Allow(apiKey, routeGroup, time.Now().UTC())
+			p, _ := PrincipalFromContext(r.Context())
+			cost := rateLimitCost(r)
+			res := l.AllowN(p.ID, routeGroup, cost, time.Now().UTC())
 
 			// Headers on best-effort basis
 			w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
 			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
 			w.Header().Set("RateLimit-Reset", strconv.Itoa(res.ResetInSeconds))
 
+			if !res.Allowed && cost > res.Limit {
+				// Retrying cannot help: the request costs more than the
+				// bucket holds.
+				WriteError(w, r, http.StatusBadRequest, "invalid_request", "request costs more rate-limit tokens than the burst allows",
+					map[string]any{"routeGroup": routeGroup, "cost": cost, "limit": res.Limit})
+				return
+			}
 			if !res.Allowed {
+				RecordAudit(r, audit.TypeRateLimitDenied, map[string]any{"routeGroup": routeGroup})
 				w.Header().Set("Retry-After", strconv.Itoa(res.RetryAfterSeconds))
-				w.WriteHeader(http.StatusTooManyRequests)
+				WriteError(w, r, http.StatusTooManyRequests, "rate_limited", "rate limit exceeded",
+					map[string]any{"routeGroup": routeGroup, "retryAfterSeconds": res.RetryAfterSeconds})
 				return
 			}
 
@@ -29,3 +58,35 @@ func RateLimit(l ratelimit.Limiter, routeGroup string) func(http.Handler) http.H
 		})
 	}
 }
+
+// ShadowRateLimit evaluates l like RateLimit but never rejects (dry-run).
+// Would-be denials are logged and counted, and the outcome is reported in
+// RateLimit-Shadow-* headers so it cannot be mistaken for the enforced policy.
+func ShadowRateLimit(l ratelimit.Limiter, routeGroup string, log *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, _ := PrincipalFromContext(r.Context())
+			res := l.AllowN(p.ID, routeGroup, rateLimitCost(r), time.Now().UTC())
+
+			w.Header().Set("RateLimit-Shadow-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("RateLimit-Shadow-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Shadow-Reset", strconv.Itoa(res.ResetInSeconds))
+
+			if !res.Allowed {
+				metrics.RateLimitShadowDenied.Add(routeGroup, 1)
+				reqID := ""
+				if id := RequestIDFromContext(r.Context()); id != nil {
+					reqID = *id
+				}
+				log.Info("rate limit shadow denial",
+					"route_group", routeGroup,
+					"key_id", p.ID,
+					"retry_after", res.RetryAfterSeconds,
+					"request_id", reqID,
+				)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
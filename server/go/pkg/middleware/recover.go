@@ -10,8 +10,8 @@ func Recover(log *slog.Logger) func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			defer func() {
 				if rec := recover(); rec != nil {
-					log.Error("panic recovered", "rec", rec)
-					w.WriteHeader(http.StatusInternalServerError)
+					log.Error("panic recovered", "rec", rec, "path", r.URL.Path)
+					WriteError(w, r, http.StatusInternalServerError, "internal", "internal server error", nil)
 				}
 			}()
 			next.ServeHTTP(w, r)
@@ -1,6 +1,26 @@
 package middleware
 
-import "net/http"
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+)
+
+// ErrorFormat selects the body written by WriteError.
+type ErrorFormat string
+
+const (
+	// ErrorFormatJSON writes model.ErrorResponse as application/json.
+	ErrorFormatJSON ErrorFormat = "json"
+	// ErrorFormatProblem writes RFC 9457 application/problem+json.
+	ErrorFormatProblem ErrorFormat = "problem"
+)
+
+const errorFormatCtxKey ctxKey = "error_format"
 
 func RespondJSON() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -10,3 +30,85 @@ func RespondJSON() func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// Errors sets the server-wide default error format. Clients may still ask
+// for problem details by accepting application/problem+json.
+func Errors(format ErrorFormat) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), errorFormatCtxKey, format)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// WriteError writes an error body carrying the request ID, as an
+// ErrorResponse or as problem details depending on configuration and Accept.
+func WriteError(w http.ResponseWriter, r *http.Request, status int, code, message string, details map[string]any) {
+	reqID := RequestIDFromContext(r.Context())
+
+	if wantsProblem(r) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(model.ProblemDetails{
+			Type:      "about:blank",
+			Title:     http.StatusText(status),
+			Status:    status,
+			Detail:    message,
+			Instance:  r.URL.Path,
+			Code:      code,
+			Details:   details,
+			RequestID: reqID,
+		})
+		return
+	}
+
+	resp := model.ErrorResponse{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: reqID,
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// wantsProblem reports whether problem details are configured, or
+// accepted at least as strongly as application/json, whose weight is taken
+// from the most specific range matching it.
+func wantsProblem(r *http.Request) bool {
+	if f, _ := r.Context().Value(errorFormatCtxKey).(ErrorFormat); f == ErrorFormatProblem {
+		return true
+	}
+	problemQ, jsonQ, jsonRank := 0.0, 0.0, 0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+		q := qValue(params)
+		switch mt := strings.ToLower(strings.TrimSpace(mediaType)); mt {
+		case "application/problem+json":
+			problemQ = q
+		case "application/json", "application/*", "*/*":
+			if rank := jsonRanks[mt]; rank > jsonRank {
+				jsonQ, jsonRank = q, rank
+			}
+		}
+	}
+	return problemQ > 0 && problemQ >= jsonQ
+}
+
+var jsonRanks = map[string]int{"*/*": 1, "application/*": 2, "application/json": 3}
+
+// qValue returns the q parameter of a media range, 1 if absent or invalid.
+func qValue(params string) float64 {
+	for _, p := range strings.Split(params, ";") {
+		k, v, _ := strings.Cut(p, "=")
+		if strings.EqualFold(strings.TrimSpace(k), "q") {
+			if q, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && q >= 0 && q <= 1 {
+				return q
+			}
+		}
+	}
+	return 1
+}
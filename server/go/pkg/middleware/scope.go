@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/segolab/relay-ref/server/go/pkg/audit"
+)
+
+const (
+	ScopeRelaysRead  = "relays:read"
+	ScopeRelaysWrite = "relays:write"
+	// ScopeSubscriptionsRead and ScopeSubscriptionsWrite govern the routing
+	// configuration: /v1/subscriptions and /v1/rules.
+	ScopeSubscriptionsRead  = "subscriptions:read"
+	ScopeSubscriptionsWrite = "subscriptions:write"
+	// ScopeQueuesConsume allows pulling messages from the tenant's
+	// in-process queues.
+	ScopeQueuesConsume = "queues:consume"
+	// ScopeAdmin grants every other scope as well.
+	ScopeAdmin = "admin"
+)
+
+// KnownScopes lists the scopes that may be attached to a credential.
+var KnownScopes = []string{
+	ScopeRelaysRead, ScopeRelaysWrite,
+	ScopeSubscriptionsRead, ScopeSubscriptionsWrite,
+	ScopeQueuesConsume,
+	ScopeAdmin,
+}
+
+func (p Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+// AllowsEventType reports whether eventType matches one of the principal's
+// event type prefixes. No prefixes means no restriction.
+func (p Principal) AllowsEventType(eventType string) bool {
+	if len(p.EventTypePrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range p.EventTypePrefixes {
+		if strings.HasPrefix(eventType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsDestination reports whether the host of rawURL is permitted. Entries
+// are exact host names or "*.example.com" wildcards matching subdomains. No
+// entries means no restriction.
+func (p Principal) AllowsDestination(rawURL string) bool {
+	if len(p.DestinationHosts) == 0 {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, h := range p.DestinationHosts {
+		h = strings.ToLower(h)
+		if domain, ok := strings.CutPrefix(h, "*."); ok {
+			// The wildcard stands for whole labels, so *.example.com does
+			// not match evilexample.com.
+			if ValidDestinationHost(h) && strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		} else if host == h {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidDestinationHost reports whether h is a host name or a "*." wildcard
+// followed by a domain, the entries AllowsDestination understands.
+func ValidDestinationHost(h string) bool {
+	h = strings.TrimPrefix(h, "*.")
+	if h == "" || len(h) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(h, ".") {
+		if label == "" || strings.ContainsAny(label, "*/:@?#[] ") {
+			return false
+		}
+	}
+	return true
+}
+
+// RequireScope rejects authenticated callers lacking scope with 403.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if p, ok := PrincipalFromContext(r.Context()); !ok || !p.HasScope(scope) {
+				RecordAudit(r, audit.TypeAuthzDenied, map[string]any{"scope": scope, "path": r.URL.Path})
+				WriteError(w, r, http.StatusForbidden, "forbidden", "missing required scope", map[string]any{"scope": scope})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package model
+
+import "time"
+
+type RateLimitPolicy struct {
+	RPS   float64 `json:"rps"`
+	Burst int     `json:"burst"`
+}
+
+type RateLimitBoost struct {
+	Tokens int       `json:"tokens"`
+	Until  time.Time `json:"until"`
+}
+
+type RateLimitBucket struct {
+	RouteGroup    string          `json:"routeGroup"`
+	Policy        RateLimitPolicy `json:"policy"`
+	Tokens        float64         `json:"tokens"`
+	Boost         *RateLimitBoost `json:"boost,omitempty"`
+	RecentDenials []time.Time     `json:"recentDenials"`
+}
+
+type RateLimitStatusResponse struct {
+	Buckets []RateLimitBucket `json:"buckets"`
+}
+
+type ResetRateLimitRequest struct {
+	KeyID      string `json:"keyId"`
+	RouteGroup string `json:"routeGroup"`
+}
+
+type BoostRateLimitRequest struct {
+	KeyID      string `json:"keyId"`
+	RouteGroup string `json:"routeGroup"`
+	Tokens     int    `json:"tokens"`
+	TTLSeconds int    `json:"ttlSeconds"`
+}
+
+type APIKeyInfo struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Tenant     string     `json:"tenant"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+
+	Scopes            []string `json:"scopes"`
+	EventTypePrefixes []string `json:"eventTypePrefixes,omitempty"`
+	DestinationHosts  []string `json:"destinationHosts,omitempty"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name             string `json:"name"`
+	Tenant           string `json:"tenant"`
+	ExpiresInSeconds int    `json:"expiresInSeconds,omitempty"`
+
+	Scopes            []string `json:"scopes"`
+	EventTypePrefixes []string `json:"eventTypePrefixes,omitempty"`
+	DestinationHosts  []string `json:"destinationHosts,omitempty"`
+}
+
+type RotateAPIKeyRequest struct {
+	GracePeriodSeconds int `json:"gracePeriodSeconds,omitempty"`
+}
+
+// APIKeySecretResponse carries a newly issued secret. It is the only time
+// the secret is returned.
+type APIKeySecretResponse struct {
+	Key    APIKeyInfo `json:"key"`
+	Secret string     `json:"secret"`
+}
+
+type ListAPIKeysResponse struct {
+	Items []APIKeyInfo `json:"items"`
+}
+
+type AuditEvent struct {
+	Time      time.Time      `json:"time"`
+	Type      string         `json:"type"`
+	Tenant    string         `json:"tenant,omitempty"`
+	Actor     string         `json:"actor,omitempty"`
+	RequestID string         `json:"requestId,omitempty"`
+	SourceIP  string         `json:"sourceIp,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+type ListAuditEventsResponse struct {
+	Items []AuditEvent `json:"items"`
+}
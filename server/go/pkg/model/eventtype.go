@@ -0,0 +1,49 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// EventType is a tenant's registered event type. Schema, when set, is a
+// JSON Schema (draft 2020-12, see package schema) that relay payloads of
+// this type must satisfy. Each change to the schema adds a version; the
+// latest one is enforced.
+type EventType struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Version     int             `json:"version"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	UpdatedAt   time.Time       `json:"updatedAt"`
+	// Tenant owns the event type; it is never serialized.
+	Tenant string `json:"-"`
+}
+
+// EventTypeVersion is one historical schema of an event type.
+type EventTypeVersion struct {
+	Version   int             `json:"version"`
+	Schema    json.RawMessage `json:"schema,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+type CreateEventTypeRequest struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+}
+
+// UpdateEventTypeRequest replaces the description and schema; the schema
+// becomes a new version.
+type UpdateEventTypeRequest struct {
+	Description string          `json:"description,omitempty"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+}
+
+type ListEventTypesResponse struct {
+	Items []*EventType `json:"items"`
+}
+
+type ListEventTypeVersionsResponse struct {
+	Items []EventTypeVersion `json:"items"`
+}
@@ -10,13 +10,55 @@ import (
 type Destination struct {
 	Type string `json:"type"`
 	URL  string `json:"url"`
+	// Transform, if set, shapes the outbound request instead of sending the
+	// payload as is.
+	Transform *Transform `json:"transform,omitempty"`
+}
+
+// Transform holds text/template templates for the outbound body and
+// headers. Templates see .id, .eventType, .metadata, .payload and
+// .createdAt; see package transform.
+type Transform struct {
+	Body    string            `json:"body,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// PreviewTransformRequest renders Transform against a sample relay.
+type PreviewTransformRequest struct {
+	Transform Transform         `json:"transform"`
+	EventType string            `json:"eventType,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Payload   json.RawMessage   `json:"payload,omitempty"`
+}
+
+type PreviewTransformResponse struct {
+	Body    string            `json:"body"`
+	Headers map[string]string `json:"headers"`
 }
 
 type CreateRelayRequest struct {
-	EventType   string            `json:"eventType"`
-	Destination Destination       `json:"destination"`
-	Payload     json.RawMessage   `json:"payload"`
-	Metadata    map[string]string `json:"metadata,omitempty"`
+	EventType string `json:"eventType"`
+	// Destination and Destinations are alternatives: a relay goes to one
+	// destination, or fans out to several. With neither, it is routed to the
+	// matching subscriptions.
+	Destination  Destination       `json:"destination"`
+	Destinations []Destination     `json:"destinations,omitempty"`
+	Payload      json.RawMessage   `json:"payload"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	// DeliverAt or DelaySeconds (not both) hold the relay as scheduled until
+	// that time. A DeliverAt in the past queues it immediately.
+	DeliverAt    *time.Time `json:"deliverAt,omitempty"`
+	DelaySeconds int        `json:"delaySeconds,omitempty"`
+	// ExpiresAt or TTLSeconds (not both) bound how long the relay stays
+	// deliverable; after that it becomes expired instead of being delivered.
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	TTLSeconds int        `json:"ttlSeconds,omitempty"`
+	// CallbackURL receives a signed StatusCallback once the relay is
+	// delivered, failed or expired.
+	CallbackURL string `json:"callbackUrl,omitempty"`
+	// OrderingKey delivers relays that share it, per destination, strictly
+	// in enqueue order.
+	OrderingKey string `json:"orderingKey,omitempty"`
 }
 
 type RelayStatus string
@@ -25,18 +67,90 @@ const (
 	RelayStatusQueued    RelayStatus = "queued"
 	RelayStatusDelivered RelayStatus = "delivered"
 	RelayStatusFailed    RelayStatus = "failed"
+	RelayStatusCancelled RelayStatus = "cancelled"
+	RelayStatusScheduled RelayStatus = "scheduled"
+	RelayStatusExpired   RelayStatus = "expired"
+	// RelayStatusDropped marks relays discarded by a drop rule at enqueue.
+	RelayStatusDropped RelayStatus = "dropped"
+)
+
+// Pending reports whether a relay in this status has yet to be delivered.
+func (s RelayStatus) Pending() bool {
+	return s == RelayStatusQueued || s == RelayStatusScheduled
+}
+
+// OrderingPolicy decides what happens when the head of an ordered lane
+// runs out of attempts.
+type OrderingPolicy string
+
+const (
+	// OrderingSkip fails the head like any other relay, dead-letters it to
+	// a queue for inspection and replay, and lets the relays behind it
+	// proceed.
+	OrderingSkip OrderingPolicy = "skip"
+	// OrderingBlock keeps retrying the head, without an attempt limit, and
+	// holds the relays behind it until it is delivered or cancelled.
+	OrderingBlock OrderingPolicy = "block"
 )
 
 type Relay struct {
-	ID            uuid.UUID         `json:"id"`
-	EventType     string            `json:"eventType"`
-	Destination   Destination       `json:"destination"`
+	ID        uuid.UUID `json:"id"`
+	EventType string    `json:"eventType"`
+	// Destination is the first of Deliveries; it is nil for relays that
+	// were dropped before any destination was resolved.
+	Destination   *Destination      `json:"destination,omitempty"`
 	Payload       json.RawMessage   `json:"payload"`
 	Metadata      map[string]string `json:"metadata,omitempty"`
 	Status        RelayStatus       `json:"status"`
 	CreatedAt     time.Time         `json:"createdAt"`
+	DeliverAt     *time.Time        `json:"deliverAt,omitempty"`
+	ExpiresAt     *time.Time        `json:"expiresAt,omitempty"`
 	DeliveredAt   *time.Time        `json:"deliveredAt,omitempty"`
 	FailureReason *string           `json:"failureReason,omitempty"`
+	CancelledAt   *time.Time        `json:"cancelledAt,omitempty"`
+	// DeletedAt marks a tombstone; its payload and metadata have been erased.
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	// RedeliveryOf links a redelivery to the relay it resends.
+	RedeliveryOf *uuid.UUID `json:"redeliveryOf,omitempty"`
+	// Deliveries tracks each destination separately. Status aggregates
+	// their outcomes.
+	Deliveries []Delivery `json:"deliveries,omitempty"`
+	// CallbackURL is notified when the relay finishes; Callback tracks that
+	// notification once it is due.
+	CallbackURL string    `json:"callbackUrl,omitempty"`
+	Callback    *Delivery `json:"callback,omitempty"`
+	// OrderingKey sequences delivery with other relays sharing it; see
+	// CreateRelayRequest.
+	OrderingKey string `json:"orderingKey,omitempty"`
+	// Tenant owns the relay; it is never serialized.
+	Tenant string `json:"-"`
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryStatusPending   DeliveryStatus = "pending"
+	DeliveryStatusDelivered DeliveryStatus = "delivered"
+	DeliveryStatusFailed    DeliveryStatus = "failed"
+	// DeliveryStatusSkipped marks deliveries abandoned because the relay was
+	// cancelled or expired first.
+	DeliveryStatusSkipped DeliveryStatus = "skipped"
+)
+
+// Delivery is the state of one destination of a relay. Each destination is
+// attempted and retried independently.
+type Delivery struct {
+	Destination Destination `json:"destination"`
+	// SubscriptionID or RuleID is set when the destination came from a
+	// subscription or a route rule.
+	SubscriptionID *uuid.UUID     `json:"subscriptionId,omitempty"`
+	RuleID         *uuid.UUID     `json:"ruleId,omitempty"`
+	Status         DeliveryStatus `json:"status"`
+	Attempts       int            `json:"attempts"`
+	LastAttemptAt  *time.Time     `json:"lastAttemptAt,omitempty"`
+	NextAttemptAt  *time.Time     `json:"nextAttemptAt,omitempty"`
+	DeliveredAt    *time.Time     `json:"deliveredAt,omitempty"`
+	LastError      *string        `json:"lastError,omitempty"`
 }
 
 type ListRelaysResponse struct {
@@ -50,3 +164,101 @@ type ErrorResponse struct {
 	Details   map[string]any `json:"details,omitempty"`
 	RequestID *string        `json:"requestId,omitempty"`
 }
+
+// ProblemDetails is the RFC 9457 form of ErrorResponse; code, details and
+// requestId are extension members.
+type ProblemDetails struct {
+	Type      string         `json:"type"`
+	Title     string         `json:"title"`
+	Status    int            `json:"status"`
+	Detail    string         `json:"detail,omitempty"`
+	Instance  string         `json:"instance,omitempty"`
+	Code      string         `json:"code"`
+	Details   map[string]any `json:"details,omitempty"`
+	RequestID *string        `json:"requestId,omitempty"`
+}
+
+// BatchCreateRelayItem is a CreateRelayRequest with its own idempotency key.
+type BatchCreateRelayItem struct {
+	CreateRelayRequest
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+}
+
+type BatchCreateRelaysRequest struct {
+	Items []BatchCreateRelayItem `json:"items"`
+	// AllOrNothing rejects the whole batch if any item would fail.
+	AllOrNothing bool `json:"allOrNothing,omitempty"`
+}
+
+type BatchItemStatus string
+
+const (
+	BatchItemCreated  BatchItemStatus = "created"
+	BatchItemReplayed BatchItemStatus = "replayed"
+	BatchItemError    BatchItemStatus = "error"
+	// BatchItemSkipped marks valid items of a rejected all-or-nothing batch.
+	BatchItemSkipped BatchItemStatus = "skipped"
+)
+
+type BatchCreateRelayResult struct {
+	Index  int             `json:"index"`
+	Status BatchItemStatus `json:"status"`
+	Relay  *Relay          `json:"relay,omitempty"`
+	Error  *ErrorResponse  `json:"error,omitempty"`
+}
+
+type BatchCreateRelaysResponse struct {
+	Items []BatchCreateRelayResult `json:"items"`
+}
+
+// RelayFilter selects relays for bulk operations. Empty fields match
+// everything; the time range is half-open [CreatedAfter, CreatedBefore).
+type RelayFilter struct {
+	Status         RelayStatus `json:"status,omitempty"`
+	EventType      string      `json:"eventType,omitempty"`
+	DestinationURL string      `json:"destinationUrl,omitempty"`
+	CreatedAfter   *time.Time  `json:"createdAfter,omitempty"`
+	CreatedBefore  *time.Time  `json:"createdBefore,omitempty"`
+}
+
+type ReplayRelaysRequest struct {
+	Filter RelayFilter `json:"filter"`
+	// DryRun reports how many relays match without redelivering them.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+type ReplayRelaysResponse struct {
+	Matched int         `json:"matched"`
+	DryRun  bool        `json:"dryRun"`
+	Created []uuid.UUID `json:"created"`
+}
+
+// RelayChange is one relay status transition, as streamed by
+// GET /v1/relays:watch. PreviousStatus is empty when the relay was created.
+type RelayChange struct {
+	Seq            uint64      `json:"seq"`
+	RelayID        uuid.UUID   `json:"relayId"`
+	EventType      string      `json:"eventType"`
+	Status         RelayStatus `json:"status"`
+	PreviousStatus RelayStatus `json:"previousStatus,omitempty"`
+	At             time.Time   `json:"at"`
+	Tenant         string      `json:"-"`
+}
+
+// StatusCallback is the body POSTed to a relay's callback URL once the
+// relay is delivered, failed or expired.
+type StatusCallback struct {
+	RelayID       uuid.UUID   `json:"relayId"`
+	EventType     string      `json:"eventType"`
+	Status        RelayStatus `json:"status"`
+	FailureReason *string     `json:"failureReason,omitempty"`
+	DeliveredAt   *time.Time  `json:"deliveredAt,omitempty"`
+	Deliveries    []Delivery  `json:"deliveries,omitempty"`
+}
+
+// CallbackSecretResponse carries the secret a tenant's status callbacks are
+// signed with.
+type CallbackSecretResponse struct {
+	Tenant string `json:"tenant"`
+	Secret string `json:"secret"`
+}
@@ -0,0 +1,62 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Destination types. Webhook destinations are http(s) URLs; file and queue
+// destinations are addressed as "file:<name>" and "queue:<name>".
+const (
+	DestinationWebhook = "webhook"
+	DestinationFile    = "file"
+	DestinationQueue   = "queue"
+)
+
+// QueueMessage is one relay as written by the file and queue drivers. Body
+// is the payload, or the output of the destination's transform; output
+// that is not JSON is carried as a JSON string.
+type QueueMessage struct {
+	ID         uuid.UUID         `json:"id"`
+	RelayID    uuid.UUID         `json:"relayId"`
+	EventType  string            `json:"eventType"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       json.RawMessage   `json:"body"`
+	Attempt    int               `json:"attempt"`
+	EnqueuedAt time.Time         `json:"enqueuedAt"`
+	// ReceiptHandle identifies the current lease of a received message;
+	// ReceiveCount counts its leases so far.
+	ReceiptHandle string `json:"receiptHandle,omitempty"`
+	ReceiveCount  int    `json:"receiveCount,omitempty"`
+}
+
+type ReceiveMessagesRequest struct {
+	// MaxMessages defaults to 1.
+	MaxMessages int `json:"maxMessages,omitempty"`
+	// VisibilityTimeoutSeconds is how long received messages stay leased;
+	// zero uses the server default.
+	VisibilityTimeoutSeconds int `json:"visibilityTimeoutSeconds,omitempty"`
+	// WaitSeconds long-polls for up to that long when no message is
+	// visible.
+	WaitSeconds int `json:"waitSeconds,omitempty"`
+	// DeadLetter receives from the queue's dead-letter queue instead.
+	DeadLetter bool `json:"deadLetter,omitempty"`
+}
+
+type AckMessageRequest struct {
+	ReceiptHandle string `json:"receiptHandle"`
+}
+
+// NackMessageRequest releases a message; it becomes visible again after
+// DelaySeconds.
+type NackMessageRequest struct {
+	ReceiptHandle string `json:"receiptHandle"`
+	DelaySeconds  int    `json:"delaySeconds,omitempty"`
+}
+
+type ReceiveMessagesResponse struct {
+	Items []QueueMessage `json:"items"`
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RuleAction string
+
+const (
+	// RuleActionRoute adds Destination to relays that match, alongside any
+	// subscriptions. Like subscriptions it applies only to relays created
+	// without a destination.
+	RuleActionRoute RuleAction = "route"
+	// RuleActionDrop stores matching relays as dropped instead of
+	// delivering them.
+	RuleActionDrop RuleAction = "drop"
+)
+
+// Rule is a tenant's content-based routing rule. Condition is an
+// expression in the language of package rules, evaluated at enqueue time.
+type Rule struct {
+	ID          uuid.UUID    `json:"id"`
+	Name        string       `json:"name"`
+	Condition   string       `json:"condition"`
+	Action      RuleAction   `json:"action"`
+	Destination *Destination `json:"destination,omitempty"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	// Tenant owns the rule; it is never serialized.
+	Tenant string `json:"-"`
+}
+
+type CreateRuleRequest struct {
+	Name        string       `json:"name"`
+	Condition   string       `json:"condition"`
+	Action      RuleAction   `json:"action"`
+	Destination *Destination `json:"destination,omitempty"`
+}
+
+type ListRulesResponse struct {
+	Items []*Rule `json:"items"`
+}
+
+// TestRuleRequest evaluates Condition against a sample relay.
+type TestRuleRequest struct {
+	Condition string            `json:"condition"`
+	EventType string            `json:"eventType,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Payload   json.RawMessage   `json:"payload,omitempty"`
+}
+
+type TestRuleResponse struct {
+	Matched bool `json:"matched"`
+}
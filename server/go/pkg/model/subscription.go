@@ -0,0 +1,70 @@
+package model
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type MatchType string
+
+const (
+	MatchExact  MatchType = "exact"
+	MatchPrefix MatchType = "prefix"
+	// MatchGlob uses path.Match syntax: * ? and [...] classes.
+	MatchGlob MatchType = "glob"
+)
+
+// Subscription routes relays created without a destination. A relay is
+// sent to every subscription of its tenant whose event type pattern and
+// metadata filter both match.
+type Subscription struct {
+	ID          uuid.UUID         `json:"id"`
+	EventType   string            `json:"eventType"`
+	Match       MatchType         `json:"match"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Destination Destination       `json:"destination"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	// Tenant owns the subscription; it is never serialized.
+	Tenant string `json:"-"`
+}
+
+// Matches reports whether a relay with eventType and metadata should be
+// routed to s. Every metadata entry of s must be present with the same
+// value.
+func (s *Subscription) Matches(eventType string, metadata map[string]string) bool {
+	switch s.Match {
+	case MatchPrefix:
+		if !strings.HasPrefix(eventType, s.EventType) {
+			return false
+		}
+	case MatchGlob:
+		if ok, _ := path.Match(s.EventType, eventType); !ok {
+			return false
+		}
+	default:
+		if eventType != s.EventType {
+			return false
+		}
+	}
+	for k, v := range s.Metadata {
+		if metadata[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+type CreateSubscriptionRequest struct {
+	EventType   string            `json:"eventType"`
+	Match       MatchType         `json:"match,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Destination Destination       `json:"destination"`
+}
+
+type ListSubscriptionsResponse struct {
+	Items         []*Subscription `json:"items"`
+	NextPageToken *string         `json:"nextPageToken"`
+}
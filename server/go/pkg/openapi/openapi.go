@@ -0,0 +1,350 @@
+// Package openapi loads the OpenAPI 3.0 document in api/openapi.yaml and
+// validates HTTP requests and responses against it, so the server cannot
+// drift from its published contract.
+//
+// Schemas are translated to JSON Schema draft 2020-12 (nullable becomes a
+// "null" type, component references become $defs) and compiled with package
+// schema. OpenAPI-only keywords such as discriminator are ignored; standard
+// ones package schema does not support fail the load.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/segolab/relay-ref/server/go/pkg/schema"
+)
+
+// Spec is a loaded contract, safe for concurrent use.
+type Spec struct {
+	ops []*Operation
+}
+
+// Operation is one method on one path of the contract.
+type Operation struct {
+	ID       string
+	Method   string
+	Path     string
+	pattern  *regexp.Regexp
+	names    []string
+	literals int
+
+	params       []*param
+	body         *schema.Schema
+	bodyRequired bool
+	// responses maps a status code, "2XX"-style range or "default" to the
+	// JSON body schema; a nil schema documents a status without a JSON body.
+	responses    map[string]*schema.Schema
+	responseRefs []responseRef
+}
+
+type responseRef struct {
+	status string
+	dst    **schema.Schema
+}
+
+type param struct {
+	name     string
+	in       string
+	required bool
+	// typ is the declared type, used to convert the raw string value.
+	typ    string
+	schema *schema.Schema
+}
+
+var methods = []string{"get", "put", "post", "delete", "patch", "head", "options"}
+
+// document is a copy of api/openapi.yaml, which lies outside the module;
+// go generate refreshes it.
+//
+//go:generate cp ../../../../api/openapi.yaml openapi.yaml
+//go:embed openapi.yaml
+var document []byte
+
+// Embedded compiles the copy of api/openapi.yaml built into the binary.
+func Embedded() (*Spec, error) {
+	return Parse(document)
+}
+
+// Load reads and compiles the contract at path.
+func Load(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse compiles a contract from YAML or JSON.
+func Parse(data []byte) (*Spec, error) {
+	var raw any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("openapi: %w", err)
+	}
+	doc, ok := normalize(raw).(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("openapi: document must be a mapping")
+	}
+	c := &specCompiler{doc: doc, defs: map[string]any{}}
+	for name, s := range lookup(doc, "components", "schemas") {
+		c.defs[name] = translate(s)
+	}
+
+	spec := &Spec{}
+	paths, _ := doc["paths"].(map[string]any)
+	for path, item := range paths {
+		item, _ := item.(map[string]any)
+		for _, method := range methods {
+			op, ok := item[method].(map[string]any)
+			if !ok {
+				continue
+			}
+			spec.ops = append(spec.ops, c.operation(strings.ToUpper(method), path, item, op))
+		}
+	}
+	if err := c.compile(); err != nil {
+		return nil, fmt.Errorf("openapi: %w", err)
+	}
+	for _, op := range spec.ops {
+		for _, r := range op.responseRefs {
+			op.responses[r.status] = *r.dst
+		}
+		op.responseRefs = nil
+	}
+	// Prefer the most literal template, so /relays/{id}:cancel wins over
+	// /relays/{id}.
+	sort.Slice(spec.ops, func(i, j int) bool {
+		if spec.ops[i].literals != spec.ops[j].literals {
+			return spec.ops[i].literals > spec.ops[j].literals
+		}
+		return spec.ops[i].Path < spec.ops[j].Path
+	})
+	return spec, nil
+}
+
+// Find returns the operation for a request and its path parameters, or nil
+// if the contract does not describe it.
+func (s *Spec) Find(method, path string) (*Operation, map[string]string) {
+	for _, op := range s.ops {
+		if op.Method != method {
+			continue
+		}
+		m := op.pattern.FindStringSubmatch(path)
+		if m == nil {
+			continue
+		}
+		params := make(map[string]string, len(op.names))
+		for i, name := range op.names {
+			params[name] = m[i+1]
+		}
+		return op, params
+	}
+	return nil, nil
+}
+
+type specCompiler struct {
+	doc     map[string]any
+	defs    map[string]any
+	targets []target
+}
+
+type target struct {
+	name string
+	dst  **schema.Schema
+}
+
+var templateParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+func (c *specCompiler) operation(method, path string, item, op map[string]any) *Operation {
+	o := &Operation{Method: method, Path: path, responses: map[string]*schema.Schema{}}
+	o.ID, _ = op["operationId"].(string)
+
+	expr := "^"
+	last := 0
+	for _, m := range templateParam.FindAllStringSubmatchIndex(path, -1) {
+		expr += regexp.QuoteMeta(path[last:m[0]]) + "([^/]+?)"
+		o.literals += m[0] - last
+		o.names = append(o.names, path[m[2]:m[3]])
+		last = m[1]
+	}
+	expr += regexp.QuoteMeta(path[last:]) + "$"
+	o.literals += len(path) - last
+	o.pattern = regexp.MustCompile(expr)
+
+	// Operation parameters override path-level ones with the same name.
+	seen := map[string]bool{}
+	for _, list := range []any{op["parameters"], item["parameters"]} {
+		list, _ := list.([]any)
+		for _, p := range list {
+			p, _ := c.resolve(p).(map[string]any)
+			name, _ := p["name"].(string)
+			in, _ := p["in"].(string)
+			if name == "" || seen[in+":"+name] {
+				continue
+			}
+			seen[in+":"+name] = true
+			compiled := &param{name: name, in: in, typ: "string"}
+			compiled.required, _ = p["required"].(bool)
+			if s, ok := p["schema"]; ok {
+				if t, ok := c.resolve(s).(map[string]any)["type"].(string); ok {
+					compiled.typ = t
+				}
+				c.use(s, usage(method, path, in, name), &compiled.schema)
+			}
+			o.params = append(o.params, compiled)
+		}
+	}
+
+	if rb, ok := c.resolve(op["requestBody"]).(map[string]any); ok {
+		o.bodyRequired, _ = rb["required"].(bool)
+		if s, ok := jsonSchema(rb); ok {
+			c.use(s, usage(method, path, "body"), &o.body)
+		}
+	}
+
+	responses, _ := op["responses"].(map[string]any)
+	for status, resp := range responses {
+		resp, _ := c.resolve(resp).(map[string]any)
+		status = strings.ToUpper(status)
+		o.responses[status] = nil
+		if s, ok := jsonSchema(resp); ok {
+			dst := new(*schema.Schema)
+			c.use(s, usage(method, path, "response", status), dst)
+			o.responseRefs = append(o.responseRefs, responseRef{status, dst})
+		}
+	}
+	return o
+}
+
+// usage names an operation's schema in $defs, so compile errors point at
+// it.
+func usage(parts ...string) string {
+	return strings.Join(parts, " ")
+}
+
+// resolve follows a local $ref to a component.
+func (c *specCompiler) resolve(v any) any {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return v
+	}
+	ref, ok := m["$ref"].(string)
+	if !ok || !strings.HasPrefix(ref, "#/") {
+		return v
+	}
+	var cur any = c.doc
+	for _, part := range strings.Split(ref[2:], "/") {
+		cm, _ := cur.(map[string]any)
+		cur = cm[strings.NewReplacer("~1", "/", "~0", "~").Replace(part)]
+	}
+	return cur
+}
+
+// use registers a schema used by an operation under a $defs name; its
+// compiled form is stored in *dst once the whole document is compiled.
+func (c *specCompiler) use(s any, name string, dst **schema.Schema) {
+	c.defs[name] = translate(s)
+	c.targets = append(c.targets, target{name: name, dst: dst})
+}
+
+// compile compiles every component and operation schema as one document,
+// so the components are compiled once.
+func (c *specCompiler) compile() error {
+	raw, err := json.Marshal(map[string]any{"$defs": c.defs})
+	if err != nil {
+		return err
+	}
+	all, err := schema.Compile(raw)
+	if err != nil {
+		return err
+	}
+	for _, t := range c.targets {
+		*t.dst, _ = all.Def(t.name)
+	}
+	return nil
+}
+
+// jsonSchema returns the application/json schema of a request body or
+// response object.
+func jsonSchema(obj map[string]any) (any, bool) {
+	content, _ := obj["content"].(map[string]any)
+	for mt, media := range content {
+		if mt != "application/json" {
+			continue
+		}
+		media, _ := media.(map[string]any)
+		s, ok := media["schema"]
+		return s, ok
+	}
+	return nil, false
+}
+
+// translate rewrites an OpenAPI 3.0 schema as a JSON Schema 2020-12 one.
+func translate(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, e := range t {
+			out[k] = translate(e)
+		}
+		if ref, ok := out["$ref"].(string); ok && strings.HasPrefix(ref, "#/components/schemas/") {
+			out["$ref"] = "#/$defs/" + strings.TrimPrefix(ref, "#/components/schemas/")
+		}
+		if nullable, _ := out["nullable"].(bool); nullable {
+			delete(out, "nullable")
+			if typ, ok := out["type"].(string); ok {
+				out["type"] = []any{typ, "null"}
+			}
+			if enum, ok := out["enum"].([]any); ok {
+				out["enum"] = append(enum, nil)
+			}
+		}
+		return out
+	case []any:
+		out := make([]any, len(t))
+		for i, e := range t {
+			out[i] = translate(e)
+		}
+		return out
+	}
+	return v
+}
+
+// normalize turns YAML mappings with non-string keys, such as unquoted
+// status codes, into JSON objects.
+func normalize(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, e := range t {
+			t[k] = normalize(e)
+		}
+		return t
+	case map[any]any:
+		out := make(map[string]any, len(t))
+		for k, e := range t {
+			out[fmt.Sprint(k)] = normalize(e)
+		}
+		return out
+	case []any:
+		for i, e := range t {
+			t[i] = normalize(e)
+		}
+		return t
+	}
+	return v
+}
+
+func lookup(doc map[string]any, keys ...string) map[string]any {
+	cur := doc
+	for _, k := range keys {
+		cur, _ = cur[k].(map[string]any)
+	}
+	return cur
+}
@@ -0,0 +1,116 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/segolab/relay-ref/server/go/pkg/schema"
+)
+
+// Violation is one way a request or response breaks the contract. In is
+// "path", "query", "header", "body" or "response"; Name is the parameter
+// name and Path a JSON Pointer into the body.
+type Violation struct {
+	In      string `json:"in"`
+	Name    string `json:"name,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidateRequest checks parameters and, when body is not nil, the JSON
+// body. params are the path parameters returned by Find.
+func (o *Operation) ValidateRequest(r *http.Request, params map[string]string, body []byte) []Violation {
+	var out []Violation
+	query := r.URL.Query()
+	for _, p := range o.params {
+		var raw string
+		var ok bool
+		switch p.in {
+		case "path":
+			raw, ok = params[p.name]
+		case "query":
+			ok = query.Has(p.name)
+			raw = query.Get(p.name)
+		case "header":
+			raw = r.Header.Get(p.name)
+			ok = raw != ""
+		default:
+			continue
+		}
+		if !ok {
+			if p.required {
+				out = append(out, Violation{In: p.in, Name: p.name, Message: "is required"})
+			}
+			continue
+		}
+		if p.schema == nil {
+			continue
+		}
+		value, err := convert(p.typ, raw)
+		if err != nil {
+			out = append(out, Violation{In: p.in, Name: p.name, Message: "must be of type " + p.typ})
+			continue
+		}
+		for _, e := range p.schema.Validate(value) {
+			out = append(out, Violation{In: p.in, Name: p.name, Message: e.Message})
+		}
+	}
+
+	if body == nil || o.body == nil {
+		return out
+	}
+	if len(body) == 0 {
+		if o.bodyRequired {
+			out = append(out, Violation{In: "body", Message: "is required"})
+		}
+		return out
+	}
+	return append(out, violations("body", o.body.Validate(body))...)
+}
+
+// ValidateResponse checks a response status and JSON body; body is nil for
+// responses that are not JSON.
+func (o *Operation) ValidateResponse(status int, body []byte) []Violation {
+	code := strconv.Itoa(status)
+	s, ok := o.responses[code]
+	if !ok {
+		s, ok = o.responses[code[:1]+"XX"]
+	}
+	if !ok {
+		s, ok = o.responses["DEFAULT"]
+	}
+	if !ok {
+		return []Violation{{In: "response", Message: "status " + code + " is not documented"}}
+	}
+	if s == nil || len(body) == 0 {
+		return nil
+	}
+	return violations("response", s.Validate(body))
+}
+
+func violations(in string, errs []schema.FieldError) []Violation {
+	out := make([]Violation, 0, len(errs))
+	for _, e := range errs {
+		out = append(out, Violation{In: in, Path: e.Path, Message: e.Message})
+	}
+	return out
+}
+
+// convert turns a raw parameter string into JSON of the declared type.
+func convert(typ, raw string) (json.RawMessage, error) {
+	switch typ {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			return nil, err
+		}
+		return json.RawMessage(raw), nil
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(b)
+	}
+	return json.Marshal(raw)
+}
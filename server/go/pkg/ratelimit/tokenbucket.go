@@ -16,22 +16,57 @@ type Result struct {
 
 type Limiter interface {
 	Allow(apiKey, routeGroup string, now time.Time) Result
+	// AllowN charges n tokens at once; it is all or nothing. A cost above
+	// the bucket's capacity is never allowed.
+	AllowN(apiKey, routeGroup string, n int, now time.Time) Result
 }
 
+// Inspector is implemented by limiters that expose per-bucket state for
+// runtime administration.
+type Inspector interface {
+	Inspect(apiKey, routeGroup string, now time.Time) (BucketState, bool)
+	Reset(apiKey, routeGroup string) bool
+	Boost(apiKey, routeGroup string, extraTokens int, ttl time.Duration, now time.Time) BucketState
+}
+
+// BucketState is a point-in-time view of a single token bucket.
+type BucketState struct {
+	RouteGroup    string
+	RPS           float64
+	Burst         int
+	Tokens        float64
+	BoostTokens   int
+	BoostUntil    *time.Time
+	RecentDenials []time.Time
+}
+
+// RouteGroups lists the route groups known to TokenBucketLimiter.
+var RouteGroups = []string{"post_relays", "get_relays", "receive_messages"}
+
+// maxRecentDenials bounds the denial history kept per bucket.
+const maxRecentDenials = 20
+
 type Config struct {
 	PostRPS   float64
 	PostBurst int
 	GetRPS    float64
 	GetBurst  int
+	// ReceiveRPS and ReceiveBurst limit each queue consumer. Zero uses the
+	// get policy.
+	ReceiveRPS   float64
+	ReceiveBurst int
 }
 
 type tokenBucket struct {
 	rps   float64
 	burst float64
 
-	mu     sync.Mutex
-	last   time.Time
-	tokens float64
+	mu         sync.Mutex
+	last       time.Time
+	tokens     float64
+	boost      float64
+	boostUntil time.Time
+	denials    []time.Time
 }
 
 func newTokenBucket(rps float64, burst int) *tokenBucket {
@@ -43,25 +78,21 @@ func newTokenBucket(rps float64, burst int) *tokenBucket {
 	}
 }
 
-func (b *tokenBucket) allow(now time.Time) Result {
+func (b *tokenBucket) allow(n int, now time.Time) Result {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	dt := now.Sub(b.last).Seconds()
-	if dt < 0 {
-		dt = 0
-	}
-	b.tokens = math.Min(b.burst, b.tokens+(b.rps*dt))
-	b.last = now
+	b.refill(now)
 
-	limit := int(b.burst)
+	limit := int(b.capacity(now))
 	remaining := int(math.Floor(b.tokens))
 	if remaining < 0 {
 		remaining = 0
 	}
 
-	if b.tokens >= 1.0 {
-		b.tokens -= 1.0
+	cost := float64(n)
+	if b.tokens >= cost {
+		b.tokens -= cost
 		remaining = int(math.Floor(b.tokens))
 		if remaining < 0 {
 			remaining = 0
@@ -75,8 +106,12 @@ func (b *tokenBucket) allow(now time.Time) Result {
 		}
 	}
 
-	// Denied: estimate time until 1 token is available.
-	need := 1.0 - b.tokens
+	// Denied: estimate time until the cost is available.
+	b.denials = append(b.denials, now)
+	if len(b.denials) > maxRecentDenials {
+		b.denials = b.denials[len(b.denials)-maxRecentDenials:]
+	}
+	need := cost - b.tokens
 	secs := int(math.Ceil(need / b.rps))
 	if secs < 1 {
 		secs = 1
@@ -90,43 +125,132 @@ func (b *tokenBucket) allow(now time.Time) Result {
 	}
 }
 
+// capacity is the burst size including an active boost.
+func (b *tokenBucket) capacity(now time.Time) float64 {
+	if now.Before(b.boostUntil) {
+		return b.burst + b.boost
+	}
+	return b.burst
+}
+
+// refill adds tokens accrued since the last call. Must be called with b.mu held.
+func (b *tokenBucket) refill(now time.Time) {
+	dt := now.Sub(b.last).Seconds()
+	if dt < 0 {
+		dt = 0
+	}
+	b.tokens = math.Min(b.capacity(now), b.tokens+(b.rps*dt))
+	b.last = now
+}
+
+func (b *tokenBucket) state(routeGroup string, now time.Time) BucketState {
+	b.refill(now)
+	st := BucketState{
+		RouteGroup:    routeGroup,
+		RPS:           b.rps,
+		Burst:         int(b.burst),
+		Tokens:        b.tokens,
+		RecentDenials: append([]time.Time(nil), b.denials...),
+	}
+	if now.Before(b.boostUntil) {
+		until := b.boostUntil
+		st.BoostTokens = int(b.boost)
+		st.BoostUntil = &until
+	}
+	return st
+}
+
 type TokenBucketLimiter struct {
 	cfg Config
 
-	mu   sync.Mutex
-	post map[string]*tokenBucket
-	get  map[string]*tokenBucket
+	mu      sync.Mutex
+	post    map[string]*tokenBucket
+	get     map[string]*tokenBucket
+	receive map[string]*tokenBucket
 }
 
 func NewTokenBucketLimiter(cfg Config) *TokenBucketLimiter {
 	return &TokenBucketLimiter{
-		cfg:  cfg,
-		post: make(map[string]*tokenBucket),
-		get:  make(map[string]*tokenBucket),
+		cfg:     cfg,
+		post:    make(map[string]*tokenBucket),
+		get:     make(map[string]*tokenBucket),
+		receive: make(map[string]*tokenBucket),
 	}
 }
 
 func (l *TokenBucketLimiter) Allow(apiKey, routeGroup string, now time.Time) Result {
+	return l.AllowN(apiKey, routeGroup, 1, now)
+}
+
+func (l *TokenBucketLimiter) AllowN(apiKey, routeGroup string, n int, now time.Time) Result {
 	if apiKey == "" {
 		// Should not happen (auth runs before), but be safe.
 		return Result{Allowed: false, Limit: 0, Remaining: 0, ResetInSeconds: 1, RetryAfterSeconds: 1}
 	}
 
+	return l.bucket(apiKey, routeGroup).allow(n, now)
+}
+
+// Inspect returns the state of an existing bucket; buckets are created
+// lazily on first use, so an unseen key reports false.
+func (l *TokenBucketLimiter) Inspect(apiKey, routeGroup string, now time.Time) (BucketState, bool) {
+	m, _, _ := l.policy(routeGroup)
+	l.mu.Lock()
+	b := m[apiKey]
+	l.mu.Unlock()
+	if b == nil {
+		return BucketState{}, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state(routeGroup, now), true
+}
+
+// Reset drops a bucket so the key starts again with a full burst.
+func (l *TokenBucketLimiter) Reset(apiKey, routeGroup string) bool {
+	m, _, _ := l.policy(routeGroup)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := m[apiKey]
+	delete(m, apiKey)
+	return ok
+}
+
+// Boost temporarily raises a bucket's burst by extraTokens and credits them
+// immediately. A later boost replaces an earlier one.
+func (l *TokenBucketLimiter) Boost(apiKey, routeGroup string, extraTokens int, ttl time.Duration, now time.Time) BucketState {
+	b := l.bucket(apiKey, routeGroup)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	b.boost = float64(extraTokens)
+	b.boostUntil = now.Add(ttl)
+	b.tokens = math.Min(b.capacity(now), b.tokens+b.boost)
+	return b.state(routeGroup, now)
+}
+
+func (l *TokenBucketLimiter) policy(routeGroup string) (map[string]*tokenBucket, float64, int) {
 	switch routeGroup {
 	case "post_relays":
-		return l.allowFromMap(l.post, apiKey, l.cfg.PostRPS, l.cfg.PostBurst, now)
+		return l.post, l.cfg.PostRPS, l.cfg.PostBurst
+	case "receive_messages":
+		if l.cfg.ReceiveRPS > 0 {
+			return l.receive, l.cfg.ReceiveRPS, l.cfg.ReceiveBurst
+		}
+		return l.receive, l.cfg.GetRPS, l.cfg.GetBurst
 	default:
-		return l.allowFromMap(l.get, apiKey, l.cfg.GetRPS, l.cfg.GetBurst, now)
+		return l.get, l.cfg.GetRPS, l.cfg.GetBurst
 	}
 }
 
-func (l *TokenBucketLimiter) allowFromMap(m map[string]*tokenBucket, apiKey string, rps float64, burst int, now time.Time) Result {
+func (l *TokenBucketLimiter) bucket(apiKey, routeGroup string) *tokenBucket {
+	m, rps, burst := l.policy(routeGroup)
 	l.mu.Lock()
+	defer l.mu.Unlock()
 	b := m[apiKey]
 	if b == nil {
 		b = newTokenBucket(rps, burst)
 		m[apiKey] = b
 	}
-	l.mu.Unlock()
-	return b.allow(now)
+	return b
 }
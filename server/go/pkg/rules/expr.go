@@ -0,0 +1,233 @@
+// Package rules implements the expression language used by content-based
+// routing rules. Expressions select values from a relay with JSONPath-style
+// selectors and combine comparisons with boolean operators:
+//
+//	payload.region == "eu" && !(payload.amount < 100)
+//	metadata.source != "test" || payload.items[0].sku == 'A-1'
+//	eventType == "order.created" && payload.customer.vip
+//
+// Roots are payload, metadata and eventType. Selectors that do not resolve
+// yield null. There are no loops, calls or side effects, and expression
+// size and nesting are bounded, so evaluation is linear in the expression.
+package rules
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// MaxLength and MaxDepth bound the expressions Compile accepts.
+const (
+	MaxLength = 1024
+	MaxDepth  = 32
+)
+
+// Env is what an expression is evaluated against.
+type Env struct {
+	EventType string
+	Metadata  map[string]string
+	// Payload is a decoded JSON value, as produced by encoding/json.
+	Payload any
+}
+
+// NewEnv decodes a relay payload into an Env.
+func NewEnv(eventType string, metadata map[string]string, payload json.RawMessage) (Env, error) {
+	env := Env{EventType: eventType, Metadata: metadata}
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &env.Payload); err != nil {
+			return Env{}, err
+		}
+	}
+	return env, nil
+}
+
+// Expr is a compiled expression. It is safe for concurrent use.
+type Expr struct {
+	src  string
+	root node
+}
+
+func (e *Expr) String() string { return e.src }
+
+// Eval reports whether the expression holds for env. Non-boolean results
+// are converted by truthiness: null, false, 0 and "" are false.
+func (e *Expr) Eval(env Env) bool {
+	return truthy(e.root.eval(env))
+}
+
+// Compile parses src.
+func Compile(src string) (*Expr, error) {
+	if len(src) > MaxLength {
+		return nil, &SyntaxError{Pos: MaxLength, Msg: "expression too long"}
+	}
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	root, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, &SyntaxError{Pos: t.pos, Msg: "unexpected " + strconv.Quote(t.text)}
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+type node interface {
+	eval(env Env) any
+}
+
+type literal struct{ v any }
+
+func (n literal) eval(Env) any { return n.v }
+
+// selector is a root name followed by field names (string) and array
+// indexes (int).
+type selector struct {
+	root string
+	path []any
+}
+
+func (n selector) eval(env Env) any {
+	var cur any
+	switch n.root {
+	case "payload":
+		cur = env.Payload
+	case "eventType":
+		cur = env.EventType
+	case "metadata":
+		if env.Metadata == nil {
+			return nil
+		}
+		m := make(map[string]any, len(env.Metadata))
+		for k, v := range env.Metadata {
+			m[k] = v
+		}
+		cur = m
+	}
+	for _, step := range n.path {
+		switch s := step.(type) {
+		case string:
+			obj, ok := cur.(map[string]any)
+			if !ok {
+				return nil
+			}
+			cur = obj[s]
+		case int:
+			arr, ok := cur.([]any)
+			if !ok || s < 0 || s >= len(arr) {
+				return nil
+			}
+			cur = arr[s]
+		}
+	}
+	return cur
+}
+
+type not struct{ x node }
+
+func (n not) eval(env Env) any { return !truthy(n.x.eval(env)) }
+
+type logical struct {
+	op   string
+	l, r node
+}
+
+func (n logical) eval(env Env) any {
+	if n.op == "&&" {
+		return truthy(n.l.eval(env)) && truthy(n.r.eval(env))
+	}
+	return truthy(n.l.eval(env)) || truthy(n.r.eval(env))
+}
+
+type compare struct {
+	op   string
+	l, r node
+}
+
+func (n compare) eval(env Env) any {
+	l, r := n.l.eval(env), n.r.eval(env)
+	switch n.op {
+	case "==":
+		return equal(l, r)
+	case "!=":
+		return !equal(l, r)
+	}
+	c, ok := order(l, r)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+// equal compares scalars by value; objects and arrays are never equal.
+func equal(l, r any) bool {
+	switch l := l.(type) {
+	case nil:
+		return r == nil
+	case bool:
+		rb, ok := r.(bool)
+		return ok && l == rb
+	case float64:
+		rf, ok := r.(float64)
+		return ok && l == rf
+	case string:
+		rs, ok := r.(string)
+		return ok && l == rs
+	}
+	return false
+}
+
+// order compares two numbers or two strings.
+func order(l, r any) (int, bool) {
+	switch l := l.(type) {
+	case float64:
+		rf, ok := r.(float64)
+		switch {
+		case !ok:
+			return 0, false
+		case l < rf:
+			return -1, true
+		case l > rf:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		rs, ok := r.(string)
+		switch {
+		case !ok:
+			return 0, false
+		case l < rs:
+			return -1, true
+		case l > rs:
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	}
+	return true
+}
@@ -0,0 +1,175 @@
+package rules
+
+import "strconv"
+
+// parser is a recursive-descent parser over:
+//
+//	or      = and { "||" and }
+//	and     = unary { "&&" unary }
+//	unary   = "!" unary | cmp
+//	cmp     = operand [ ("=="|"!="|"<"|"<="|">"|">=") operand ]
+//	operand = selector | string | number | "true" | "false" | "null" | "(" or ")"
+//	selector = ("payload"|"metadata"|"eventType") { "." ident | "[" (string|int) "]" }
+type parser struct {
+	toks []token
+	i    int
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) accept(kind tokenKind, text string) bool {
+	if t := p.peek(); t.kind == kind && t.text == text {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(kind tokenKind, text string) error {
+	if !p.accept(kind, text) {
+		t := p.peek()
+		return &SyntaxError{Pos: t.pos, Msg: "expected " + strconv.Quote(text)}
+	}
+	return nil
+}
+
+func (p *parser) parseOr(depth int) (node, error) {
+	if depth > MaxDepth {
+		return nil, &SyntaxError{Pos: p.peek().pos, Msg: "expression nested too deeply"}
+	}
+	l, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(tokOp, "||") {
+		r, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		l = logical{op: "||", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd(depth int) (node, error) {
+	l, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(tokOp, "&&") {
+		r, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		l = logical{op: "&&", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseUnary(depth int) (node, error) {
+	if p.accept(tokOp, "!") {
+		if depth+1 > MaxDepth {
+			return nil, &SyntaxError{Pos: p.peek().pos, Msg: "expression nested too deeply"}
+		}
+		x, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return not{x: x}, nil
+	}
+	return p.parseCompare(depth)
+}
+
+func (p *parser) parseCompare(depth int) (node, error) {
+	l, err := p.parseOperand(depth)
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	switch t.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+		if t.kind != tokOp {
+			break
+		}
+		p.next()
+		r, err := p.parseOperand(depth)
+		if err != nil {
+			return nil, err
+		}
+		return compare{op: t.text, l: l, r: r}, nil
+	}
+	return l, nil
+}
+
+func (p *parser) parseOperand(depth int) (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		return literal{v: t.text}, nil
+	case tokNumber:
+		return literal{v: t.num}, nil
+	case tokPunct:
+		if t.text == "(" {
+			x, err := p.parseOr(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(tokPunct, ")")
+		}
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return literal{v: true}, nil
+		case "false":
+			return literal{v: false}, nil
+		case "null":
+			return literal{v: nil}, nil
+		case "payload", "metadata", "eventType":
+			return p.parseSelector(t.text)
+		}
+		return nil, &SyntaxError{Pos: t.pos, Msg: "unknown name " + strconv.Quote(t.text) + "; selectors start with payload, metadata or eventType"}
+	case tokEOF:
+		return nil, &SyntaxError{Pos: t.pos, Msg: "unexpected end of expression"}
+	}
+	return nil, &SyntaxError{Pos: t.pos, Msg: "unexpected " + strconv.Quote(t.text)}
+}
+
+func (p *parser) parseSelector(root string) (node, error) {
+	sel := selector{root: root}
+	for {
+		switch {
+		case p.accept(tokPunct, "."):
+			t := p.next()
+			if t.kind != tokIdent {
+				return nil, &SyntaxError{Pos: t.pos, Msg: "expected field name"}
+			}
+			sel.path = append(sel.path, t.text)
+		case p.accept(tokPunct, "["):
+			t := p.next()
+			switch {
+			case t.kind == tokString:
+				sel.path = append(sel.path, t.text)
+			case t.kind == tokNumber && t.num >= 0 && t.num == float64(int(t.num)):
+				sel.path = append(sel.path, int(t.num))
+			default:
+				return nil, &SyntaxError{Pos: t.pos, Msg: "expected field name or index"}
+			}
+			if err := p.expect(tokPunct, "]"); err != nil {
+				return nil, err
+			}
+		default:
+			if len(sel.path) > MaxDepth {
+				return nil, &SyntaxError{Pos: p.peek().pos, Msg: "selector too long"}
+			}
+			return sel, nil
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+var knownTypes = map[string]bool{
+	"null": true, "boolean": true, "object": true, "array": true,
+	"number": true, "integer": true, "string": true,
+}
+
+var knownFormats = map[string]bool{
+	"date-time": true, "date": true, "email": true, "uri": true, "uuid": true,
+}
+
+// unsupported lists standard keywords that would change what validates but
+// are not implemented; ignoring them would accept documents a full
+// validator rejects, so they are compile errors.
+var unsupported = []string{
+	"$id", "$anchor", "$dynamicRef", "$dynamicAnchor", "$recursiveRef", "$recursiveAnchor",
+	"if", "then", "else",
+	"patternProperties", "propertyNames", "dependentRequired", "dependentSchemas", "dependencies",
+	"contains", "minContains", "maxContains",
+	"unevaluatedProperties", "unevaluatedItems",
+	"definitions",
+}
+
+var defRef = regexp.MustCompile(`^#/\$defs/[^/]+$`)
+
+type compiler struct {
+	defs map[string]*node
+	// refs records each $ref target and where it was used.
+	refs map[string]string
+	// nodes records every compiled node and where it was found.
+	nodes map[*node]string
+}
+
+// compile builds the node for the schema v found at the JSON Pointer at.
+func (c *compiler) compile(v any, at string) (*node, error) {
+	if b, ok := v.(bool); ok {
+		return &node{always: &b}, nil
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: schema must be an object or a boolean", where(at))
+	}
+	for _, kw := range unsupported {
+		if _, ok := m[kw]; ok {
+			return nil, fmt.Errorf("%s: %s is not supported", where(at), kw)
+		}
+	}
+	n := &node{}
+	c.nodes[n] = at
+	var err error
+
+	if defs, ok := m["$defs"]; ok {
+		dm, ok := defs.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: $defs must be an object", where(at))
+		}
+		if at != "" {
+			return nil, fmt.Errorf("%s: $defs is only supported at the root", where(at))
+		}
+		for _, name := range sortedKeys(dm) {
+			ref := "#/$defs/" + escape(name)
+			if c.defs[ref], err = c.compile(dm[name], ref[1:]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if ref, ok := m["$ref"]; ok {
+		s, ok := ref.(string)
+		if !ok || (s != "#" && !defRef.MatchString(s)) {
+			return nil, fmt.Errorf(`%s: $ref must be "#" or "#/$defs/<name>"`, where(at))
+		}
+		if c.refs == nil {
+			c.refs = map[string]string{}
+		}
+		c.refs[s] = where(at)
+		n.ref = s
+	}
+
+	if t, ok := m["type"]; ok {
+		switch t := t.(type) {
+		case string:
+			n.types = []string{t}
+		case []any:
+			for _, e := range t {
+				s, _ := e.(string)
+				n.types = append(n.types, s)
+			}
+		}
+		if len(n.types) == 0 {
+			return nil, fmt.Errorf("%s: type must be a string or an array of strings", where(at))
+		}
+		for _, s := range n.types {
+			if !knownTypes[s] {
+				return nil, fmt.Errorf("%s: unknown type %q", where(at), s)
+			}
+		}
+	}
+	if e, ok := m["enum"]; ok {
+		if n.enum, ok = e.([]any); !ok {
+			return nil, fmt.Errorf("%s: enum must be an array", where(at))
+		}
+	}
+	if cv, ok := m["const"]; ok {
+		n.constant = &cv
+	}
+
+	if p, ok := m["properties"]; ok {
+		pm, ok := p.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: properties must be an object", where(at))
+		}
+		n.properties = map[string]*node{}
+		for _, name := range sortedKeys(pm) {
+			if n.properties[name], err = c.compile(pm[name], at+"/properties/"+escape(name)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if r, ok := m["required"]; ok {
+		ra, ok := r.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: required must be an array of strings", where(at))
+		}
+		for _, e := range ra {
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: required must be an array of strings", where(at))
+			}
+			n.required = append(n.required, s)
+		}
+	}
+	if n.additionalProperties, err = c.sub(m, "additionalProperties", at); err != nil {
+		return nil, err
+	}
+	if n.items, err = c.sub(m, "items", at); err != nil {
+		return nil, err
+	}
+	if n.not, err = c.sub(m, "not", at); err != nil {
+		return nil, err
+	}
+	if n.prefixItems, err = c.list(m, "prefixItems", at); err != nil {
+		return nil, err
+	}
+	if n.allOf, err = c.list(m, "allOf", at); err != nil {
+		return nil, err
+	}
+	if n.anyOf, err = c.list(m, "anyOf", at); err != nil {
+		return nil, err
+	}
+	if n.oneOf, err = c.list(m, "oneOf", at); err != nil {
+		return nil, err
+	}
+
+	for kw, dst := range map[string]**int{
+		"minProperties": &n.minProperties, "maxProperties": &n.maxProperties,
+		"minItems": &n.minItems, "maxItems": &n.maxItems,
+		"minLength": &n.minLength, "maxLength": &n.maxLength,
+	} {
+		if v, ok := m[kw]; ok {
+			i, ok := count(v)
+			if !ok {
+				return nil, fmt.Errorf("%s: %s must be a non-negative integer", where(at), kw)
+			}
+			*dst = &i
+		}
+	}
+	for kw, dst := range map[string]**float64{
+		"minimum": &n.minimum, "maximum": &n.maximum,
+		"exclusiveMinimum": &n.exclusiveMinimum, "exclusiveMaximum": &n.exclusiveMaximum,
+		"multipleOf": &n.multipleOf,
+	} {
+		if v, ok := m[kw]; ok {
+			f, ok := number(v)
+			if !ok || (kw == "multipleOf" && f <= 0) {
+				return nil, fmt.Errorf("%s: %s must be a number", where(at), kw)
+			}
+			*dst = &f
+		}
+	}
+	if u, ok := m["uniqueItems"]; ok {
+		if n.uniqueItems, ok = u.(bool); !ok {
+			return nil, fmt.Errorf("%s: uniqueItems must be a boolean", where(at))
+		}
+	}
+	if p, ok := m["pattern"]; ok {
+		s, ok := p.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: pattern must be a string", where(at))
+		}
+		if n.pattern, err = regexp.Compile(s); err != nil {
+			return nil, fmt.Errorf("%s: pattern: %v", where(at), err)
+		}
+	}
+	if f, ok := m["format"]; ok {
+		s, ok := f.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: format must be a string", where(at))
+		}
+		if knownFormats[s] {
+			n.format = s
+		}
+	}
+	return n, nil
+}
+
+// checkCycles rejects $ref cycles that do not consume input: applying a
+// schema to the same value through $ref, allOf, anyOf, oneOf or not until it
+// comes back to itself. Such a schema could never finish validating.
+func (c *compiler) checkCycles() error {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[*node]int{}
+	var visit func(n *node) error
+	visit = func(n *node) error {
+		switch state[n] {
+		case visiting:
+			return fmt.Errorf("%s: $ref cycle does not consume input", where(c.nodes[n]))
+		case done:
+			return nil
+		}
+		state[n] = visiting
+		next := append(append(append([]*node{}, n.allOf...), n.anyOf...), n.oneOf...)
+		if n.not != nil {
+			next = append(next, n.not)
+		}
+		if n.ref != "" {
+			next = append(next, c.defs[n.ref])
+		}
+		for _, m := range next {
+			if err := visit(m); err != nil {
+				return err
+			}
+		}
+		state[n] = done
+		return nil
+	}
+	for _, n := range c.sorted() {
+		if err := visit(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sorted returns the compiled nodes in document order, so errors are
+// reported deterministically.
+func (c *compiler) sorted() []*node {
+	out := make([]*node, 0, len(c.nodes))
+	for n := range c.nodes {
+		out = append(out, n)
+	}
+	sort.Slice(out, func(i, j int) bool { return c.nodes[out[i]] < c.nodes[out[j]] })
+	return out
+}
+
+// sub compiles the subschema under keyword kw, if present.
+func (c *compiler) sub(m map[string]any, kw, at string) (*node, error) {
+	v, ok := m[kw]
+	if !ok {
+		return nil, nil
+	}
+	return c.compile(v, at+"/"+kw)
+}
+
+// list compiles the array of subschemas under keyword kw, if present.
+func (c *compiler) list(m map[string]any, kw, at string) ([]*node, error) {
+	v, ok := m[kw]
+	if !ok {
+		return nil, nil
+	}
+	a, ok := v.([]any)
+	if !ok || len(a) == 0 {
+		return nil, fmt.Errorf("%s: %s must be a non-empty array of schemas", where(at), kw)
+	}
+	out := make([]*node, len(a))
+	for i, e := range a {
+		n, err := c.compile(e, fmt.Sprintf("%s/%s/%d", at, kw, i))
+		if err != nil {
+			return nil, err
+		}
+		out[i] = n
+	}
+	return out, nil
+}
+
+func where(at string) string {
+	if at == "" {
+		return "schema"
+	}
+	return "schema " + at
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func number(v any) (float64, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := n.Float64()
+	return f, err == nil
+}
+
+func count(v any) (int, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	i, err := n.Int64()
+	if err != nil || i < 0 {
+		return 0, false
+	}
+	return int(i), true
+}
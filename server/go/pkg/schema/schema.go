@@ -0,0 +1,153 @@
+// Package schema validates JSON documents against a subset of JSON Schema
+// draft 2020-12, enough to describe event payloads.
+//
+// Supported keywords: type, enum, const; properties, required,
+// additionalProperties, minProperties, maxProperties; items, prefixItems,
+// minItems, maxItems, uniqueItems; minLength, maxLength, pattern, format
+// (date-time, date, email, uri, uuid); minimum, maximum, exclusiveMinimum,
+// exclusiveMaximum, multipleOf; allOf, anyOf, oneOf, not; and $ref to
+// "#" or "#/$defs/<name>", with $defs only at the root. Other standard
+// keywords that affect validation, such as if/then/else, contains or
+// patternProperties, are compile errors rather than being skipped; unknown
+// keywords are ignored, as the specification requires. A keyword with a
+// malformed value, a remote $ref, another $schema dialect or a $ref cycle
+// that does not consume input is a compile error too. Validation stops
+// after MaxSteps.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// Draft is the only $schema value accepted besides none.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// MaxSchemaBytes is the suggested bound on schemas accepted from clients;
+// Compile itself does not enforce it.
+const MaxSchemaBytes = 64 << 10
+
+// MaxErrors bounds the field errors reported for one document.
+const MaxErrors = 50
+
+// FieldError is one validation failure. Path is a JSON Pointer (RFC 6901)
+// to the offending value; "" is the document itself.
+type FieldError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// Schema is a compiled schema, safe for concurrent use.
+type Schema struct {
+	root *node
+	// defs maps "#" and "#/$defs/<name>" to their nodes for $ref.
+	defs map[string]*node
+}
+
+type node struct {
+	// always is set for the boolean schemas true and false.
+	always *bool
+
+	types    []string
+	enum     []any
+	constant *any
+	ref      string
+
+	properties           map[string]*node
+	required             []string
+	additionalProperties *node
+	minProperties        *int
+	maxProperties        *int
+
+	items       *node
+	prefixItems []*node
+	minItems    *int
+	maxItems    *int
+	uniqueItems bool
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+	format    string
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	multipleOf       *float64
+
+	allOf []*node
+	anyOf []*node
+	oneOf []*node
+	not   *node
+}
+
+// Compile parses and checks a schema document.
+func Compile(raw json.RawMessage) (*Schema, error) {
+	doc, err := decode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("schema is not valid JSON: %w", err)
+	}
+	if m, ok := doc.(map[string]any); ok {
+		if v, ok := m["$schema"]; ok && v != Draft {
+			return nil, fmt.Errorf("$schema must be %q", Draft)
+		}
+	}
+	c := &compiler{defs: map[string]*node{}, nodes: map[*node]string{}}
+	root, err := c.compile(doc, "")
+	if err != nil {
+		return nil, err
+	}
+	c.defs["#"] = root
+	for ref, at := range c.refs {
+		if _, ok := c.defs[ref]; !ok {
+			return nil, fmt.Errorf("%s: $ref %q does not resolve", at, ref)
+		}
+	}
+	if err := c.checkCycles(); err != nil {
+		return nil, err
+	}
+	return &Schema{root: root, defs: c.defs}, nil
+}
+
+// Def returns the schema defined under $defs/<name>, sharing this schema's
+// definitions.
+func (s *Schema) Def(name string) (*Schema, bool) {
+	n, ok := s.defs["#/$defs/"+escape(name)]
+	if !ok {
+		return nil, false
+	}
+	return &Schema{root: n, defs: s.defs}, true
+}
+
+// Validate checks a JSON document, returning up to MaxErrors field errors;
+// none means it is valid.
+func (s *Schema) Validate(raw json.RawMessage) []FieldError {
+	doc, err := decode(raw)
+	if err != nil {
+		return []FieldError{{Path: "", Message: "is not valid JSON"}}
+	}
+	v := &validator{defs: s.defs, steps: new(int)}
+	v.validate(s.root, doc, "")
+	if v.exhausted() {
+		v.errs = append(v.errs[:min(len(v.errs), MaxErrors-1)],
+			FieldError{Path: "", Message: fmt.Sprintf("is too costly to validate (over %d schema steps)", MaxSteps)})
+	}
+	return v.errs
+}
+
+func decode(raw json.RawMessage) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("trailing data")
+	}
+	return doc, nil
+}
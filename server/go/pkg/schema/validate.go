@@ -0,0 +1,374 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// maxDepth bounds schema recursion through nested documents.
+const maxDepth = 128
+
+// MaxSteps bounds the schema nodes evaluated for one document, so schemas
+// whose applicators branch (anyOf, oneOf, repeated $refs) cannot make
+// validation exponential.
+const MaxSteps = 100000
+
+type validator struct {
+	defs  map[string]*node
+	errs  []FieldError
+	depth int
+	// steps counts evaluated nodes, shared with the validators of
+	// subschemas.
+	steps *int
+}
+
+func (v *validator) fail(path, format string, args ...any) {
+	if len(v.errs) < MaxErrors {
+		v.errs = append(v.errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+func (v *validator) exhausted() bool {
+	return *v.steps >= MaxSteps
+}
+
+// valid reports whether doc matches n, without recording errors.
+func (v *validator) valid(n *node, doc any, path string) bool {
+	sub := &validator{defs: v.defs, depth: v.depth, steps: v.steps}
+	sub.validate(n, doc, path)
+	return len(sub.errs) == 0 && !v.exhausted()
+}
+
+func (v *validator) validate(n *node, doc any, path string) {
+	if v.exhausted() {
+		return
+	}
+	*v.steps++
+	if v.depth >= maxDepth {
+		v.fail(path, "schema nesting exceeds %d levels", maxDepth)
+		return
+	}
+	v.depth++
+	defer func() { v.depth-- }()
+
+	if n.always != nil {
+		if !*n.always {
+			v.fail(path, "is not allowed")
+		}
+		return
+	}
+	if n.ref != "" {
+		v.validate(v.defs[n.ref], doc, path)
+	}
+	if len(n.types) > 0 && !hasType(doc, n.types) {
+		v.fail(path, "must be of type %s", strings.Join(n.types, " or "))
+		return
+	}
+	if n.enum != nil && !contains(n.enum, doc) {
+		v.fail(path, "must be one of the enumerated values")
+	}
+	if n.constant != nil && !equal(*n.constant, doc) {
+		v.fail(path, "must equal the constant value")
+	}
+
+	switch doc := doc.(type) {
+	case map[string]any:
+		v.object(n, doc, path)
+	case []any:
+		v.array(n, doc, path)
+	case string:
+		v.string(n, doc, path)
+	case json.Number:
+		v.number(n, doc, path)
+	}
+
+	for _, s := range n.allOf {
+		v.validate(s, doc, path)
+	}
+	if n.anyOf != nil {
+		matched := false
+		for _, s := range n.anyOf {
+			if v.valid(s, doc, path) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(path, "must match at least one schema in anyOf")
+		}
+	}
+	if n.oneOf != nil {
+		matched := 0
+		for _, s := range n.oneOf {
+			if v.valid(s, doc, path) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			v.fail(path, "must match exactly one schema in oneOf, matched %d", matched)
+		}
+	}
+	if n.not != nil && v.valid(n.not, doc, path) {
+		v.fail(path, "must not match the schema in not")
+	}
+}
+
+func (v *validator) object(n *node, doc map[string]any, path string) {
+	for _, name := range n.required {
+		if _, ok := doc[name]; !ok {
+			v.fail(path+"/"+escape(name), "is required")
+		}
+	}
+	if n.minProperties != nil && len(doc) < *n.minProperties {
+		v.fail(path, "must have at least %d properties", *n.minProperties)
+	}
+	if n.maxProperties != nil && len(doc) > *n.maxProperties {
+		v.fail(path, "must have at most %d properties", *n.maxProperties)
+	}
+	for _, name := range sortedKeys(doc) {
+		at := path + "/" + escape(name)
+		if s, ok := n.properties[name]; ok {
+			v.validate(s, doc[name], at)
+		} else if n.additionalProperties != nil {
+			if a := n.additionalProperties; a.always != nil && !*a.always {
+				v.fail(at, "is not an allowed property")
+			} else {
+				v.validate(a, doc[name], at)
+			}
+		}
+	}
+}
+
+func (v *validator) array(n *node, doc []any, path string) {
+	if n.minItems != nil && len(doc) < *n.minItems {
+		v.fail(path, "must have at least %d items", *n.minItems)
+	}
+	if n.maxItems != nil && len(doc) > *n.maxItems {
+		v.fail(path, "must have at most %d items", *n.maxItems)
+	}
+	for i, e := range doc {
+		at := path + "/" + strconv.Itoa(i)
+		switch {
+		case i < len(n.prefixItems):
+			v.validate(n.prefixItems[i], e, at)
+		case n.items != nil:
+			v.validate(n.items, e, at)
+		}
+	}
+	if n.uniqueItems {
+		// Items are compared by canonical encoding rather than pairwise, so
+		// the check stays linear in the size of the array.
+		seen := make(map[string]struct{}, len(doc))
+		for i, e := range doc {
+			var b strings.Builder
+			canonical(&b, e)
+			key := b.String()
+			if _, dup := seen[key]; dup {
+				v.fail(path+"/"+strconv.Itoa(i), "duplicates an earlier item")
+				continue
+			}
+			seen[key] = struct{}{}
+		}
+	}
+}
+
+func (v *validator) string(n *node, s, path string) {
+	length := utf8.RuneCountInString(s)
+	if n.minLength != nil && length < *n.minLength {
+		v.fail(path, "must be at least %d characters", *n.minLength)
+	}
+	if n.maxLength != nil && length > *n.maxLength {
+		v.fail(path, "must be at most %d characters", *n.maxLength)
+	}
+	if n.pattern != nil && !n.pattern.MatchString(s) {
+		v.fail(path, "must match pattern %s", n.pattern)
+	}
+	if n.format != "" && !validFormat(n.format, s) {
+		v.fail(path, "must be a valid %s", n.format)
+	}
+}
+
+func (v *validator) number(n *node, num json.Number, path string) {
+	f, err := num.Float64()
+	if err != nil {
+		v.fail(path, "is out of range")
+		return
+	}
+	if n.minimum != nil && f < *n.minimum {
+		v.fail(path, "must be >= %v", *n.minimum)
+	}
+	if n.maximum != nil && f > *n.maximum {
+		v.fail(path, "must be <= %v", *n.maximum)
+	}
+	if n.exclusiveMinimum != nil && f <= *n.exclusiveMinimum {
+		v.fail(path, "must be > %v", *n.exclusiveMinimum)
+	}
+	if n.exclusiveMaximum != nil && f >= *n.exclusiveMaximum {
+		v.fail(path, "must be < %v", *n.exclusiveMaximum)
+	}
+	if n.multipleOf != nil {
+		q := f / *n.multipleOf
+		if math.Abs(q-math.Round(q)) > 1e-9 {
+			v.fail(path, "must be a multiple of %v", *n.multipleOf)
+		}
+	}
+}
+
+func hasType(doc any, types []string) bool {
+	for _, t := range types {
+		switch doc := doc.(type) {
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case map[string]any:
+			if t == "object" {
+				return true
+			}
+		case []any:
+			if t == "array" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case json.Number:
+			if t == "number" {
+				return true
+			}
+			if f, err := doc.Float64(); t == "integer" && err == nil && f == math.Trunc(f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func validFormat(format, s string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, s)
+		return err == nil
+	case "date":
+		_, err := time.Parse(time.DateOnly, s)
+		return err == nil
+	case "email":
+		a, err := mail.ParseAddress(s)
+		return err == nil && a.Address == s
+	case "uri":
+		u, err := url.Parse(s)
+		return err == nil && u.Scheme != ""
+	case "uuid":
+		_, err := uuid.Parse(s)
+		return err == nil && len(s) == 36
+	}
+	return true
+}
+
+func contains(list []any, doc any) bool {
+	for _, e := range list {
+		if equal(e, doc) {
+			return true
+		}
+	}
+	return false
+}
+
+// equal compares JSON values, treating numbers by value so 1 equals 1.0.
+func equal(a, b any) bool {
+	an, aok := a.(json.Number)
+	bn, bok := b.(json.Number)
+	if aok && bok {
+		af, aerr := an.Float64()
+		bf, berr := bn.Float64()
+		return aerr == nil && berr == nil && af == bf
+	}
+	switch a := a.(type) {
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, av := range a {
+			bv, ok := b[k]
+			if !ok || !equal(av, bv) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// canonical writes an encoding of doc under which two values are equal
+// exactly when equal reports them so: numbers by value and object keys in
+// sorted order.
+func canonical(b *strings.Builder, doc any) {
+	switch doc := doc.(type) {
+	case nil:
+		b.WriteString("null")
+	case bool:
+		b.WriteString(strconv.FormatBool(doc))
+	case string:
+		b.WriteString(strconv.Quote(doc))
+	case json.Number:
+		if f, err := doc.Float64(); err == nil {
+			b.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+		} else {
+			b.WriteString("!" + doc.String())
+		}
+	case []any:
+		b.WriteByte('[')
+		for i, e := range doc {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			canonical(b, e)
+		}
+		b.WriteByte(']')
+	case map[string]any:
+		b.WriteByte('{')
+		for i, k := range sortedKeys(doc) {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(strconv.Quote(k))
+			b.WriteByte(':')
+			canonical(b, doc[k])
+		}
+		b.WriteByte('}')
+	default:
+		fmt.Fprintf(b, "%#v", doc)
+	}
+}
+
+// escape encodes a name as a JSON Pointer reference token.
+func escape(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
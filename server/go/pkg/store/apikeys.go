@@ -0,0 +1,212 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// APIKey is a stored credential. Only the SHA-256 hash of the secret is kept;
+// the secret itself is shown once, when the key is created or rotated.
+type APIKey struct {
+	ID         string
+	Name       string
+	Tenant     string
+	Hash       string
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	// Scopes and the optional restrictions are enforced by middleware and
+	// handlers; see middleware.Principal.
+	Scopes            []string
+	EventTypePrefixes []string
+	DestinationHosts  []string
+}
+
+// Active reports whether the key may authenticate at now.
+func (k *APIKey) Active(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+type APIKeyStore interface {
+	// Put inserts or replaces a key by ID.
+	Put(k *APIKey)
+	// Authenticate returns the active key matching secret and records its use.
+	Authenticate(secret string, now time.Time) (*APIKey, bool)
+	Get(id string) (*APIKey, bool)
+	List() []*APIKey
+	Revoke(id string, now time.Time) (*APIKey, error)
+	// Rotate issues a new key with the same attributes and retires the old
+	// one after grace (immediately if grace is zero).
+	Rotate(id string, grace time.Duration, now time.Time) (*APIKey, string, error)
+}
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrAPIKeyRevoked  = errors.New("api key revoked")
+)
+
+// GenerateAPIKey returns a new random secret and its hash.
+func GenerateAPIKey() (secret, hash string) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	secret = "rk_" + base64.RawURLEncoding.EncodeToString(b[:])
+	return secret, HashAPIKey(secret)
+}
+
+func HashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyIDFromHash derives a stable, non-secret ID. Keys seeded from
+// configuration use it so their IDs survive restarts.
+func APIKeyIDFromHash(hash string) string {
+	return "key_" + hash[:16]
+}
+
+type InMemoryAPIKeyStore struct {
+	mu     sync.RWMutex
+	byID   map[string]*APIKey
+	byHash map[string]*APIKey
+}
+
+func NewInMemoryAPIKeyStore() *InMemoryAPIKeyStore {
+	return &InMemoryAPIKeyStore{
+		byID:   make(map[string]*APIKey),
+		byHash: make(map[string]*APIKey),
+	}
+}
+
+func (s *InMemoryAPIKeyStore) Put(k *APIKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.byID[k.ID]; ok {
+		delete(s.byHash, old.Hash)
+	}
+	cp := *k
+	s.byID[k.ID] = &cp
+	s.byHash[k.Hash] = &cp
+}
+
+func (s *InMemoryAPIKeyStore) Authenticate(secret string, now time.Time) (*APIKey, bool) {
+	hash := HashAPIKey(secret)
+
+	s.mu.RLock()
+	k, ok := s.byHash[hash]
+	ok = ok && subtle.ConstantTimeCompare([]byte(k.Hash), []byte(hash)) == 1 && k.Active(now)
+	var cp APIKey
+	if ok {
+		cp = *k
+	}
+	s.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+
+	// Only recording the use needs the write lock. The key may have been
+	// replaced meanwhile, in which case the replacement is left alone.
+	used := now
+	s.mu.Lock()
+	if s.byHash[hash] == k && (k.LastUsedAt == nil || used.After(*k.LastUsedAt)) {
+		k.LastUsedAt = &used
+	}
+	s.mu.Unlock()
+	cp.LastUsedAt = &used
+	return &cp, true
+}
+
+func (s *InMemoryAPIKeyStore) Get(id string) (*APIKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	k, ok := s.byID[id]
+	if !ok {
+		return nil, false
+	}
+	cp := *k
+	return &cp, true
+}
+
+func (s *InMemoryAPIKeyStore) List() []*APIKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*APIKey, 0, len(s.byID))
+	for _, k := range s.byID {
+		cp := *k
+		out = append(out, &cp)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+func (s *InMemoryAPIKeyStore) Revoke(id string, now time.Time) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.byID[id]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	if k.RevokedAt == nil {
+		revoked := now
+		k.RevokedAt = &revoked
+	}
+	cp := *k
+	return &cp, nil
+}
+
+func (s *InMemoryAPIKeyStore) Rotate(id string, grace time.Duration, now time.Time) (*APIKey, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.byID[id]
+	if !ok {
+		return nil, "", ErrAPIKeyNotFound
+	}
+	if old.RevokedAt != nil {
+		return nil, "", ErrAPIKeyRevoked
+	}
+
+	secret, hash := GenerateAPIKey()
+	k := &APIKey{
+		ID:                APIKeyIDFromHash(hash),
+		Name:              old.Name,
+		Tenant:            old.Tenant,
+		Hash:              hash,
+		CreatedAt:         now,
+		ExpiresAt:         old.ExpiresAt,
+		Scopes:            old.Scopes,
+		EventTypePrefixes: old.EventTypePrefixes,
+		DestinationHosts:  old.DestinationHosts,
+	}
+	s.byID[k.ID] = k
+	s.byHash[k.Hash] = k
+
+	if grace > 0 {
+		until := now.Add(grace)
+		if old.ExpiresAt == nil || until.Before(*old.ExpiresAt) {
+			old.ExpiresAt = &until
+		}
+	} else {
+		revoked := now
+		old.RevokedAt = &revoked
+	}
+
+	cp := *k
+	return &cp, secret, nil
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"container/heap"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+)
+
+func (s *InMemoryRelayStore) ClaimCallbacks(now time.Time, lease time.Duration, limit int) []*model.Relay {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []*model.Relay
+	for len(out) < limit && s.callbacks.Len() > 0 && !s.callbacks[0].at.After(now) {
+		e := heap.Pop(&s.callbacks).(scheduleEntry)
+		r, ok := s.byID[e.id]
+		if !ok || r.Callback == nil {
+			continue
+		}
+		cb := r.Callback
+		if cb.Status != model.DeliveryStatusPending || cb.NextAttemptAt == nil || !cb.NextAttemptAt.Equal(e.at) {
+			continue // superseded by a later claim or completion
+		}
+		leaseUntil := now.Add(lease)
+		cb.NextAttemptAt = &leaseUntil
+		heap.Push(&s.callbacks, scheduleEntry{at: leaseUntil, id: r.ID})
+		out = append(out, clone(r))
+	}
+	return out
+}
+
+func (s *InMemoryRelayStore) CompleteCallback(id uuid.UUID, now time.Time, attemptErr error, retryAt *time.Time) (*model.Relay, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.byID[id]
+	if !ok || r.Callback == nil {
+		return nil, ErrDeliveryNotFound
+	}
+	cb := r.Callback
+	attempted := now
+	cb.Attempts++
+	cb.LastAttemptAt = &attempted
+	if cb.Status != model.DeliveryStatusPending {
+		return clone(r), nil
+	}
+
+	switch {
+	case attemptErr == nil:
+		cb.Status = model.DeliveryStatusDelivered
+		cb.DeliveredAt = &attempted
+		cb.NextAttemptAt = nil
+		cb.LastError = nil
+	case retryAt != nil:
+		msg := attemptErr.Error()
+		cb.LastError = &msg
+		at := *retryAt
+		cb.NextAttemptAt = &at
+		heap.Push(&s.callbacks, scheduleEntry{at: at, id: r.ID})
+	default:
+		msg := attemptErr.Error()
+		cb.Status = model.DeliveryStatusFailed
+		cb.LastError = &msg
+		cb.NextAttemptAt = nil
+	}
+	return clone(r), nil
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+)
+
+// DefaultChangeLogSize is how many status changes a relay store keeps per
+// tenant for watchers to resume from.
+const DefaultChangeLogSize = 1000
+
+// ChangeLog is a bounded, in-memory log of relay status changes. Changes
+// are numbered from 1 in the order they happen across tenants, but each
+// tenant keeps its own window of the latest size changes, so a busy tenant
+// cannot push another's changes out.
+type ChangeLog struct {
+	size int
+
+	mu      sync.Mutex
+	seq     uint64
+	tenants map[string]*tenantChanges
+}
+
+type tenantChanges struct {
+	// buf is a ring of up to size changes; once it is full, head is the
+	// index of the oldest and is overwritten next.
+	buf  []model.RelayChange
+	head int
+	// dropped is the sequence number of the latest change dropped from buf.
+	dropped uint64
+	wake    chan struct{}
+}
+
+// at returns the i-th oldest change in buf.
+func (t *tenantChanges) at(i int) model.RelayChange {
+	return t.buf[(t.head+i)%len(t.buf)]
+}
+
+func NewChangeLog(size int) *ChangeLog {
+	return &ChangeLog{size: size, tenants: make(map[string]*tenantChanges)}
+}
+
+// tenant returns the changes of tenant. Must be called with c.mu held.
+func (c *ChangeLog) tenant(tenant string) *tenantChanges {
+	t, ok := c.tenants[tenant]
+	if !ok {
+		t = &tenantChanges{wake: make(chan struct{})}
+		c.tenants[tenant] = t
+	}
+	return t
+}
+
+// Record appends a change for r, which moved from prev to its current
+// status.
+func (c *ChangeLog) Record(r *model.Relay, prev model.RelayStatus, at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	t := c.tenant(r.Tenant)
+	change := model.RelayChange{
+		Seq:            c.seq,
+		RelayID:        r.ID,
+		EventType:      r.EventType,
+		Status:         r.Status,
+		PreviousStatus: prev,
+		At:             at,
+		Tenant:         r.Tenant,
+	}
+	switch {
+	case len(t.buf) < c.size:
+		t.buf = append(t.buf, change)
+	case c.size > 0:
+		t.dropped = t.buf[t.head].Seq
+		t.buf[t.head] = change
+		t.head = (t.head + 1) % c.size
+	default:
+		t.dropped = change.Seq
+	}
+	close(t.wake)
+	t.wake = make(chan struct{})
+}
+
+// Since returns the changes of tenant after seq that are still in the log.
+// truncated reports that some of them were already dropped. wake is closed
+// when the tenant's next change is recorded.
+func (c *ChangeLog) Since(tenant string, seq uint64) (changes []model.RelayChange, truncated bool, wake <-chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := c.tenant(tenant)
+	truncated = t.dropped > seq
+	first := sort.Search(len(t.buf), func(i int) bool { return t.at(i).Seq > seq })
+	for i := first; i < len(t.buf); i++ {
+		changes = append(changes, t.at(i))
+	}
+	return changes, truncated, t.wake
+}
+
+// Last returns the sequence number of the latest change.
+func (c *ChangeLog) Last() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.seq
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"container/heap"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+)
+
+// DeliveryTask is a claimed attempt at one destination of a relay. Relay is
+// a copy taken at claim time.
+type DeliveryTask struct {
+	Relay *model.Relay
+	Index int
+}
+
+func (s *InMemoryRelayStore) ClaimDeliveries(now time.Time, lease time.Duration, limit int) []DeliveryTask {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []DeliveryTask
+	for len(out) < limit && s.due.Len() > 0 && !s.due[0].at.After(now) {
+		e := heap.Pop(&s.due).(scheduleEntry)
+		r, ok := s.byID[e.id]
+		if !ok {
+			continue
+		}
+		d := &r.Deliveries[e.dest]
+		if d.Status != model.DeliveryStatusPending {
+			s.leaseExpired(r, e.dest, e.at, now)
+			continue
+		}
+		if r.Status != model.RelayStatusQueued || d.NextAttemptAt == nil || !d.NextAttemptAt.Equal(e.at) {
+			continue // superseded by a later claim or completion
+		}
+		if !s.atHead(r, e.dest) {
+			continue // re-indexed when it reaches the head of its lane
+		}
+		leaseUntil := now.Add(lease)
+		d.NextAttemptAt = &leaseUntil
+		heap.Push(&s.due, scheduleEntry{at: leaseUntil, id: r.ID, dest: e.dest})
+		s.lease(r, e.dest, leaseUntil)
+		out = append(out, DeliveryTask{Relay: clone(r), Index: e.dest})
+	}
+	return out
+}
+
+func (s *InMemoryRelayStore) CompleteDelivery(id uuid.UUID, index int, now time.Time, attemptErr error, retryAt *time.Time) (*model.Relay, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.byID[id]
+	if !ok || index < 0 || index >= len(r.Deliveries) {
+		return nil, ErrDeliveryNotFound
+	}
+	d := &r.Deliveries[index]
+	attempted := now
+	d.Attempts++
+	d.LastAttemptAt = &attempted
+	leased := s.endLease(r, index)
+	if d.Status != model.DeliveryStatusPending {
+		// Cancelled or expired while the attempt was in flight; its lane
+		// was held until now.
+		if leased {
+			s.release(r, index, now)
+		}
+		return clone(r), nil
+	}
+
+	switch {
+	case attemptErr == nil:
+		d.Status = model.DeliveryStatusDelivered
+		d.DeliveredAt = &attempted
+		d.NextAttemptAt = nil
+		d.LastError = nil
+	case retryAt != nil:
+		msg := attemptErr.Error()
+		d.LastError = &msg
+		at := *retryAt
+		d.NextAttemptAt = &at
+		heap.Push(&s.due, scheduleEntry{at: at, id: r.ID, dest: index})
+	default:
+		msg := attemptErr.Error()
+		d.Status = model.DeliveryStatusFailed
+		d.LastError = &msg
+		d.NextAttemptAt = nil
+	}
+	if d.Status != model.DeliveryStatusPending {
+		s.release(r, index, now)
+	}
+	prev := r.Status
+	settle(r, now)
+	if r.Status != prev {
+		s.transitioned(r, prev, now)
+	}
+	return clone(r), nil
+}
+
+// indexDeliveries makes the pending deliveries of a queued relay due at.
+func (s *InMemoryRelayStore) indexDeliveries(r *model.Relay, at time.Time) {
+	for i := range r.Deliveries {
+		d := &r.Deliveries[i]
+		if d.Status != model.DeliveryStatusPending {
+			continue
+		}
+		due := at
+		d.NextAttemptAt = &due
+		heap.Push(&s.due, scheduleEntry{at: due, id: r.ID, dest: i})
+	}
+}
+
+// settle derives the relay status once every delivery has finished:
+// delivered if all succeeded, failed otherwise.
+func settle(r *model.Relay, now time.Time) {
+	failed := 0
+	for _, d := range r.Deliveries {
+		switch d.Status {
+		case model.DeliveryStatusPending:
+			return
+		case model.DeliveryStatusFailed:
+			failed++
+		}
+	}
+	if failed == 0 {
+		delivered := now
+		r.Status = model.RelayStatusDelivered
+		r.DeliveredAt = &delivered
+		return
+	}
+	reason := fmt.Sprintf("%d of %d destinations failed", failed, len(r.Deliveries))
+	if len(r.Deliveries) == 1 && r.Deliveries[0].LastError != nil {
+		reason = *r.Deliveries[0].LastError
+	}
+	r.Status = model.RelayStatusFailed
+	r.FailureReason = &reason
+}
+
+// skipPending abandons the deliveries a cancelled or expired relay will no
+// longer attempt. Those with an attempt in flight keep their place in
+// their lane until it completes.
+func (s *InMemoryRelayStore) skipPending(r *model.Relay, now time.Time) {
+	for i := range r.Deliveries {
+		if r.Deliveries[i].Status != model.DeliveryStatusPending {
+			continue
+		}
+		r.Deliveries[i].Status = model.DeliveryStatusSkipped
+		r.Deliveries[i].NextAttemptAt = nil
+		if _, inFlight := s.leases[laneEntry{id: r.ID, dest: i}]; !inFlight {
+			s.release(r, i, now)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+)
+
+type EventTypeStore interface {
+	// Create registers a new event type as version 1. It fails with
+	// ErrEventTypeExists if the tenant already has one by that name.
+	Create(et *model.EventType) (*model.EventType, error)
+	// Update replaces an event type's description and schema, adding a
+	// version.
+	Update(tenant, name, description string, schema json.RawMessage, now time.Time) (*model.EventType, error)
+	Get(tenant, name string) (*model.EventType, bool)
+	// List returns a tenant's event types ordered by name.
+	List(tenant string) []*model.EventType
+	// Versions returns an event type's schemas, oldest first.
+	Versions(tenant, name string) ([]model.EventTypeVersion, error)
+	Delete(tenant, name string) error
+}
+
+var (
+	ErrEventTypeNotFound = errors.New("event type not found")
+	ErrEventTypeExists   = errors.New("event type already exists")
+)
+
+type eventTypeKey struct{ tenant, name string }
+
+type registeredType struct {
+	current  model.EventType
+	versions []model.EventTypeVersion
+}
+
+type InMemoryEventTypeStore struct {
+	mu    sync.RWMutex
+	types map[eventTypeKey]*registeredType
+}
+
+func NewInMemoryEventTypeStore() *InMemoryEventTypeStore {
+	return &InMemoryEventTypeStore{types: make(map[eventTypeKey]*registeredType)}
+}
+
+func (s *InMemoryEventTypeStore) Create(et *model.EventType) (*model.EventType, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := eventTypeKey{et.Tenant, et.Name}
+	if _, ok := s.types[k]; ok {
+		return nil, ErrEventTypeExists
+	}
+	rt := &registeredType{current: *et}
+	rt.current.Version = 1
+	rt.current.UpdatedAt = et.CreatedAt
+	rt.versions = []model.EventTypeVersion{{Version: 1, Schema: et.Schema, CreatedAt: et.CreatedAt}}
+	s.types[k] = rt
+	cp := rt.current
+	return &cp, nil
+}
+
+func (s *InMemoryEventTypeStore) Update(tenant, name, description string, schema json.RawMessage, now time.Time) (*model.EventType, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rt, ok := s.types[eventTypeKey{tenant, name}]
+	if !ok {
+		return nil, ErrEventTypeNotFound
+	}
+	rt.current.Description = description
+	rt.current.Schema = schema
+	rt.current.Version++
+	rt.current.UpdatedAt = now
+	rt.versions = append(rt.versions, model.EventTypeVersion{Version: rt.current.Version, Schema: schema, CreatedAt: now})
+	cp := rt.current
+	return &cp, nil
+}
+
+func (s *InMemoryEventTypeStore) Get(tenant, name string) (*model.EventType, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rt, ok := s.types[eventTypeKey{tenant, name}]
+	if !ok {
+		return nil, false
+	}
+	cp := rt.current
+	return &cp, true
+}
+
+func (s *InMemoryEventTypeStore) List(tenant string) []*model.EventType {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []*model.EventType{}
+	for k, rt := range s.types {
+		if k.tenant == tenant {
+			cp := rt.current
+			out = append(out, &cp)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func (s *InMemoryEventTypeStore) Versions(tenant, name string) ([]model.EventTypeVersion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rt, ok := s.types[eventTypeKey{tenant, name}]
+	if !ok {
+		return nil, ErrEventTypeNotFound
+	}
+	return append([]model.EventTypeVersion(nil), rt.versions...), nil
+}
+
+func (s *InMemoryEventTypeStore) Delete(tenant, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := eventTypeKey{tenant, name}
+	if _, ok := s.types[k]; !ok {
+		return ErrEventTypeNotFound
+	}
+	delete(s.types, k)
+	return nil
+}
@@ -9,9 +9,24 @@ import (
 )
 
 type IdempotencyStore interface {
-	GetOrCreate(apiKey, idemKey, payloadHash string, createFn func() (*model.Relay, error)) (*model.Relay, error)
+	GetOrCreate(scope, idemKey, payloadHash string, createFn func() (*model.Relay, error)) (*model.Relay, error)
+	// GetOrCreateAll is GetOrCreate for several keys at once, all or
+	// nothing: if any key conflicts, createFn is not called. createFn gets
+	// the indexes of the keys not recorded yet and returns their relays in
+	// that order; the result holds one relay per key, recorded or new.
+	GetOrCreateAll(scope string, idemKeys, payloadHashes []string, createFn func(missing []int) ([]*model.Relay, error)) ([]*model.Relay, error)
 }
 
+// IdempotencyConflict is the error GetOrCreateAll returns when Index's key
+// was used with a different payload.
+type IdempotencyConflict struct {
+	Index int
+}
+
+func (e *IdempotencyConflict) Error() string { return errIdemConflict.Error() }
+
+func (e *IdempotencyConflict) Unwrap() error { return errIdemConflict }
+
 type idemEntry struct {
 	payloadHash string
 	relay       *model.Relay
@@ -38,9 +53,9 @@ func IsIdempotencyConflict(err error) bool {
 	return errors.Is(err, errIdemConflict)
 }
 
-func (s *InMemoryIdempotencyStore) GetOrCreate(apiKey, idemKey, payloadHash string, createFn func() (*model.Relay, error)) (*model.Relay, error) {
+func (s *InMemoryIdempotencyStore) GetOrCreate(scope, idemKey, payloadHash string, createFn func() (*model.Relay, error)) (*model.Relay, error) {
 	now := time.Now().UTC()
-	k := apiKey + ":" + idemKey
+	k := scope + ":" + idemKey
 
 	s.mu.Lock()
 	// Cleanup opportunistically
@@ -75,3 +90,41 @@ func (s *InMemoryIdempotencyStore) GetOrCreate(apiKey, idemKey, payloadHash stri
 
 	return relay, nil
 }
+
+// GetOrCreateAll holds the store's lock while createFn runs, so no other
+// request can record one of the keys in between; createFn must be quick.
+func (s *InMemoryIdempotencyStore) GetOrCreateAll(scope string, idemKeys, payloadHashes []string, createFn func(missing []int) ([]*model.Relay, error)) ([]*model.Relay, error) {
+	now := time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]*model.Relay, len(idemKeys))
+	var missing []int
+	for i, key := range idemKeys {
+		e, ok := s.m[scope+":"+key]
+		if !ok || now.After(e.expiresAt) {
+			missing = append(missing, i)
+			continue
+		}
+		if e.payloadHash != payloadHashes[i] {
+			return nil, &IdempotencyConflict{Index: i}
+		}
+		out[i] = e.relay
+	}
+	if len(missing) == 0 {
+		return out, nil
+	}
+	created, err := createFn(missing)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range missing {
+		out[i] = created[j]
+		s.m[scope+":"+idemKeys[i]] = idemEntry{
+			payloadHash: payloadHashes[i],
+			relay:       created[j],
+			expiresAt:   now.Add(s.ttl),
+		}
+	}
+	return out, nil
+}
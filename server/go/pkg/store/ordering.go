@@ -0,0 +1,119 @@
+package store
+
+import (
+	"container/heap"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+)
+
+// A lane holds the pending deliveries of relays that share a tenant,
+// ordering key and destination URL, in enqueue order. Only the head of a
+// lane may be claimed; the next delivery becomes due once the head is
+// delivered, failed or skipped. A head skipped while its attempt is in
+// flight holds the lane until the attempt completes or its lease runs out,
+// so the next delivery cannot overtake it.
+type laneEntry struct {
+	id   uuid.UUID
+	dest int
+}
+
+func laneKey(r *model.Relay, d model.Delivery) string {
+	return r.Tenant + "\x00" + r.OrderingKey + "\x00" + d.Destination.URL
+}
+
+// enqueueLanes appends the pending deliveries of an ordered relay to their
+// lanes.
+func (s *InMemoryRelayStore) enqueueLanes(r *model.Relay) {
+	if r.OrderingKey == "" {
+		return
+	}
+	for i, d := range r.Deliveries {
+		if d.Status == model.DeliveryStatusPending {
+			k := laneKey(r, d)
+			s.lanes[k] = append(s.lanes[k], laneEntry{id: r.ID, dest: i})
+		}
+	}
+}
+
+// atHead reports whether a delivery may be attempted under ordering.
+func (s *InMemoryRelayStore) atHead(r *model.Relay, index int) bool {
+	if r.OrderingKey == "" {
+		return true
+	}
+	lane := s.lanes[laneKey(r, r.Deliveries[index])]
+	return len(lane) > 0 && lane[0] == laneEntry{id: r.ID, dest: index}
+}
+
+// release removes a finished delivery from its lane. If it was the head,
+// the next delivery in the lane becomes due.
+func (s *InMemoryRelayStore) release(r *model.Relay, index int, now time.Time) {
+	if r.OrderingKey == "" {
+		return
+	}
+	k := laneKey(r, r.Deliveries[index])
+	lane := s.lanes[k]
+	for i, e := range lane {
+		if e != (laneEntry{id: r.ID, dest: index}) {
+			continue
+		}
+		lane = append(lane[:i], lane[i+1:]...)
+		if len(lane) == 0 {
+			delete(s.lanes, k)
+			return
+		}
+		s.lanes[k] = lane
+		if i == 0 {
+			s.wakeHead(lane[0], now)
+		}
+		return
+	}
+}
+
+// lease records that an ordered delivery was claimed until until.
+func (s *InMemoryRelayStore) lease(r *model.Relay, index int, until time.Time) {
+	if r.OrderingKey != "" {
+		s.leases[laneEntry{id: r.ID, dest: index}] = until
+	}
+}
+
+// endLease forgets the lease of a delivery's attempt and reports whether
+// there was one.
+func (s *InMemoryRelayStore) endLease(r *model.Relay, index int) bool {
+	e := laneEntry{id: r.ID, dest: index}
+	if _, ok := s.leases[e]; !ok {
+		return false
+	}
+	delete(s.leases, e)
+	return true
+}
+
+// leaseExpired releases a delivery skipped in flight whose attempt never
+// completed, once the lease that ended at at runs out.
+func (s *InMemoryRelayStore) leaseExpired(r *model.Relay, index int, at, now time.Time) {
+	if until, ok := s.leases[laneEntry{id: r.ID, dest: index}]; ok && until.Equal(at) {
+		s.endLease(r, index)
+		s.release(r, index, now)
+	}
+}
+
+// wakeHead makes a new lane head due if its relay is queued; a scheduled
+// head is indexed when it is promoted.
+func (s *InMemoryRelayStore) wakeHead(e laneEntry, now time.Time) {
+	r, ok := s.byID[e.id]
+	if !ok || r.Status != model.RelayStatusQueued {
+		return
+	}
+	d := &r.Deliveries[e.dest]
+	if d.Status != model.DeliveryStatusPending {
+		return
+	}
+	// Keep the time it first became due; it has only been waiting its turn.
+	due := now
+	if d.NextAttemptAt != nil {
+		due = *d.NextAttemptAt
+	}
+	d.NextAttemptAt = &due
+	heap.Push(&s.due, scheduleEntry{at: due, id: r.ID, dest: e.dest})
+}
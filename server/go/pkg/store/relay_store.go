@@ -1,67 +1,330 @@
 package store
 
 import (
+	"container/heap"
+	"errors"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/segolab/relay-ref/server/go/pkg/model"
 )
 
 type RelayStore interface {
+	// Create stores a relay. A scheduled relay is also added to the schedule
+	// index by its DeliverAt.
 	Create(r *model.Relay)
 	Get(id uuid.UUID) (*model.Relay, bool)
-	List(pageSize int, offset int) (items []*model.Relay, nextOffset int)
+	// List pages through the relays of one tenant in creation order.
+	List(tenant string, pageSize int, offset int) (items []*model.Relay, nextOffset int)
+	// Cancel moves a queued or scheduled relay to cancelled. It fails with
+	// ErrRelayNotCancellable once the relay is no longer pending.
+	Cancel(id uuid.UUID, now time.Time) (*model.Relay, error)
+	// Delete turns a relay into a tombstone: payload and metadata are dropped
+	// and DeletedAt is set. A pending relay is cancelled as well. Deleting a
+	// tombstone is a no-op.
+	Delete(id uuid.UUID, now time.Time) (*model.Relay, error)
+	// Find returns up to limit relays of one tenant matching f, in creation
+	// order. Tombstones never match.
+	Find(tenant string, f model.RelayFilter, limit int) []*model.Relay
+	// Count returns how many relays Find would return without a limit.
+	Count(tenant string, f model.RelayFilter) int
+	// PromoteDue moves scheduled relays whose DeliverAt is not after now to
+	// queued, in delivery-time order, and returns them.
+	PromoteDue(now time.Time) []*model.Relay
+	// ExpireDue moves pending relays whose ExpiresAt is not after now to
+	// expired, recording the reason in FailureReason, and returns them.
+	ExpireDue(now time.Time) []*model.Relay
+	// ClaimDeliveries leases up to limit pending deliveries of queued relays
+	// that are due at now. A claimed delivery is not handed out again until
+	// the lease runs out or CompleteDelivery schedules it.
+	ClaimDeliveries(now time.Time, lease time.Duration, limit int) []DeliveryTask
+	// CompleteDelivery records one attempt at a delivery. A failed attempt
+	// (attemptErr != nil) is retried at retryAt, or is final if retryAt is
+	// nil. The relay status is settled once no delivery is pending.
+	CompleteDelivery(id uuid.UUID, index int, now time.Time, attemptErr error, retryAt *time.Time) (*model.Relay, error)
+	// ClaimCallbacks leases up to limit status callbacks that are due at
+	// now. A relay with a CallbackURL gets one once it is delivered, failed
+	// or expired.
+	ClaimCallbacks(now time.Time, lease time.Duration, limit int) []*model.Relay
+	// CompleteCallback records one attempt at a relay's callback, like
+	// CompleteDelivery does for a destination.
+	CompleteCallback(id uuid.UUID, now time.Time, attemptErr error, retryAt *time.Time) (*model.Relay, error)
+	// Changes is the log of status changes made by the methods above,
+	// creation included.
+	Changes() *ChangeLog
 }
 
+var (
+	ErrRelayNotFound       = errors.New("relay not found")
+	ErrRelayNotCancellable = errors.New("relay not cancellable")
+	ErrDeliveryNotFound    = errors.New("delivery not found")
+)
+
+// InMemoryRelayStore keeps its own copies of relays; callers never share a
+// pointer with the store, so updates do not race with readers.
 type InMemoryRelayStore struct {
-	mu    sync.RWMutex
-	byID  map[uuid.UUID]*model.Relay
-	order []uuid.UUID
+	mu        sync.RWMutex
+	byID      map[uuid.UUID]*model.Relay
+	order     []uuid.UUID
+	schedule  scheduleIndex
+	expiry    scheduleIndex
+	due       scheduleIndex
+	callbacks scheduleIndex
+	// lanes orders the deliveries of relays with an ordering key, and
+	// leases holds the lease expiry of their attempts in flight; see
+	// ordering.go.
+	lanes   map[string][]laneEntry
+	leases  map[laneEntry]time.Time
+	changes *ChangeLog
 }
 
 func NewInMemoryRelayStore() *InMemoryRelayStore {
 	return &InMemoryRelayStore{
-		byID: make(map[uuid.UUID]*model.Relay),
+		byID:    make(map[uuid.UUID]*model.Relay),
+		lanes:   make(map[string][]laneEntry),
+		leases:  make(map[laneEntry]time.Time),
+		changes: NewChangeLog(DefaultChangeLogSize),
 	}
 }
 
+func (s *InMemoryRelayStore) Changes() *ChangeLog {
+	return s.changes
+}
+
 func (s *InMemoryRelayStore) Create(r *model.Relay) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	r = clone(r)
 	s.byID[r.ID] = r
 	s.order = append(s.order, r.ID)
+	s.enqueueLanes(r)
+	if r.Status == model.RelayStatusScheduled && r.DeliverAt != nil {
+		heap.Push(&s.schedule, scheduleEntry{at: *r.DeliverAt, id: r.ID})
+	}
+	if r.Status == model.RelayStatusQueued {
+		s.indexDeliveries(r, r.CreatedAt)
+	}
+	if r.Status.Pending() && r.ExpiresAt != nil {
+		heap.Push(&s.expiry, scheduleEntry{at: *r.ExpiresAt, id: r.ID})
+	}
+	s.transitioned(r, "", r.CreatedAt)
 }
 
 func (s *InMemoryRelayStore) Get(id uuid.UUID) (*model.Relay, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	r, ok := s.byID[id]
-	return r, ok
+	if !ok {
+		return nil, false
+	}
+	return clone(r), true
 }
 
-func (s *InMemoryRelayStore) List(pageSize int, offset int) ([]*model.Relay, int) {
+func (s *InMemoryRelayStore) List(tenant string, pageSize int, offset int) ([]*model.Relay, int) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	if offset < 0 {
 		offset = 0
 	}
-	if offset >= len(s.order) {
-		return []*model.Relay{}, -1
+
+	out := make([]*model.Relay, 0, pageSize)
+	seen := 0
+	for _, id := range s.order {
+		r := s.byID[id]
+		if r.Tenant != tenant {
+			continue
+		}
+		if seen >= offset {
+			if len(out) == pageSize {
+				// At least one more item exists past this page.
+				return out, seen
+			}
+			out = append(out, clone(r))
+		}
+		seen++
 	}
+	return out, -1
+}
 
-	end := offset + pageSize
-	if end > len(s.order) {
-		end = len(s.order)
+func (s *InMemoryRelayStore) Cancel(id uuid.UUID, now time.Time) (*model.Relay, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.byID[id]
+	if !ok {
+		return nil, ErrRelayNotFound
+	}
+	if !r.Status.Pending() {
+		return nil, ErrRelayNotCancellable
 	}
+	cancelled := now
+	prev := r.Status
+	r.Status = model.RelayStatusCancelled
+	r.CancelledAt = &cancelled
+	s.skipPending(r, now)
+	s.transitioned(r, prev, now)
+	return clone(r), nil
+}
 
-	out := make([]*model.Relay, 0, end-offset)
-	for _, id := range s.order[offset:end] {
-		out = append(out, s.byID[id])
+func (s *InMemoryRelayStore) Delete(id uuid.UUID, now time.Time) (*model.Relay, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.byID[id]
+	if !ok {
+		return nil, ErrRelayNotFound
+	}
+	if r.DeletedAt == nil {
+		if r.Status.Pending() {
+			prev := r.Status
+			r.Status = model.RelayStatusCancelled
+			r.CancelledAt = &now
+			s.skipPending(r, now)
+			s.transitioned(r, prev, now)
+		}
+		deleted := now
+		r.DeletedAt = &deleted
+		r.Payload = nil
+		r.Metadata = nil
+	}
+	return clone(r), nil
+}
+
+func (s *InMemoryRelayStore) Find(tenant string, f model.RelayFilter, limit int) []*model.Relay {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []*model.Relay
+	for _, id := range s.order {
+		if len(out) == limit {
+			break
+		}
+		r := s.byID[id]
+		if r.Tenant != tenant || !matchRelay(r, f) {
+			continue
+		}
+		out = append(out, clone(r))
 	}
+	return out
+}
+
+func (s *InMemoryRelayStore) Count(tenant string, f model.RelayFilter) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	if end >= len(s.order) {
-		return out, -1
+	n := 0
+	for _, id := range s.order {
+		if r := s.byID[id]; r.Tenant == tenant && matchRelay(r, f) {
+			n++
+		}
+	}
+	return n
+}
+
+func hasDestination(r *model.Relay, url string) bool {
+	if r.Destination != nil && r.Destination.URL == url {
+		return true
+	}
+	for _, d := range r.Deliveries {
+		if d.Destination.URL == url {
+			return true
+		}
+	}
+	return false
+}
+
+func matchRelay(r *model.Relay, f model.RelayFilter) bool {
+	switch {
+	case r.DeletedAt != nil:
+		return false
+	case f.Status != "" && r.Status != f.Status:
+		return false
+	case f.EventType != "" && r.EventType != f.EventType:
+		return false
+	case f.DestinationURL != "" && !hasDestination(r, f.DestinationURL):
+		return false
+	case f.CreatedAfter != nil && r.CreatedAt.Before(*f.CreatedAfter):
+		return false
+	case f.CreatedBefore != nil && !r.CreatedAt.Before(*f.CreatedBefore):
+		return false
+	}
+	return true
+}
+
+func (s *InMemoryRelayStore) PromoteDue(now time.Time) []*model.Relay {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []*model.Relay
+	for s.schedule.Len() > 0 && !s.schedule[0].at.After(now) {
+		e := heap.Pop(&s.schedule).(scheduleEntry)
+		r, ok := s.byID[e.id]
+		if !ok || r.Status != model.RelayStatusScheduled {
+			continue // cancelled or deleted since it was scheduled
+		}
+		r.Status = model.RelayStatusQueued
+		s.indexDeliveries(r, now)
+		s.transitioned(r, model.RelayStatusScheduled, now)
+		out = append(out, clone(r))
+	}
+	return out
+}
+
+func (s *InMemoryRelayStore) ExpireDue(now time.Time) []*model.Relay {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []*model.Relay
+	for s.expiry.Len() > 0 && !s.expiry[0].at.After(now) {
+		e := heap.Pop(&s.expiry).(scheduleEntry)
+		r, ok := s.byID[e.id]
+		if !ok || !r.Status.Pending() {
+			continue // finished, cancelled or deleted in the meantime
+		}
+		reason := "expired before delivery"
+		prev := r.Status
+		r.Status = model.RelayStatusExpired
+		r.FailureReason = &reason
+		s.skipPending(r, now)
+		s.transitioned(r, prev, now)
+		out = append(out, clone(r))
+	}
+	return out
+}
+
+// transitioned records a status change. Once a relay with a callback URL
+// has finished, its callback is scheduled.
+func (s *InMemoryRelayStore) transitioned(r *model.Relay, prev model.RelayStatus, now time.Time) {
+	s.changes.Record(r, prev, now)
+	if r.CallbackURL == "" || r.Callback != nil {
+		return
+	}
+	switch r.Status {
+	case model.RelayStatusDelivered, model.RelayStatusFailed, model.RelayStatusExpired:
+	default:
+		return
+	}
+	at := now
+	r.Callback = &model.Delivery{
+		Destination:   model.Destination{Type: model.DestinationWebhook, URL: r.CallbackURL},
+		Status:        model.DeliveryStatusPending,
+		NextAttemptAt: &at,
+	}
+	heap.Push(&s.callbacks, scheduleEntry{at: at, id: r.ID})
+}
+
+// clone copies a relay deeply enough that the store can keep updating its
+// deliveries without racing readers of the copy.
+func clone(r *model.Relay) *model.Relay {
+	cp := *r
+	cp.Deliveries = append([]model.Delivery(nil), r.Deliveries...)
+	if r.Destination != nil {
+		d := *r.Destination
+		cp.Destination = &d
+	}
+	if r.Callback != nil {
+		cb := *r.Callback
+		cp.Callback = &cb
 	}
-	return out, end
+	return &cp
 }
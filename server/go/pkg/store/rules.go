@@ -0,0 +1,130 @@
+package store
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+	"github.com/segolab/relay-ref/server/go/pkg/rules"
+)
+
+type RuleStore interface {
+	// Create stores a rule with its condition, compiled once so relays
+	// are matched without parsing it again. It fails with ErrRuleLimit if
+	// the tenant already has limit rules.
+	Create(r *model.Rule, cond *rules.Expr, limit int) error
+	Get(id uuid.UUID) (*model.Rule, bool)
+	// List returns a tenant's rules in creation order, which is also the
+	// order they are evaluated in.
+	List(tenant string) []*model.Rule
+	// Compiled is List with each rule's compiled condition.
+	Compiled(tenant string) []CompiledRule
+	Delete(id uuid.UUID) error
+}
+
+// CompiledRule is a rule with its compiled condition.
+type CompiledRule struct {
+	Rule *model.Rule
+	Cond *rules.Expr
+}
+
+var (
+	ErrRuleNotFound = errors.New("rule not found")
+	ErrRuleLimit    = errors.New("rule limit reached")
+)
+
+type InMemoryRuleStore struct {
+	mu    sync.RWMutex
+	byID  map[uuid.UUID]*model.Rule
+	conds map[uuid.UUID]*rules.Expr
+	// byTenant holds each tenant's rules in creation order, so matching a
+	// relay only looks at its own tenant's.
+	byTenant map[string][]*model.Rule
+}
+
+func NewInMemoryRuleStore() *InMemoryRuleStore {
+	return &InMemoryRuleStore{
+		byID:     make(map[uuid.UUID]*model.Rule),
+		conds:    make(map[uuid.UUID]*rules.Expr),
+		byTenant: make(map[string][]*model.Rule),
+	}
+}
+
+func (s *InMemoryRuleStore) Create(r *model.Rule, cond *rules.Expr, limit int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := s.byTenant[r.Tenant]
+	if len(list) >= limit {
+		return ErrRuleLimit
+	}
+	cp := *r
+	s.byID[r.ID] = &cp
+	s.conds[r.ID] = cond
+	i := sort.Search(len(list), func(i int) bool {
+		if !list[i].CreatedAt.Equal(cp.CreatedAt) {
+			return cp.CreatedAt.Before(list[i].CreatedAt)
+		}
+		return cp.ID.String() < list[i].ID.String()
+	})
+	s.byTenant[r.Tenant] = slices.Insert(list, i, &cp)
+	return nil
+}
+
+func (s *InMemoryRuleStore) Get(id uuid.UUID) (*model.Rule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.byID[id]
+	if !ok {
+		return nil, false
+	}
+	cp := *r
+	return &cp, true
+}
+
+func (s *InMemoryRuleStore) List(tenant string) []*model.Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.list(tenant)
+}
+
+func (s *InMemoryRuleStore) Compiled(tenant string) []CompiledRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := s.list(tenant)
+	out := make([]CompiledRule, len(list))
+	for i, r := range list {
+		out[i] = CompiledRule{Rule: r, Cond: s.conds[r.ID]}
+	}
+	return out
+}
+
+// list must be called with s.mu held.
+func (s *InMemoryRuleStore) list(tenant string) []*model.Rule {
+	out := make([]*model.Rule, 0, len(s.byTenant[tenant]))
+	for _, r := range s.byTenant[tenant] {
+		cp := *r
+		out = append(out, &cp)
+	}
+	return out
+}
+
+func (s *InMemoryRuleStore) Delete(id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.byID[id]
+	if !ok {
+		return ErrRuleNotFound
+	}
+	delete(s.byID, id)
+	delete(s.conds, id)
+	list := slices.DeleteFunc(s.byTenant[r.Tenant], func(e *model.Rule) bool { return e.ID == id })
+	if len(list) == 0 {
+		delete(s.byTenant, r.Tenant)
+	} else {
+		s.byTenant[r.Tenant] = list
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package store
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// scheduleEntry is one relay waiting in the schedule index.
+type scheduleEntry struct {
+	at time.Time
+	id uuid.UUID
+	// dest is the delivery index for entries of the delivery index.
+	dest int
+}
+
+// scheduleIndex is a min-heap of scheduled relays ordered by delivery time
+// (container/heap); the expiry and delivery indexes reuse it with their own
+// deadlines. Entries are removed lazily: a relay that is cancelled or
+// deleted stays in the heap until it reaches the top and is skipped.
+type scheduleIndex []scheduleEntry
+
+func (h scheduleIndex) Len() int { return len(h) }
+func (h scheduleIndex) Less(i, j int) bool {
+	if !h[i].at.Equal(h[j].at) {
+		return h[i].at.Before(h[j].at)
+	}
+	if h[i].id != h[j].id {
+		return h[i].id.String() < h[j].id.String()
+	}
+	return h[i].dest < h[j].dest
+}
+func (h scheduleIndex) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *scheduleIndex) Push(x any)   { *h = append(*h, x.(scheduleEntry)) }
+func (h *scheduleIndex) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+)
+
+type SubscriptionStore interface {
+	// Create stores a subscription. It fails with ErrSubscriptionLimit if
+	// the tenant already has limit subscriptions.
+	Create(s *model.Subscription, limit int) error
+	Get(id uuid.UUID) (*model.Subscription, bool)
+	// List returns a page of a tenant's subscriptions in creation order and
+	// the offset of the next page, or -1 after the last one.
+	List(tenant string, pageSize int, offset int) ([]*model.Subscription, int)
+	Delete(id uuid.UUID) error
+	// Match returns the tenant's subscriptions that a relay with eventType
+	// and metadata routes to, in creation order.
+	Match(tenant, eventType string, metadata map[string]string) []*model.Subscription
+}
+
+var (
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	ErrSubscriptionLimit    = errors.New("subscription limit reached")
+)
+
+type InMemorySubscriptionStore struct {
+	mu   sync.RWMutex
+	byID map[uuid.UUID]*model.Subscription
+	// byTenant holds each tenant's subscriptions in creation order, so
+	// matching a relay only looks at its own tenant's.
+	byTenant map[string][]*model.Subscription
+}
+
+func NewInMemorySubscriptionStore() *InMemorySubscriptionStore {
+	return &InMemorySubscriptionStore{
+		byID:     make(map[uuid.UUID]*model.Subscription),
+		byTenant: make(map[string][]*model.Subscription),
+	}
+}
+
+func (s *InMemorySubscriptionStore) Create(sub *model.Subscription, limit int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := s.byTenant[sub.Tenant]
+	if len(list) >= limit {
+		return ErrSubscriptionLimit
+	}
+	cp := *sub
+	s.byID[sub.ID] = &cp
+	i := sort.Search(len(list), func(i int) bool {
+		if !list[i].CreatedAt.Equal(cp.CreatedAt) {
+			return cp.CreatedAt.Before(list[i].CreatedAt)
+		}
+		return cp.ID.String() < list[i].ID.String()
+	})
+	s.byTenant[sub.Tenant] = slices.Insert(list, i, &cp)
+	return nil
+}
+
+func (s *InMemorySubscriptionStore) Get(id uuid.UUID) (*model.Subscription, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sub, ok := s.byID[id]
+	if !ok {
+		return nil, false
+	}
+	cp := *sub
+	return &cp, true
+}
+
+func (s *InMemorySubscriptionStore) List(tenant string, pageSize int, offset int) ([]*model.Subscription, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := s.byTenant[tenant]
+	offset = max(offset, 0)
+	if offset >= len(list) {
+		return []*model.Subscription{}, -1
+	}
+	next := -1
+	end := len(list)
+	if offset+pageSize < end {
+		end = offset + pageSize
+		next = end
+	}
+	out := make([]*model.Subscription, 0, end-offset)
+	for _, sub := range list[offset:end] {
+		cp := *sub
+		out = append(out, &cp)
+	}
+	return out, next
+}
+
+func (s *InMemorySubscriptionStore) Delete(id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.byID[id]
+	if !ok {
+		return ErrSubscriptionNotFound
+	}
+	delete(s.byID, id)
+	list := slices.DeleteFunc(s.byTenant[sub.Tenant], func(e *model.Subscription) bool { return e.ID == id })
+	if len(list) == 0 {
+		delete(s.byTenant, sub.Tenant)
+	} else {
+		s.byTenant[sub.Tenant] = list
+	}
+	return nil
+}
+
+func (s *InMemorySubscriptionStore) Match(tenant, eventType string, metadata map[string]string) []*model.Subscription {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []*model.Subscription{}
+	for _, sub := range s.byTenant[tenant] {
+		if sub.Matches(eventType, metadata) {
+			cp := *sub
+			out = append(out, &cp)
+		}
+	}
+	return out
+}
@@ -0,0 +1,342 @@
+// Package transform renders per-destination templates that reshape a relay
+// into an outbound request body and headers. Templates use text/template
+// syntax and see the relay as:
+//
+//	.id         relay ID
+//	.eventType  event type
+//	.metadata   map of metadata values
+//	.payload    decoded JSON payload
+//	.createdAt  RFC 3339 creation time
+//
+// The json function encodes a value as JSON, so a Slack body can be written
+// as {"text": {{json .payload.message}}}. Referencing a missing key is a
+// render error; optional fields are read with index and default, as in
+// {{index .payload "name" | default "anonymous"}}.
+//
+// Rendering is bounded: printf widths and precisions are capped, range
+// bodies may run at most MaxSteps times per render in total, and output is
+// capped at MaxOutputBytes.
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	tree "text/template/parse"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+)
+
+// Limits on templates accepted by Compile and on what Render produces.
+const (
+	MaxTemplateLength = 8 << 10
+	MaxHeaders        = 16
+	MaxOutputBytes    = 1 << 20
+	MaxFormatWidth    = 1024
+	MaxSteps          = 10000
+)
+
+// reservedHeaders are set by the sender and cannot be templated.
+var reservedHeaders = map[string]bool{
+	"Host":              true,
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+}
+
+var funcs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		raw, err := json.Marshal(v)
+		return string(raw), err
+	},
+	"default": func(def, v any) any {
+		if v == nil {
+			return def
+		}
+		return v
+	},
+	"printf": printf,
+}
+
+// stepFunc is called at the start of every range iteration; Render binds it
+// to a per-render counter.
+const stepFunc = "_step"
+
+var stepNode = template.Must(template.New("step").
+	Funcs(template.FuncMap{stepFunc: func() string { return "" }}).
+	Parse("{{" + stepFunc + "}}")).Tree.Root.Nodes[0]
+
+var (
+	errTooManySteps   = fmt.Errorf("template exceeds %d loop iterations", MaxSteps)
+	errFormatTooWide  = fmt.Errorf("printf width and precision must be <= %d", MaxFormatWidth)
+	errFormatStarArgs = errors.New("printf must not take width or precision from arguments")
+)
+
+// printf replaces the builtin so that a template cannot pad its output to
+// an arbitrary size before the output limit applies.
+func printf(format string, args ...any) (string, error) {
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		start := i + 1
+		for i++; i < len(format) && strings.IndexByte("+-# 0123456789.*[]", format[i]) >= 0; i++ {
+		}
+		spec := format[start:i]
+		if strings.Contains(spec, "*") {
+			return "", errFormatStarArgs
+		}
+		for _, n := range strings.FieldsFunc(spec, func(r rune) bool { return r < '0' || r > '9' }) {
+			if v, err := strconv.Atoi(n); err != nil || v > MaxFormatWidth {
+				return "", errFormatTooWide
+			}
+		}
+	}
+	return fmt.Sprintf(format, args...), nil
+}
+
+// Template is a compiled Transform.
+type Template struct {
+	body    *template.Template
+	headers map[string]*template.Template
+}
+
+// Compile parses and checks a transform. A nil transform compiles to a
+// template that passes the payload through unchanged.
+func Compile(t *model.Transform) (*Template, error) {
+	out := &Template{}
+	if t == nil {
+		return out, nil
+	}
+	if t.Body != "" {
+		tmpl, err := parse("body", t.Body)
+		if err != nil {
+			return nil, err
+		}
+		out.body = tmpl
+	}
+	if len(t.Headers) > MaxHeaders {
+		return nil, fmt.Errorf("at most %d headers may be templated", MaxHeaders)
+	}
+	for name, text := range t.Headers {
+		if !httpguts.ValidHeaderFieldName(name) {
+			return nil, fmt.Errorf("invalid header name %q", name)
+		}
+		canonical := http.CanonicalHeaderKey(name)
+		if _, dup := out.headers[canonical]; dup {
+			return nil, fmt.Errorf("header %s is templated more than once", canonical)
+		}
+		if reservedHeaders[canonical] || strings.HasPrefix(canonical, "X-Relay-") {
+			return nil, fmt.Errorf("header %s is set by the relay and cannot be templated", canonical)
+		}
+		tmpl, err := parse("header "+canonical, text)
+		if err != nil {
+			return nil, err
+		}
+		if out.headers == nil {
+			out.headers = make(map[string]*template.Template, len(t.Headers))
+		}
+		out.headers[canonical] = tmpl
+	}
+	return out, nil
+}
+
+func parse(name, text string) (*template.Template, error) {
+	if len(text) > MaxTemplateLength {
+		return nil, fmt.Errorf("%s template must be <= %d bytes", name, MaxTemplateLength)
+	}
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	// Named templates would allow unbounded recursion through {{template}}.
+	for _, t := range tmpl.Templates() {
+		if t.Name() != name {
+			return nil, fmt.Errorf("%s template must not define templates", name)
+		}
+	}
+	if err := countSteps(tmpl.Tree.Root); err != nil {
+		return nil, fmt.Errorf("%s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// countSteps prepends a step call to every range body under n. It rejects
+// {{template}}, whose only possible target is the template itself.
+func countSteps(n tree.Node) error {
+	switch n := n.(type) {
+	case *tree.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, c := range n.Nodes {
+			if err := countSteps(c); err != nil {
+				return err
+			}
+		}
+	case *tree.IfNode:
+		return countBranches(n.List, n.ElseList)
+	case *tree.WithNode:
+		return countBranches(n.List, n.ElseList)
+	case *tree.RangeNode:
+		if err := countBranches(n.List, n.ElseList); err != nil {
+			return err
+		}
+		n.List.Nodes = append([]tree.Node{stepNode}, n.List.Nodes...)
+	case *tree.TemplateNode:
+		return errors.New("templates must not invoke templates")
+	}
+	return nil
+}
+
+func countBranches(list, elseList *tree.ListNode) error {
+	if err := countSteps(list); err != nil {
+		return err
+	}
+	return countSteps(elseList)
+}
+
+// Output is a rendered request.
+type Output struct {
+	Body    []byte
+	Headers map[string]string
+}
+
+// Render applies the template to a relay. Without a body template the
+// payload is passed through.
+func (t *Template) Render(r *model.Relay) (Output, error) {
+	out := Output{Body: r.Payload, Headers: map[string]string{}}
+	if t.body == nil && len(t.headers) == 0 {
+		return out, nil
+	}
+	data, err := data(r)
+	if err != nil {
+		return Output{}, err
+	}
+	steps := 0
+	step := template.FuncMap{stepFunc: func() (string, error) {
+		if steps++; steps > MaxSteps {
+			return "", errTooManySteps
+		}
+		return "", nil
+	}}
+	if t.body != nil {
+		body, err := execute(t.body, step, data)
+		if err != nil {
+			return Output{}, err
+		}
+		out.Body = body
+	}
+	for name, tmpl := range t.headers {
+		value, err := execute(tmpl, step, data)
+		if err != nil {
+			return Output{}, err
+		}
+		if bytes.ContainsAny(value, "\r\n") {
+			return Output{}, fmt.Errorf("header %s rendered a line break", name)
+		}
+		out.Headers[name] = string(value)
+	}
+	return out, nil
+}
+
+// Apply compiles and renders in one step. Compiled templates are cached by
+// source, so retried deliveries do not parse them again.
+func Apply(t *model.Transform, r *model.Relay) (Output, error) {
+	tmpl, err := cached(t)
+	if err != nil {
+		return Output{}, err
+	}
+	return tmpl.Render(r)
+}
+
+const maxCached = 1024
+
+var cache = struct {
+	sync.Mutex
+	byKey map[string]*Template
+}{byKey: map[string]*Template{}}
+
+func cached(t *model.Transform) (*Template, error) {
+	if t == nil {
+		return Compile(nil)
+	}
+	raw, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	key := string(raw)
+	cache.Lock()
+	tmpl, ok := cache.byKey[key]
+	cache.Unlock()
+	if ok {
+		return tmpl, nil
+	}
+	tmpl, err = Compile(t)
+	if err != nil {
+		return nil, err
+	}
+	cache.Lock()
+	if len(cache.byKey) >= maxCached {
+		clear(cache.byKey)
+	}
+	cache.byKey[key] = tmpl
+	cache.Unlock()
+	return tmpl, nil
+}
+
+func data(r *model.Relay) (map[string]any, error) {
+	var payload any
+	if len(r.Payload) > 0 {
+		if err := json.Unmarshal(r.Payload, &payload); err != nil {
+			return nil, err
+		}
+	}
+	metadata := map[string]string{}
+	for k, v := range r.Metadata {
+		metadata[k] = v
+	}
+	return map[string]any{
+		"id":        r.ID.String(),
+		"eventType": r.EventType,
+		"metadata":  metadata,
+		"payload":   payload,
+		"createdAt": r.CreatedAt.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+var errOutputTooLarge = errors.New("rendered output exceeds limit")
+
+type limitedBuffer struct {
+	bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > MaxOutputBytes {
+		return 0, errOutputTooLarge
+	}
+	return b.Buffer.Write(p)
+}
+
+// execute runs a copy of tmpl bound to this render's step counter; the
+// compiled template itself is shared.
+func execute(tmpl *template.Template, step template.FuncMap, data map[string]any) ([]byte, error) {
+	tmpl, err := tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	var buf limitedBuffer
+	if err := tmpl.Funcs(step).Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,222 @@
+package pkg_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/segolab/relay-ref/server/go/pkg/api"
+
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+	"github.com/segolab/relay-ref/server/go/pkg/ratelimit"
+	"github.com/segolab/relay-ref/server/go/pkg/store"
+)
+
+func keyID(secret string) string {
+	return store.APIKeyIDFromHash(store.HashAPIKey(secret))
+}
+
+func adminDo(t *testing.T, method, url, key string, body any) *http.Response {
+	t.Helper()
+	var raw []byte
+	if body != nil {
+		raw, _ = json.Marshal(body)
+	}
+	req, _ := http.NewRequest(method, url, bytes.NewReader(raw))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestAdminRateLimitInspectResetBoost(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	if resp := adminDo(t, "GET", s.URL+"/v1/admin/ratelimits?keyId="+keyID("k"), "k", nil); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-admin key, got %d", resp.StatusCode)
+	}
+
+	for i := 0; i < 3; i++ {
+		postRelay(t, s.URL)
+	}
+
+	resp := adminDo(t, "GET", s.URL+"/v1/admin/ratelimits?keyId="+keyID("k")+"&routeGroup=post_relays", "admin", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var status model.RateLimitStatusResponse
+	_ = json.NewDecoder(resp.Body).Decode(&status)
+	if len(status.Buckets) != 1 || len(status.Buckets[0].RecentDenials) == 0 || status.Buckets[0].Policy.Burst != 2 {
+		t.Fatalf("expected one bucket with a recorded denial, got %+v", status)
+	}
+
+	resp = adminDo(t, "POST", s.URL+"/v1/admin/ratelimits:boost", "admin",
+		model.BoostRateLimitRequest{KeyID: keyID("k"), RouteGroup: "post_relays", Tokens: 5, TTLSeconds: 60})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var boosted model.RateLimitBucket
+	_ = json.NewDecoder(resp.Body).Decode(&boosted)
+	if boosted.Boost == nil || boosted.Tokens < 5 {
+		t.Fatalf("expected boosted bucket, got %+v", boosted)
+	}
+	if code := postRelay(t, s.URL).StatusCode; code != http.StatusCreated {
+		t.Fatalf("expected boosted request to pass, got %d", code)
+	}
+
+	resp = adminDo(t, "POST", s.URL+"/v1/admin/ratelimits:reset", "admin",
+		model.ResetRateLimitRequest{KeyID: keyID("k"), RouteGroup: "post_relays"})
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", resp.StatusCode)
+	}
+	resp = adminDo(t, "GET", s.URL+"/v1/admin/ratelimits?keyId="+keyID("k")+"&routeGroup=post_relays", "admin", nil)
+	status = model.RateLimitStatusResponse{}
+	_ = json.NewDecoder(resp.Body).Decode(&status)
+	if len(status.Buckets) != 0 {
+		t.Fatalf("expected bucket to be dropped after reset, got %+v", status)
+	}
+}
+
+func TestAdminKeyLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	resp := adminDo(t, "POST", s.URL+"/v1/admin/keys", "admin",
+		model.CreateAPIKeyRequest{Name: "producer", Tenant: "acme", Scopes: []string{"relays:read", "relays:write"}})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+	var created model.APIKeySecretResponse
+	_ = json.NewDecoder(resp.Body).Decode(&created)
+	if created.Secret == "" || created.Key.Tenant != "acme" {
+		t.Fatalf("unexpected create response: %+v", created)
+	}
+
+	if code := adminDo(t, "GET", s.URL+"/v1/relays", created.Secret, nil).StatusCode; code != http.StatusOK {
+		t.Fatalf("expected new key to authenticate, got %d", code)
+	}
+
+	resp = adminDo(t, "GET", s.URL+"/v1/admin/keys", "admin", nil)
+	var list model.ListAPIKeysResponse
+	_ = json.NewDecoder(resp.Body).Decode(&list)
+	var found bool
+	for _, k := range list.Items {
+		if k.ID == created.Key.ID {
+			found = k.LastUsedAt != nil
+		}
+	}
+	if !found {
+		t.Fatalf("expected listed key with lastUsedAt, got %+v", list.Items)
+	}
+
+	resp = adminDo(t, "POST", s.URL+"/v1/admin/keys/"+created.Key.ID+":rotate", "admin", nil)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+	var rotated model.APIKeySecretResponse
+	_ = json.NewDecoder(resp.Body).Decode(&rotated)
+	if code := adminDo(t, "GET", s.URL+"/v1/relays", created.Secret, nil).StatusCode; code != http.StatusUnauthorized {
+		t.Fatalf("expected rotated-out key to be rejected, got %d", code)
+	}
+
+	resp = adminDo(t, "POST", s.URL+"/v1/admin/keys/"+rotated.Key.ID+":revoke", "admin", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if code := adminDo(t, "GET", s.URL+"/v1/relays", rotated.Secret, nil).StatusCode; code != http.StatusUnauthorized {
+		t.Fatalf("expected revoked key to be rejected, got %d", code)
+	}
+}
+
+func TestRelaysAreTenantIsolated(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	resp := adminDo(t, "POST", s.URL+"/v1/admin/keys", "admin",
+		model.CreateAPIKeyRequest{Name: "other", Tenant: "other", Scopes: []string{"relays:read"}})
+	var other model.APIKeySecretResponse
+	_ = json.NewDecoder(resp.Body).Decode(&other)
+
+	resp = adminDo(t, "POST", s.URL+"/v1/relays", "k", map[string]any{
+		"eventType":   "x",
+		"destination": map[string]any{"type": "webhook", "url": "https://e"},
+		"payload":     map[string]any{"a": 1},
+	})
+	var relay model.Relay
+	_ = json.NewDecoder(resp.Body).Decode(&relay)
+
+	if code := adminDo(t, "GET", s.URL+"/v1/relays/"+relay.ID.String(), other.Secret, nil).StatusCode; code != http.StatusNotFound {
+		t.Fatalf("expected 404 across tenants, got %d", code)
+	}
+	resp = adminDo(t, "GET", s.URL+"/v1/relays", other.Secret, nil)
+	var list model.ListRelaysResponse
+	_ = json.NewDecoder(resp.Body).Decode(&list)
+	if len(list.Items) != 0 {
+		t.Fatalf("expected no relays for other tenant, got %d", len(list.Items))
+	}
+}
+
+func TestScopedKeys(t *testing.T) {
+	d := newTestDeps(t)
+	d.Limiter = ratelimit.NewTokenBucketLimiter(ratelimit.Config{PostRPS: 50, PostBurst: 100, GetRPS: 50, GetBurst: 100})
+	s := httptest.NewServer(api.NewApp(d).Router)
+	defer s.Close()
+
+	resp := adminDo(t, "POST", s.URL+"/v1/admin/keys", "admin", model.CreateAPIKeyRequest{
+		Name:              "orders",
+		Tenant:            "default",
+		Scopes:            []string{"relays:write"},
+		EventTypePrefixes: []string{"order."},
+		DestinationHosts:  []string{"*.example.com"},
+	})
+	var key model.APIKeySecretResponse
+	_ = json.NewDecoder(resp.Body).Decode(&key)
+
+	create := func(eventType, url string) *http.Response {
+		return adminDo(t, "POST", s.URL+"/v1/relays", key.Secret, map[string]any{
+			"eventType":   eventType,
+			"destination": map[string]any{"type": "webhook", "url": url},
+			"payload":     map[string]any{"a": 1},
+		})
+	}
+
+	if code := create("order.created", "https://hooks.example.com/x").StatusCode; code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	if code := create("user.created", "https://hooks.example.com/x").StatusCode; code != http.StatusForbidden {
+		t.Fatalf("expected 403 for eventType outside prefix, got %d", code)
+	}
+	if code := create("order.created", "https://evil.test/x").StatusCode; code != http.StatusForbidden {
+		t.Fatalf("expected 403 for destination host, got %d", code)
+	}
+	// The wildcard matches whole labels only.
+	for _, url := range []string{"https://evilexample.com/x", "https://example.com/x"} {
+		if code := create("order.created", url).StatusCode; code != http.StatusForbidden {
+			t.Fatalf("expected 403 for %s, got %d", url, code)
+		}
+	}
+
+	resp = adminDo(t, "GET", s.URL+"/v1/relays", key.Secret, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 without relays:read, got %d", resp.StatusCode)
+	}
+	var e model.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Code != "forbidden" || e.RequestID == nil {
+		t.Fatalf("expected forbidden ErrorResponse, got %+v (%v)", e, err)
+	}
+
+	for _, host := range []string{"*example.com", "*", "hooks.*.com"} {
+		resp := adminDo(t, "POST", s.URL+"/v1/admin/keys", "admin", model.CreateAPIKeyRequest{
+			Name: "bad", Tenant: "default", Scopes: []string{"relays:write"}, DestinationHosts: []string{host},
+		})
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected 400 for destination host %q, got %d", host, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package pkg_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/segolab/relay-ref/server/go/pkg/admission"
+)
+
+func TestAdmissionReservesCapacityForPriority(t *testing.T) {
+	c := admission.NewController(admission.Config{MaxInFlight: 4, PriorityReserve: 0.5})
+
+	var releases []func(time.Duration)
+	for i := 0; i < 2; i++ {
+		rel, ok := c.Acquire(false)
+		if !ok {
+			t.Fatalf("normal request %d should be admitted", i)
+		}
+		releases = append(releases, rel)
+	}
+	if _, ok := c.Acquire(false); ok {
+		t.Fatalf("normal request should be shed once the reserve is reached")
+	}
+	for i := 0; i < 2; i++ {
+		rel, ok := c.Acquire(true)
+		if !ok {
+			t.Fatalf("priority request %d should use the reserve", i)
+		}
+		releases = append(releases, rel)
+	}
+	if _, ok := c.Acquire(true); ok {
+		t.Fatalf("priority request should be shed at the limit")
+	}
+
+	for _, rel := range releases {
+		rel(time.Millisecond)
+	}
+	if c.InFlight() != 0 {
+		t.Fatalf("expected 0 in flight, got %d", c.InFlight())
+	}
+}
+
+func TestAdmissionAdaptiveLimitBacksOff(t *testing.T) {
+	c := admission.NewController(admission.Config{
+		MaxInFlight:   10,
+		MinLimit:      2,
+		Adaptive:      true,
+		TargetLatency: 10 * time.Millisecond,
+		Backoff:       0.5,
+	})
+
+	for i := 0; i < 5; i++ {
+		rel, ok := c.Acquire(true)
+		if !ok {
+			t.Fatal("expected admission")
+		}
+		rel(time.Second)
+	}
+	if c.Limit() != 2 {
+		t.Fatalf("expected limit to back off to the minimum, got %d", c.Limit())
+	}
+
+	for i := 0; i < 50; i++ {
+		rel, _ := c.Acquire(true)
+		rel(time.Millisecond)
+	}
+	if c.Limit() <= 2 {
+		t.Fatalf("expected limit to recover, got %d", c.Limit())
+	}
+}
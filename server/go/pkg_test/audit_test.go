@@ -0,0 +1,111 @@
+package pkg_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/segolab/relay-ref/server/go/pkg/api"
+	"github.com/segolab/relay-ref/server/go/pkg/audit"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+)
+
+func TestAuditEventsAreQueryable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := audit.OpenFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	d := newTestDeps(t)
+	d.Audit = audit.NewLog(d.Logger, 100, sink)
+	s := httptest.NewServer(api.NewApp(d).Router)
+	defer s.Close()
+
+	adminDo(t, "GET", s.URL+"/v1/relays", "wrong-key", nil)
+	adminDo(t, "POST", s.URL+"/v1/admin/keys", "admin",
+		model.CreateAPIKeyRequest{Name: "p", Tenant: "acme", Scopes: []string{"relays:read"}})
+
+	resp := adminDo(t, "GET", s.URL+"/v1/admin/audit?type=auth.failure", "admin", nil)
+	var list model.ListAuditEventsResponse
+	_ = json.NewDecoder(resp.Body).Decode(&list)
+	if len(list.Items) != 1 || list.Items[0].RequestID == "" || list.Items[0].SourceIP == "" {
+		t.Fatalf("expected one auth failure with request context, got %+v", list.Items)
+	}
+
+	resp = adminDo(t, "GET", s.URL+"/v1/admin/audit?type=key.created", "admin", nil)
+	list = model.ListAuditEventsResponse{}
+	_ = json.NewDecoder(resp.Body).Decode(&list)
+	if len(list.Items) != 1 || list.Items[0].Tenant != "default" || list.Items[0].Details["keyTenant"] != "acme" {
+		t.Fatalf("expected key.created event, got %+v", list.Items)
+	}
+
+	d.Audit.Flush()
+	raw, _ := os.ReadFile(path)
+	if n, err := audit.VerifyChain(bytes.NewReader(raw)); err != nil || n != 2 {
+		t.Fatalf("expected intact chain of 2 records, got %d (%v)", n, err)
+	}
+
+	tampered := bytes.Replace(raw, []byte(`"acme"`), []byte(`"evil"`), 1)
+	if _, err := audit.VerifyChain(bytes.NewReader(tampered)); !errors.Is(err, audit.ErrChainBroken) {
+		t.Fatalf("expected tampering to be detected, got %v", err)
+	}
+
+	if code := adminDo(t, "GET", s.URL+"/v1/admin/audit", "k", nil).StatusCode; code != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-admin, got %d", code)
+	}
+}
+
+func TestAuditChainSurvivesPartialLastLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := audit.OpenFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Write(audit.Event{Type: audit.TypeKeyCreated}); err != nil {
+		t.Fatal(err)
+	}
+	sink.Close()
+
+	// A crash mid-write leaves an unterminated record behind.
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	_, _ = f.WriteString(`{"time":"2026-01-01T00:00:00Z","type":"key.rev`)
+	f.Close()
+
+	sink, err = audit.OpenFileSink(path)
+	if err != nil {
+		t.Fatalf("expected the partial line to be dropped, got %v", err)
+	}
+	if err := sink.Write(audit.Event{Type: audit.TypeKeyRevoked}); err != nil {
+		t.Fatal(err)
+	}
+	sink.Close()
+
+	raw, _ := os.ReadFile(path)
+	if n, err := audit.VerifyChain(bytes.NewReader(raw)); err != nil || n != 2 {
+		t.Fatalf("expected an intact chain of 2 records, got %d (%v)", n, err)
+	}
+}
+
+func TestAuditLogWritesInOrder(t *testing.T) {
+	var buf bytes.Buffer
+	log := audit.NewLog(newTestDeps(t).Logger, 4, audit.NewWriterSink(&buf))
+	for i := 0; i < 20; i++ {
+		log.Record(audit.Event{Type: audit.TypeAuthFailure, Details: map[string]any{"i": i}})
+	}
+	log.Close()
+
+	dec := json.NewDecoder(&buf)
+	for i := 0; i < 20; i++ {
+		var e audit.Event
+		if err := dec.Decode(&e); err != nil || e.Details["i"] != float64(i) {
+			t.Fatalf("record %d: got %+v (%v)", i, e, err)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package pkg_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/segolab/relay-ref/server/go/pkg/api"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+)
+
+func postBatch(t *testing.T, baseURL, body string) (*http.Response, []byte) {
+	t.Helper()
+	req, _ := http.NewRequest("POST", baseURL+"/v1/relays:batch", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "k")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var buf bytes.Buffer
+	_, _ = buf.ReadFrom(resp.Body)
+	return resp, buf.Bytes()
+}
+
+func TestBatchCreate(t *testing.T) {
+	s := newHighBurstTestServer(t)
+	defer s.Close()
+
+	body := `{"items":[
+		{"eventType":"a","destination":{"type":"webhook","url":"https://e"},"payload":{"n":1},"idempotencyKey":"b1"},
+		{"eventType":"","destination":{"type":"webhook","url":"https://e"},"payload":{"n":2}},
+		{"eventType":"c","destination":{"type":"webhook","url":"https://e"},"payload":{"n":3}}
+	]}`
+	resp, raw := postBatch(t, s.URL, body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, raw)
+	}
+	if got := resp.Header.Get("RateLimit-Remaining"); got != "2" {
+		t.Fatalf("expected batch to cost 3 tokens, remaining %q", got)
+	}
+	var out model.BatchCreateRelaysResponse
+	if err := json.Unmarshal(raw, &out); err != nil {
+		t.Fatal(err)
+	}
+	want := []model.BatchItemStatus{model.BatchItemCreated, model.BatchItemError, model.BatchItemCreated}
+	for i, st := range want {
+		if out.Items[i].Index != i || out.Items[i].Status != st {
+			t.Fatalf("item %d: expected %s, got %+v", i, st, out.Items[i])
+		}
+	}
+	if out.Items[1].Error == nil || out.Items[1].Error.Code != "invalid_request" {
+		t.Fatalf("expected item error body, got %+v", out.Items[1].Error)
+	}
+
+	// Replaying the keyed item returns the same relay.
+	resp, raw = postBatch(t, s.URL, `{"items":[
+		{"eventType":"a","destination":{"type":"webhook","url":"https://e"},"payload":{"n":1},"idempotencyKey":"b1"}
+	]}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, raw)
+	}
+	var replay model.BatchCreateRelaysResponse
+	_ = json.Unmarshal(raw, &replay)
+	if replay.Items[0].Status != model.BatchItemReplayed || replay.Items[0].Relay.ID != out.Items[0].Relay.ID {
+		t.Fatalf("expected replay of %s, got %+v", out.Items[0].Relay.ID, replay.Items[0])
+	}
+
+	// One token left; a batch of two exceeds it.
+	resp, _ = postBatch(t, s.URL, `{"items":[
+		{"eventType":"a","destination":{"type":"webhook","url":"https://e"},"payload":{}},
+		{"eventType":"a","destination":{"type":"webhook","url":"https://e"},"payload":{}}
+	]}`)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", resp.StatusCode)
+	}
+}
+
+func TestBatchAllOrNothing(t *testing.T) {
+	s := newHighBurstTestServer(t)
+	defer s.Close()
+
+	resp, raw := postBatch(t, s.URL, `{"allOrNothing":true,"items":[
+		{"eventType":"a","destination":{"type":"webhook","url":"https://e"},"payload":{},"idempotencyKey":"dup"},
+		{"eventType":"b","destination":{"type":"webhook","url":"https://e"},"payload":{},"idempotencyKey":"dup"}
+	]}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", resp.StatusCode, raw)
+	}
+	var e model.ErrorResponse
+	_ = json.Unmarshal(raw, &e)
+	if e.Code != "batch_rejected" {
+		t.Fatalf("expected batch_rejected, got %q", e.Code)
+	}
+
+	// An item without subscribers fails the batch too, though it is only
+	// found when the batch is routed.
+	resp, raw = postBatch(t, s.URL, `{"allOrNothing":true,"items":[
+		{"eventType":"a","destination":{"type":"webhook","url":"https://e"},"payload":{},"idempotencyKey":"k1"},
+		{"eventType":"unrouted","payload":{}}
+	]}`)
+	_ = json.Unmarshal(raw, &e)
+	if resp.StatusCode != http.StatusBadRequest || e.Code != "batch_rejected" {
+		t.Fatalf("expected 400 batch_rejected, got %d: %s", resp.StatusCode, raw)
+	}
+
+	req, _ := http.NewRequest("GET", s.URL+"/v1/relays", nil)
+	req.Header.Set("X-API-Key", "k")
+	listResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listResp.Body.Close()
+	var list model.ListRelaysResponse
+	_ = json.NewDecoder(listResp.Body).Decode(&list)
+	if len(list.Items) != 0 {
+		t.Fatalf("expected nothing created, got %d relays", len(list.Items))
+	}
+}
+
+func TestBatchAllOrNothingReplaysKeyedItems(t *testing.T) {
+	s := newHighBurstTestServer(t)
+	defer s.Close()
+
+	item := `{"eventType":"a","destination":{"type":"webhook","url":"https://e"},"payload":{},"idempotencyKey":"k1"}`
+	resp, raw := postBatch(t, s.URL, `{"allOrNothing":true,"items":[`+item+`]}`)
+	var first model.BatchCreateRelaysResponse
+	if resp.StatusCode != http.StatusOK || json.Unmarshal(raw, &first) != nil {
+		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, raw)
+	}
+
+	resp, raw = postBatch(t, s.URL, `{"allOrNothing":true,"items":[`+item+`,
+		{"eventType":"b","destination":{"type":"webhook","url":"https://e"},"payload":{}}
+	]}`)
+	var second model.BatchCreateRelaysResponse
+	if resp.StatusCode != http.StatusOK || json.Unmarshal(raw, &second) != nil {
+		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, raw)
+	}
+	if second.Items[0].Status != model.BatchItemReplayed || second.Items[0].Relay.ID != first.Items[0].Relay.ID {
+		t.Fatalf("expected the keyed item to be replayed, got %+v", second.Items[0])
+	}
+	if second.Items[1].Status != model.BatchItemCreated {
+		t.Fatalf("expected the new item to be created, got %+v", second.Items[1])
+	}
+
+	resp, raw = postBatch(t, s.URL, `{"allOrNothing":true,"items":[
+		{"eventType":"c","destination":{"type":"webhook","url":"https://e"},"payload":{}},
+		{"eventType":"changed","destination":{"type":"webhook","url":"https://e"},"payload":{},"idempotencyKey":"k1"}
+	]}`)
+	var e model.ErrorResponse
+	_ = json.Unmarshal(raw, &e)
+	if resp.StatusCode != http.StatusBadRequest || e.Code != "batch_rejected" {
+		t.Fatalf("expected 400 batch_rejected for a reused key, got %d: %s", resp.StatusCode, raw)
+	}
+}
+
+func TestBatchLargerThanBurstIsRejected(t *testing.T) {
+	s := newBurstTestServer(t, 2)
+	defer s.Close()
+
+	// Three items cost more than the bucket can ever hold.
+	body := `{"items":[
+		{"eventType":"a","destination":{"type":"webhook","url":"https://e"},"payload":{}},
+		{"eventType":"a","destination":{"type":"webhook","url":"https://e"},"payload":{}},
+		{"eventType":"a","destination":{"type":"webhook","url":"https://e"},"payload":{}}
+	]}`
+	resp, raw := postBatch(t, s.URL, body)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", resp.StatusCode, raw)
+	}
+	// Two items are charged in full, draining the bucket.
+	body = `{"items":[
+		{"eventType":"a","destination":{"type":"webhook","url":"https://e"},"payload":{}},
+		{"eventType":"a","destination":{"type":"webhook","url":"https://e"},"payload":{}}
+	]}`
+	if resp, raw := postBatch(t, s.URL, body); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, raw)
+	}
+	if resp, _ := postBatch(t, s.URL, body); resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 once the bucket is drained, got %d", resp.StatusCode)
+	}
+}
+
+func TestBatchItemsAreHeldToTheRelaySizeLimit(t *testing.T) {
+	s := newHighBurstTestServer(t)
+	defer s.Close()
+
+	// The test server caps single relays at 32 KiB and batches at 64 KiB.
+	big := `{"blob":"` + strings.Repeat("x", 40000) + `"}`
+	body := `{"items":[
+		{"eventType":"a","destination":{"type":"webhook","url":"https://e"},"payload":` + big + `},
+		{"eventType":"a","destination":{"type":"webhook","url":"https://e"},"payload":{}}
+	]}`
+	resp, raw := postBatch(t, s.URL, body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, raw)
+	}
+	var out model.BatchCreateRelaysResponse
+	if err := json.Unmarshal(raw, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Items[0].Status != model.BatchItemError || out.Items[0].Error.Code != "invalid_request" {
+		t.Fatalf("expected the oversized item to fail, got %+v", out.Items[0])
+	}
+	if out.Items[1].Status != model.BatchItemCreated {
+		t.Fatalf("expected the small item to be created, got %+v", out.Items[1])
+	}
+}
+
+func TestBatchMaxItemsMustFitTheBurst(t *testing.T) {
+	t.Setenv("RELAY_LIMIT_POST_BURST", "10")
+	t.Setenv("RELAY_BATCH_MAX_ITEMS", "11")
+	if _, err := api.LoadConfigFromEnv(); err == nil {
+		t.Fatal("expected a batch size above the burst to be rejected")
+	}
+	t.Setenv("RELAY_BATCH_MAX_ITEMS", "10")
+	if _, err := api.LoadConfigFromEnv(); err != nil {
+		t.Fatalf("expected a batch size equal to the burst to be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package pkg_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/segolab/relay-ref/server/go/pkg/api"
+	"github.com/segolab/relay-ref/server/go/pkg/delivery"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+	"github.com/segolab/relay-ref/server/go/pkg/store"
+)
+
+func TestStatusCallbacks(t *testing.T) {
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer hook.Close()
+	var calls atomic.Int32
+	var got model.StatusCallback
+	var signatureOK atomic.Bool
+	var tenantSecret string
+	producer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &got)
+		var ts int64
+		var sig string
+		for _, part := range strings.Split(r.Header.Get("X-Relay-Signature"), ",") {
+			k, v, _ := strings.Cut(part, "=")
+			switch k {
+			case "t":
+				ts, _ = strconv.ParseInt(v, 10, 64)
+			case "v1":
+				sig = v
+			}
+		}
+		signatureOK.Store(sig == delivery.SignCallback(tenantSecret, ts, body))
+	}))
+	defer producer.Close()
+
+	d := newTestDeps(t)
+	d.Config.CallbackSecret = "s3cret"
+	s := httptest.NewServer(api.NewApp(d).Router)
+	defer s.Close()
+	code, secret := relayDo(t, "GET", s.URL+"/v1/callback-secret", nil, "")
+	if code != http.StatusOK || secret["tenant"] != "default" || secret["secret"] == "" || secret["secret"] == "s3cret" {
+		t.Fatalf("expected the tenant's own callback secret, got %d %v", code, secret)
+	}
+	tenantSecret = secret["secret"].(string)
+	if other := delivery.TenantSecret("s3cret", "other"); other == tenantSecret {
+		t.Fatal("expected tenants to have different callback secrets")
+	}
+	dispatcher := &delivery.Dispatcher{
+		Log:         slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)),
+		Store:       d.RelayStore,
+		Sender:      delivery.WebhookSender{},
+		Concurrency: 4,
+		Timeout:     5 * time.Second,
+		MaxAttempts: 1,
+
+		Callbacks:           &delivery.CallbackSender{Secret: "s3cret"},
+		CallbackMaxAttempts: 3,
+		CallbackBackoffBase: time.Minute,
+		CallbackBackoffMax:  time.Hour,
+	}
+
+	code, m := relayDo(t, "POST", s.URL+"/v1/relays", []byte(`{"eventType":"order.created",
+		"destination":{"type":"webhook","url":"`+hook.URL+`"},"payload":{},"callbackUrl":"`+producer.URL+`"}`), "")
+	if code != http.StatusCreated || m["callbackUrl"] != producer.URL {
+		t.Fatalf("expected 201 with callbackUrl, got %d %v", code, m)
+	}
+	id := m["id"].(string)
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	dispatcher.Tick(ctx, now) // delivers the relay
+	if n := dispatcher.Tick(ctx, now.Add(time.Second)); n != 1 {
+		t.Fatalf("expected the callback to be attempted, got %d attempts", n)
+	}
+	_, relay := relayDo(t, "GET", s.URL+"/v1/relays/"+id, nil, "")
+	if cb := relay["callback"].(map[string]any); cb["status"] != "pending" || cb["attempts"] != float64(1) {
+		t.Fatalf("expected the failed callback to be retried, got %v", cb)
+	}
+
+	if n := dispatcher.Tick(ctx, now.Add(2*time.Minute)); n != 1 {
+		t.Fatalf("expected the callback retry, got %d attempts", n)
+	}
+	_, relay = relayDo(t, "GET", s.URL+"/v1/relays/"+id, nil, "")
+	if cb := relay["callback"].(map[string]any); cb["status"] != "delivered" {
+		t.Fatalf("expected the callback delivered, got %v", cb)
+	}
+	if got.RelayID.String() != id || got.Status != model.RelayStatusDelivered || !signatureOK.Load() {
+		t.Fatalf("unexpected callback %+v (signature ok: %v)", got, signatureOK.Load())
+	}
+}
+
+func TestStatusCallbacksRequireSecret(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	code, m := relayDo(t, "POST", s.URL+"/v1/relays", []byte(`{"eventType":"x",
+		"destination":{"type":"webhook","url":"https://a"},"payload":{},"callbackUrl":"https://producer"}`), "")
+	if code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a callback secret, got %d %v", code, m)
+	}
+	if code, m := relayDo(t, "GET", s.URL+"/v1/callback-secret", nil, ""); code != http.StatusNotFound {
+		t.Fatalf("expected 404 without a callback secret, got %d %v", code, m)
+	}
+}
+
+type failingSender struct{}
+
+func (failingSender) Send(_ context.Context, _ *model.Relay, _ model.Delivery) error {
+	return errors.New("unavailable")
+}
+
+func TestCallbacksAreNotStarvedByDeliveries(t *testing.T) {
+	var calls atomic.Int32
+	producer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { calls.Add(1) }))
+	defer producer.Close()
+
+	relays := store.NewInMemoryRelayStore()
+	dispatcher := &delivery.Dispatcher{
+		Log:         slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)),
+		Store:       relays,
+		Sender:      failingSender{},
+		Concurrency: 4,
+		Timeout:     5 * time.Second,
+		MaxAttempts: 1,
+
+		Callbacks:           &delivery.CallbackSender{Secret: "s3cret"},
+		CallbackMaxAttempts: 3,
+		CallbackBackoffBase: time.Minute,
+		CallbackBackoffMax:  time.Hour,
+	}
+	now := time.Now().UTC()
+	dest := model.Destination{Type: model.DestinationWebhook, URL: "https://e"}
+	newRelay := func(callbackURL string) {
+		relays.Create(&model.Relay{
+			ID: uuid.New(), Tenant: "default", EventType: "x", Payload: json.RawMessage(`{}`),
+			Destination: &dest, Status: model.RelayStatusQueued, CreatedAt: now, CallbackURL: callbackURL,
+			Deliveries: []model.Delivery{{Destination: dest, Status: model.DeliveryStatusPending}},
+		})
+	}
+
+	newRelay(producer.URL)
+	if n := dispatcher.Tick(context.Background(), now); n != 1 {
+		t.Fatalf("expected the relay to be attempted, got %d attempts", n)
+	}
+	for i := 0; i < 10; i++ {
+		newRelay("")
+	}
+	if n := dispatcher.Tick(context.Background(), now.Add(time.Second)); n != 4 {
+		t.Fatalf("expected a full tick, got %d attempts", n)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("expected the callback to be sent despite the delivery backlog, got %d calls", calls.Load())
+	}
+}
@@ -0,0 +1,82 @@
+package pkg_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func relayDo(t *testing.T, method, url string, body []byte, idemKey string) (int, map[string]any) {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "k")
+	if idemKey != "" {
+		req.Header.Set("Idempotency-Key", idemKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var m map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&m)
+	return resp.StatusCode, m
+}
+
+func TestCancelRelay(t *testing.T) {
+	s := newHighBurstTestServer(t)
+	defer s.Close()
+
+	raw := []byte(`{"eventType":"x","destination":{"type":"webhook","url":"https://e"},"payload":{"a":1}}`)
+	code, created := relayDo(t, "POST", s.URL+"/v1/relays", raw, "")
+	if code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	id := created["id"].(string)
+
+	code, cancelled := relayDo(t, "POST", s.URL+"/v1/relays/"+id+":cancel", nil, "")
+	if code != http.StatusOK || cancelled["status"] != "cancelled" || cancelled["cancelledAt"] == nil {
+		t.Fatalf("expected cancelled relay, got %d %v", code, cancelled)
+	}
+
+	code, body := relayDo(t, "POST", s.URL+"/v1/relays/"+id+":cancel", nil, "")
+	if code != http.StatusConflict || body["code"] != "conflict" {
+		t.Fatalf("expected 409 for second cancel, got %d %v", code, body)
+	}
+}
+
+func TestDeleteRelayLeavesTombstone(t *testing.T) {
+	s := newHighBurstTestServer(t)
+	defer s.Close()
+
+	raw := []byte(`{"eventType":"x","destination":{"type":"webhook","url":"https://e"},"payload":{"secret":1},"metadata":{"m":"v"}}`)
+	code, created := relayDo(t, "POST", s.URL+"/v1/relays", raw, "del1")
+	if code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	id := created["id"].(string)
+
+	code, deleted := relayDo(t, "DELETE", s.URL+"/v1/relays/"+id, nil, "")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if deleted["deletedAt"] == nil || deleted["payload"] != nil || deleted["metadata"] != nil {
+		t.Fatalf("expected tombstone without payload, got %v", deleted)
+	}
+	if deleted["status"] != "cancelled" {
+		t.Fatalf("expected queued relay to be cancelled on delete, got %v", deleted["status"])
+	}
+
+	code, got := relayDo(t, "GET", s.URL+"/v1/relays/"+id, nil, "")
+	if code != http.StatusOK || got["payload"] != nil || got["deletedAt"] == nil {
+		t.Fatalf("expected tombstone on GET, got %d %v", code, got)
+	}
+
+	// An idempotent retry must not resurrect the payload.
+	code, replayed := relayDo(t, "POST", s.URL+"/v1/relays", raw, "del1")
+	if code != http.StatusCreated || replayed["id"] != id || replayed["payload"] != nil {
+		t.Fatalf("expected tombstone on replay, got %d %v", code, replayed)
+	}
+}
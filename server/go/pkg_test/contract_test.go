@@ -0,0 +1,215 @@
+package pkg_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/segolab/relay-ref/server/go/pkg/api"
+	"github.com/segolab/relay-ref/server/go/pkg/middleware"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+	"github.com/segolab/relay-ref/server/go/pkg/openapi"
+)
+
+// contractErrors returns the "in path-or-name" of each violation in a 400
+// invalid_request response.
+func contractErrors(t *testing.T, code int, m map[string]any) map[string]bool {
+	t.Helper()
+	if code != http.StatusBadRequest || m["code"] != "invalid_request" {
+		t.Fatalf("expected 400 invalid_request, got %d %v", code, m)
+	}
+	details, _ := m["details"].(map[string]any)
+	errs, _ := details["errors"].([]any)
+	out := map[string]bool{}
+	for _, e := range errs {
+		e := e.(map[string]any)
+		where, _ := e["path"].(string)
+		if name, ok := e["name"].(string); ok {
+			where = name
+		}
+		out[e["in"].(string)+" "+where] = true
+	}
+	return out
+}
+
+func TestContractRejectsRequests(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	code, m := relayDo(t, "POST", s.URL+"/v1/relays", []byte(`{"eventType":"x","surprise":1,
+		"destination":{"type":"webhook","url":"not a url"},"payload":{}}`), "")
+	got := contractErrors(t, code, m)
+	for _, want := range []string{"body /surprise", "body /destination/url"} {
+		if !got[want] {
+			t.Fatalf("expected a violation at %s, got %v", want, got)
+		}
+	}
+
+	code, m = relayDo(t, "POST", s.URL+"/v1/relays", []byte(`{"eventType":"x",
+		"destination":{"type":"webhook","url":"https://e"},"payload":{}}`), strings.Repeat("k", 129))
+	if got := contractErrors(t, code, m); !got["header Idempotency-Key"] {
+		t.Fatalf("expected an Idempotency-Key violation, got %v", got)
+	}
+
+	req, _ := http.NewRequest("GET", s.URL+"/v1/relays?pageSize=500", nil)
+	req.Header.Set("X-API-Key", "k")
+	req.Header.Set("X-Request-ID", strings.Repeat("r", 129))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	_ = json.NewDecoder(resp.Body).Decode(&m)
+	got = contractErrors(t, resp.StatusCode, m)
+	for _, want := range []string{"header X-Request-ID", "query pageSize"} {
+		if !got[want] {
+			t.Fatalf("expected a violation at %s, got %v", want, got)
+		}
+	}
+}
+
+func TestContractValidatesResponses(t *testing.T) {
+	spec, err := openapi.Parse([]byte(`
+openapi: 3.0.3
+paths:
+  /things/{id}:
+    get:
+      operationId: getThing
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema: {type: string, format: uuid}
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              schema: {$ref: "#/components/schemas/Thing"}
+components:
+  schemas:
+    Thing:
+      type: object
+      required: [name]
+      additionalProperties: false
+      properties:
+        name: {type: string, nullable: true}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body string
+	h := middleware.Contract(spec, middleware.ContractOptions{MaxBodyBytes: 1024, ValidateResponses: true},
+		slog.New(slog.NewTextHandler(io.Discard, nil)))(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, body)
+	}))
+
+	get := func(path string) (int, map[string]any) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		var m map[string]any
+		_ = json.NewDecoder(bytes.NewReader(rec.Body.Bytes())).Decode(&m)
+		return rec.Code, m
+	}
+
+	body = `{"name":null}`
+	if code, m := get("/things/6f1c1c2e-2b1d-4c55-8d7e-5b0f9a8f0a11"); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %v", code, m)
+	}
+	code, m := get("/things/nope")
+	if got := contractErrors(t, code, m); !got["path id"] {
+		t.Fatalf("expected a path id violation, got %v", got)
+	}
+	body = `{"name":"a","extra":1}`
+	if code, m := get("/things/6f1c1c2e-2b1d-4c55-8d7e-5b0f9a8f0a11"); code != http.StatusInternalServerError || m["code"] != "contract_violation" {
+		t.Fatalf("expected 500 contract_violation, got %d %v", code, m)
+	}
+}
+
+func TestContractRunsAfterScopeAndRateLimits(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	invalid := []byte(`{"eventType":1}`)
+	resp := adminDo(t, "POST", s.URL+"/v1/admin/keys", "admin", model.CreateAPIKeyRequest{
+		Name: "reader", Tenant: "default", Scopes: []string{"relays:read"},
+	})
+	var reader model.APIKeySecretResponse
+	_ = json.NewDecoder(resp.Body).Decode(&reader)
+	// The scope check answers before the body is validated.
+	resp = adminDo(t, "POST", s.URL+"/v1/relays", reader.Secret, json.RawMessage(invalid))
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 before validation, got %d", resp.StatusCode)
+	}
+	// Invalid requests are charged like any other.
+	codes := map[int]int{}
+	for i := 0; i < 3; i++ {
+		code, _ := relayDo(t, "POST", s.URL+"/v1/relays", invalid, "")
+		codes[code]++
+	}
+	if codes[http.StatusBadRequest] != 2 || codes[http.StatusTooManyRequests] != 1 {
+		t.Fatalf("expected two 400s then a 429, got %v", codes)
+	}
+}
+
+func TestContractIsEmbeddedAndOnByDefault(t *testing.T) {
+	want, err := os.ReadFile("../../../api/openapi.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile("../pkg/openapi/openapi.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("pkg/openapi/openapi.yaml is out of date; run go generate ./pkg/openapi")
+	}
+	if _, err := openapi.Embedded(); err != nil {
+		t.Fatalf("expected the embedded contract to load, got %v", err)
+	}
+
+	cfg, err := api.LoadConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.ValidateRequests {
+		t.Fatal("expected requests to be validated by default")
+	}
+}
+
+func TestEveryRouteIsInTheContract(t *testing.T) {
+	spec, err := openapi.Embedded()
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes, ok := api.NewApp(newTestDeps(t)).Router.(chi.Routes)
+	if !ok {
+		t.Fatal("expected the router to be a chi router")
+	}
+	param := regexp.MustCompile(`\{[^}]+\}`)
+	walked := 0
+	err = chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		walked++
+		path := param.ReplaceAllString(route, "00000000-0000-0000-0000-000000000000")
+		if op, _ := spec.Find(method, path); op == nil {
+			t.Errorf("%s %s is not described in api/openapi.yaml", method, route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if walked == 0 {
+		t.Fatal("expected to walk some routes")
+	}
+}
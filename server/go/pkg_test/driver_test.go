@@ -0,0 +1,106 @@
+package pkg_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/segolab/relay-ref/server/go/pkg/api"
+	"github.com/segolab/relay-ref/server/go/pkg/delivery"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+)
+
+func TestLocalDrivers(t *testing.T) {
+	dir := t.TempDir()
+	s, d := newBurstTestApp(t, 10, func(d *api.Dependencies) { d.Queues = delivery.NewQueues(10) })
+	dispatcher := &delivery.Dispatcher{
+		Log:   d.Logger,
+		Store: d.RelayStore,
+		Sender: delivery.Drivers{
+			model.DestinationFile:  delivery.NewFileSink(dir),
+			model.DestinationQueue: d.Queues,
+		},
+		Concurrency: 4,
+		Timeout:     5 * time.Second,
+		MaxAttempts: 1,
+	}
+
+	code, m := relayDo(t, "POST", s.URL+"/v1/relays", []byte(`{"eventType":"order.created",
+		"destinations":[{"type":"file","url":"file:orders"},{"type":"queue","url":"queue:orders","transform":{"body":"{{.payload.id}}"}}],
+		"payload":{"id":"o-1"}}`), "")
+	if code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d %v", code, m)
+	}
+	if n := dispatcher.Tick(context.Background(), time.Now().UTC()); n != 2 {
+		t.Fatalf("expected 2 attempts, got %d", n)
+	}
+	_, got := relayDo(t, "GET", s.URL+"/v1/relays/"+m["id"].(string), nil, "")
+	if got["status"] != "delivered" {
+		t.Fatalf("expected delivered, got %v", got)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*", "orders.ndjson"))
+	if len(files) != 1 {
+		t.Fatalf("expected one sink file, got %v", files)
+	}
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	var line model.QueueMessage
+	if !sc.Scan() || json.Unmarshal(sc.Bytes(), &line) != nil || line.RelayID.String() != m["id"] || string(line.Body) != `{"id":"o-1"}` {
+		t.Fatalf("unexpected sink line %s", sc.Bytes())
+	}
+
+	code, recv := relayDo(t, "POST", s.URL+"/v1/queues/orders:receive", []byte(`{"maxMessages":10}`), "")
+	items, _ := recv["items"].([]any)
+	if code != http.StatusOK || len(items) != 1 {
+		t.Fatalf("expected one message, got %d %v", code, recv)
+	}
+	if msg := items[0].(map[string]any); msg["relayId"] != m["id"] || msg["body"] != "o-1" {
+		t.Fatalf("unexpected message %v", msg)
+	}
+	if _, recv = relayDo(t, "POST", s.URL+"/v1/queues/orders:receive", nil, ""); len(recv["items"].([]any)) != 0 {
+		t.Fatalf("expected the queue to be drained, got %v", recv)
+	}
+
+	for _, dest := range []string{
+		`{"type":"queue","url":"queue:../x"}`,
+		`{"type":"file","url":"queue:orders"}`,
+		`{"type":"smtp","url":"mailto:a@b"}`,
+	} {
+		code, _ := relayDo(t, "POST", s.URL+"/v1/relays", []byte(`{"eventType":"x","destination":`+dest+`,"payload":{}}`), "")
+		if code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", dest, code)
+		}
+	}
+}
+
+func TestFileSinkKeepsTenantsInsideDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sink")
+	sink := delivery.NewFileSink(dir)
+	for _, tenant := range []string{"..", "../x", "a/b"} {
+		relay := &model.Relay{ID: uuid.New(), Tenant: tenant, EventType: "x", Payload: json.RawMessage(`{}`)}
+		if err := sink.Send(context.Background(), relay, model.Delivery{
+			Destination: model.Destination{Type: model.DestinationFile, URL: "file:x"},
+		}); err != nil {
+			t.Fatalf("tenant %q: %v", tenant, err)
+		}
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*", "x.ndjson"))
+	if len(files) != 3 {
+		t.Fatalf("expected a file per tenant inside the sink, got %v", files)
+	}
+	if outside, _ := filepath.Glob(filepath.Join(dir, "..", "*.ndjson")); len(outside) != 0 {
+		t.Fatalf("expected nothing written outside the sink, got %v", outside)
+	}
+}
@@ -0,0 +1,142 @@
+package pkg_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/segolab/relay-ref/server/go/pkg/api"
+	"github.com/segolab/relay-ref/server/go/pkg/middleware"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+)
+
+func TestUnauthorizedHasErrorBody(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	resp, err := http.Get(s.URL + "/v1/relays")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e model.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+		t.Fatalf("expected JSON body: %v", err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized || e.Code != "unauthorized" || e.RequestID == nil {
+		t.Fatalf("unexpected 401 response: %d %+v", resp.StatusCode, e)
+	}
+}
+
+func TestUnroutedRequestsHaveErrorBodies(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	for _, c := range []struct {
+		method, path string
+		status       int
+		code, allow  string
+	}{
+		{"GET", "/nope", http.StatusNotFound, "not_found", ""},
+		{"GET", "/v1/nope", http.StatusNotFound, "not_found", ""},
+		{"PUT", "/v1/relays", http.StatusMethodNotAllowed, "method_not_allowed", "GET, POST"},
+		{"POST", "/healthz", http.StatusMethodNotAllowed, "method_not_allowed", "GET"},
+	} {
+		req, _ := http.NewRequest(c.method, s.URL+c.path, nil)
+		req.Header.Set("X-API-Key", "k")
+		req.Header.Set("Accept", "application/problem+json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var p model.ProblemDetails
+		err = json.NewDecoder(resp.Body).Decode(&p)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != c.status || p.Code != c.code || p.RequestID == nil {
+			t.Fatalf("%s %s: expected %d %s problem details, got %d %+v (%v)", c.method, c.path, c.status, c.code, resp.StatusCode, p, err)
+		}
+		if got := resp.Header.Get("Allow"); got != c.allow {
+			t.Fatalf("%s %s: expected Allow %q, got %q", c.method, c.path, c.allow, got)
+		}
+	}
+}
+
+func TestProblemDetailsViaAccept(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	var last *http.Response
+	for i := 0; i < 4; i++ {
+		req, _ := http.NewRequest("POST", s.URL+"/v1/relays",
+			strings.NewReader(`{"eventType":"x","destination":{"type":"webhook","url":"https://e"},"payload":{"a":1}}`))
+		req.Header.Set("X-API-Key", "k")
+		req.Header.Set("Accept", "application/problem+json, application/json;q=0.9")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = resp
+	}
+	if last.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", last.StatusCode)
+	}
+	if ct := last.Header.Get("Content-Type"); ct != "application/problem+json" {
+		t.Fatalf("expected problem+json, got %q", ct)
+	}
+	var p model.ProblemDetails
+	_ = json.NewDecoder(last.Body).Decode(&p)
+	if p.Status != http.StatusTooManyRequests || p.Code != "rate_limited" || p.RequestID == nil {
+		t.Fatalf("unexpected problem details: %+v", p)
+	}
+}
+
+func TestRecoverWritesErrorBody(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	h := middleware.RequestID()(middleware.Errors(middleware.ErrorFormatProblem)(
+		middleware.Recover(log)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			panic("boom")
+		}))))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/x", nil))
+
+	var p model.ProblemDetails
+	_ = json.NewDecoder(rec.Body).Decode(&p)
+	if rec.Code != http.StatusInternalServerError || p.Code != "internal" || p.RequestID == nil {
+		t.Fatalf("unexpected panic response: %d %+v", rec.Code, p)
+	}
+}
+
+func TestProblemDetailsHonourQValues(t *testing.T) {
+	h := middleware.Errors(middleware.ErrorFormatJSON)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		middleware.WriteError(w, r, http.StatusBadRequest, "invalid_request", "bad", nil)
+	}))
+	cases := map[string]string{
+		"":                         "application/json; charset=utf-8",
+		"application/problem+json": "application/problem+json",
+		"application/json, application/problem+json":           "application/problem+json",
+		"application/json;q=1, application/problem+json;q=0.1": "application/json; charset=utf-8",
+		"application/problem+json;q=0":                         "application/json; charset=utf-8",
+		"*/*;q=0.5, application/problem+json;q=0.8":            "application/problem+json",
+		"application/*, application/problem+json;q=0.5":        "application/json; charset=utf-8",
+	}
+	for accept, want := range cases {
+		req := httptest.NewRequest("GET", "/x", nil)
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Content-Type"); got != want {
+			t.Errorf("Accept %q: got %q, want %q", accept, got, want)
+		}
+	}
+}
+
+func TestUnknownErrorFormatIsRejected(t *testing.T) {
+	t.Setenv("RELAY_ERROR_FORMAT", "xml")
+	if _, err := api.LoadConfigFromEnv(); err == nil {
+		t.Fatal("expected an unknown error format to be rejected")
+	}
+}
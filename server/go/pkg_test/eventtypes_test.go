@@ -0,0 +1,250 @@
+package pkg_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/segolab/relay-ref/server/go/pkg/api"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+	"github.com/segolab/relay-ref/server/go/pkg/schema"
+)
+
+const orderSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["orderId", "amount"],
+	"additionalProperties": false,
+	"properties": {
+		"orderId": {"type": "string", "format": "uuid"},
+		"amount": {"type": "number", "minimum": 0},
+		"currency": {"enum": ["EUR", "USD"]},
+		"items": {"type": "array", "items": {"$ref": "#/$defs/item"}}
+	},
+	"$defs": {"item": {"type": "object", "required": ["sku"], "properties": {"sku": {"type": "string", "minLength": 1}}}}
+}`
+
+func newEventTypeTestServer(t *testing.T, strict bool) *httptest.Server {
+	t.Helper()
+	s, _ := newBurstTestApp(t, 20, func(d *api.Dependencies) {
+		if strict {
+			d.Config.StrictEventTypeTenants = map[string]struct{}{"default": {}}
+		}
+	})
+	return s
+}
+
+func TestEventTypeRegistry(t *testing.T) {
+	s := newEventTypeTestServer(t, false)
+
+	code, m := relayDo(t, "POST", s.URL+"/v1/event-types", []byte(`{"name":"order.created","schema":`+orderSchema+`}`), "")
+	if code != http.StatusCreated || m["version"] != float64(1) {
+		t.Fatalf("expected 201 with version 1, got %d %v", code, m)
+	}
+	if code, _ := relayDo(t, "POST", s.URL+"/v1/event-types", []byte(`{"name":"order.created"}`), ""); code != http.StatusConflict {
+		t.Fatalf("expected 409 for a duplicate, got %d", code)
+	}
+
+	relay := func(payload string) (int, map[string]any) {
+		return relayDo(t, "POST", s.URL+"/v1/relays", []byte(`{"eventType":"order.created",
+			"destination":{"type":"webhook","url":"https://example.com/hook"},"payload":`+payload+`}`), "")
+	}
+	if code, m := relay(`{"orderId":"6f1c1c2e-2b1d-4c55-8d7e-5b0f9a8f0a11","amount":10,"items":[{"sku":"a"}]}`); code != http.StatusCreated {
+		t.Fatalf("expected a valid payload to be accepted, got %d %v", code, m)
+	}
+
+	code, m = relay(`{"orderId":"nope","amount":-1,"extra":true,"items":[{}]}`)
+	if code != http.StatusUnprocessableEntity || m["code"] != "invalid_payload" {
+		t.Fatalf("expected 422 invalid_payload, got %d %v", code, m)
+	}
+	details := m["details"].(map[string]any)
+	got := map[string]bool{}
+	for _, e := range details["errors"].([]any) {
+		got[e.(map[string]any)["path"].(string)] = true
+	}
+	for _, path := range []string{"/orderId", "/amount", "/extra", "/items/0/sku"} {
+		if !got[path] {
+			t.Fatalf("expected a field error at %s, got %v", path, details["errors"])
+		}
+	}
+
+	// A new version relaxes the schema; relays are checked against it.
+	code, m = relayDo(t, "PUT", s.URL+"/v1/event-types/order.created", []byte(`{"schema":{"type":"object"}}`), "")
+	if code != http.StatusOK || m["version"] != float64(2) {
+		t.Fatalf("expected 200 with version 2, got %d %v", code, m)
+	}
+	if code, m := relay(`{"extra":true}`); code != http.StatusCreated {
+		t.Fatalf("expected the relaxed schema to accept the payload, got %d %v", code, m)
+	}
+	code, m = relayDo(t, "GET", s.URL+"/v1/event-types/order.created/versions", nil, "")
+	if code != http.StatusOK || len(m["items"].([]any)) != 2 {
+		t.Fatalf("expected 2 versions, got %d %v", code, m)
+	}
+
+	// Unregistered types are accepted unless the tenant is strict.
+	code, _ = relayDo(t, "POST", s.URL+"/v1/relays", []byte(`{"eventType":"order.paid",
+		"destination":{"type":"webhook","url":"https://example.com/hook"},"payload":{}}`), "")
+	if code != http.StatusCreated {
+		t.Fatalf("expected an unregistered type to be accepted, got %d", code)
+	}
+}
+
+func TestStrictTenantRejectsUnregisteredEventTypes(t *testing.T) {
+	s := newEventTypeTestServer(t, true)
+
+	code, m := relayDo(t, "POST", s.URL+"/v1/relays", []byte(`{"eventType":"order.paid",
+		"destination":{"type":"webhook","url":"https://example.com/hook"},"payload":{}}`), "")
+	if code != http.StatusUnprocessableEntity || m["code"] != "unknown_event_type" {
+		t.Fatalf("expected 422 unknown_event_type, got %d %v", code, m)
+	}
+	if code, _ := relayDo(t, "POST", s.URL+"/v1/event-types", []byte(`{"name":"order.paid"}`), ""); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	code, _ = relayDo(t, "POST", s.URL+"/v1/relays", []byte(`{"eventType":"order.paid",
+		"destination":{"type":"webhook","url":"https://example.com/hook"},"payload":{}}`), "")
+	if code != http.StatusCreated {
+		t.Fatalf("expected a registered type without a schema to be accepted, got %d", code)
+	}
+}
+
+func TestEventTypeInvalidSchema(t *testing.T) {
+	s := newEventTypeTestServer(t, false)
+
+	for _, schema := range []string{
+		`{"type":"decimal"}`,
+		`{"$ref":"https://example.com/schema.json"}`,
+		`{"$ref":"#/$defs/missing"}`,
+		`{"$schema":"http://json-schema.org/draft-07/schema#"}`,
+		`{"pattern":"("}`,
+		`{"allOf":[{"$ref":"#"},{"$ref":"#"}]}`,
+		`{"if":{"required":["a"]},"then":{"required":["b"]}}`,
+		`{"patternProperties":{"^x-":{"type":"string"}}}`,
+		`{"properties":{"a":{"$defs":{"b":true}}}}`,
+		`{"$defs":{"a":{"anyOf":[{"$ref":"#/$defs/b"}]},"b":{"not":{"$ref":"#/$defs/a"}}},"$ref":"#/$defs/a"}`,
+	} {
+		code, m := relayDo(t, "POST", s.URL+"/v1/event-types", []byte(`{"name":"x","schema":`+schema+`}`), "")
+		if code != http.StatusBadRequest || m["code"] != "invalid_schema" {
+			t.Fatalf("expected 400 invalid_schema for %s, got %d %v", schema, code, m)
+		}
+	}
+}
+
+func TestEventTypeValidationIsBounded(t *testing.T) {
+	s := newEventTypeTestServer(t, false)
+
+	// Each level applies the next one twice, so a naive evaluation would
+	// take 2^30 steps.
+	defs := `"l30":{"type":"object"}`
+	for i := 29; i >= 0; i-- {
+		defs += fmt.Sprintf(`,"l%d":{"allOf":[{"$ref":"#/$defs/l%d"},{"$ref":"#/$defs/l%d"}]}`, i, i+1, i+1)
+	}
+	schema := `{"$defs":{` + defs + `},"$ref":"#/$defs/l0"}`
+	if code, m := relayDo(t, "POST", s.URL+"/v1/event-types", []byte(`{"name":"deep","schema":`+schema+`}`), ""); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d %v", code, m)
+	}
+
+	start := time.Now()
+	code, m := relayDo(t, "POST", s.URL+"/v1/relays", []byte(`{"eventType":"deep",
+		"destination":{"type":"webhook","url":"https://example.com/hook"},"payload":{}}`), "")
+	if code != http.StatusUnprocessableEntity || m["code"] != "invalid_payload" {
+		t.Fatalf("expected 422 invalid_payload, got %d %v", code, m)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected validation to be cut short, took %s", elapsed)
+	}
+}
+
+func TestUniqueItems(t *testing.T) {
+	s, err := schema.Compile(json.RawMessage(`{"type":"array","uniqueItems":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		doc  string
+		dups int
+	}{
+		{`[1, 2, "1", [1], {"a": 1}]`, 0},
+		{`[1, 1.0]`, 1},
+		{`[{"a": 1, "b": [true]}, {"b": [true], "a": 1e0}]`, 1},
+		{`["x", "x", "x"]`, 2},
+		{`[[1, 2], [2, 1], null, false, null]`, 1},
+	} {
+		if errs := s.Validate(json.RawMessage(c.doc)); len(errs) != c.dups {
+			t.Errorf("%s: expected %d duplicates, got %v", c.doc, c.dups, errs)
+		}
+	}
+
+	// 100,000 distinct items: a pairwise check would take billions of
+	// comparisons.
+	doc := make([]int, 100000)
+	for i := range doc {
+		doc[i] = i
+	}
+	raw, _ := json.Marshal(doc)
+	start := time.Now()
+	if errs := s.Validate(raw); len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected uniqueItems to be checked in linear time, took %s", elapsed)
+	}
+}
+
+func TestRecreatedEventTypeEnforcesNewSchema(t *testing.T) {
+	s := newEventTypeTestServer(t, false)
+
+	relay := func() int {
+		code, _ := relayDo(t, "POST", s.URL+"/v1/relays", []byte(`{"eventType":"order.created",
+			"destination":{"type":"webhook","url":"https://example.com/hook"},"payload":{}}`), "")
+		return code
+	}
+	if code, _ := relayDo(t, "POST", s.URL+"/v1/event-types", []byte(`{"name":"order.created","schema":{"type":"object"}}`), ""); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	if code := relay(); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	if code, _ := relayDo(t, "DELETE", s.URL+"/v1/event-types/order.created", nil, ""); code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", code)
+	}
+	if code, _ := relayDo(t, "POST", s.URL+"/v1/event-types", []byte(`{"name":"order.created","schema":{"required":["orderId"]}}`), ""); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	if code := relay(); code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected the re-created schema to be enforced, got %d", code)
+	}
+}
+
+func TestEventTypeWritesRespectKeyPrefixes(t *testing.T) {
+	s := newEventTypeTestServer(t, false)
+
+	if code, _ := relayDo(t, "POST", s.URL+"/v1/event-types", []byte(`{"name":"user.created","schema":{"type":"object"}}`), ""); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	resp := adminDo(t, "POST", s.URL+"/v1/admin/keys", "admin", model.CreateAPIKeyRequest{
+		Name:              "orders",
+		Tenant:            "default",
+		Scopes:            []string{"subscriptions:write"},
+		EventTypePrefixes: []string{"order."},
+	})
+	var key model.APIKeySecretResponse
+	_ = json.NewDecoder(resp.Body).Decode(&key)
+
+	for _, c := range []struct {
+		method, path string
+		body         any
+		want         int
+	}{
+		{"POST", "/v1/event-types", map[string]any{"name": "order.created"}, http.StatusCreated},
+		{"POST", "/v1/event-types", map[string]any{"name": "user.deleted"}, http.StatusForbidden},
+		{"PUT", "/v1/event-types/user.created", map[string]any{"schema": map[string]any{}}, http.StatusForbidden},
+		{"DELETE", "/v1/event-types/user.created", nil, http.StatusForbidden},
+	} {
+		if code := adminDo(t, c.method, s.URL+c.path, key.Secret, c.body).StatusCode; code != c.want {
+			t.Fatalf("%s %s: expected %d, got %d", c.method, c.path, c.want, code)
+		}
+	}
+}
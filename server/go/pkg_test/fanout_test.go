@@ -0,0 +1,97 @@
+package pkg_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/segolab/relay-ref/server/go/pkg/delivery"
+)
+
+func TestFanOutDelivery(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer ok.Close()
+	var flakyCalls atomic.Int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if flakyCalls.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer flaky.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+
+	s, d := newBurstTestApp(t, 10, nil)
+	dispatcher := &delivery.Dispatcher{
+		Log:         d.Logger,
+		Store:       d.RelayStore,
+		Sender:      delivery.WebhookSender{},
+		Concurrency: 10,
+		Timeout:     5 * time.Second,
+		MaxAttempts: 2,
+		BackoffBase: time.Second,
+		BackoffMax:  time.Minute,
+	}
+
+	dests := func(urls ...string) string {
+		out := ""
+		for i, u := range urls {
+			if i > 0 {
+				out += ","
+			}
+			out += `{"type":"webhook","url":"` + u + `"}`
+		}
+		return `[` + out + `]`
+	}
+	_, retried := relayDo(t, "POST", s.URL+"/v1/relays",
+		[]byte(`{"eventType":"x","destinations":`+dests(ok.URL, flaky.URL)+`,"payload":{}}`), "")
+	_, partial := relayDo(t, "POST", s.URL+"/v1/relays",
+		[]byte(`{"eventType":"x","destinations":`+dests(ok.URL, down.URL)+`,"payload":{}}`), "")
+	if deliveries, _ := retried["deliveries"].([]any); len(deliveries) != 2 || retried["destination"] == nil {
+		t.Fatalf("expected two deliveries and a compatible destination, got %v", retried)
+	}
+
+	ctx := context.Background()
+	if n := dispatcher.Tick(ctx, time.Now().UTC()); n != 4 {
+		t.Fatalf("expected 4 first attempts, got %d", n)
+	}
+	_, got := relayDo(t, "GET", s.URL+"/v1/relays/"+retried["id"].(string), nil, "")
+	first := got["deliveries"].([]any)
+	if got["status"] != "queued" || first[0].(map[string]any)["status"] != "delivered" || first[1].(map[string]any)["status"] != "pending" {
+		t.Fatalf("expected one destination delivered and one pending, got %v", got)
+	}
+
+	// Retries are due after backoff; only the failed destinations are retried.
+	if n := dispatcher.Tick(ctx, time.Now().UTC().Add(time.Hour)); n != 2 {
+		t.Fatalf("expected 2 retries, got %d", n)
+	}
+	_, got = relayDo(t, "GET", s.URL+"/v1/relays/"+retried["id"].(string), nil, "")
+	if got["status"] != "delivered" {
+		t.Fatalf("expected delivered after retry, got %v", got)
+	}
+	_, got = relayDo(t, "GET", s.URL+"/v1/relays/"+partial["id"].(string), nil, "")
+	if got["status"] != "failed" || got["failureReason"] != "1 of 2 destinations failed" {
+		t.Fatalf("expected failed aggregate status, got %v", got)
+	}
+	if attempts := got["deliveries"].([]any)[0].(map[string]any)["attempts"]; attempts != float64(1) {
+		t.Fatalf("expected the healthy destination to be attempted once, got %v", attempts)
+	}
+
+	// Redelivering a partial fan-out only re-sends where it failed.
+	code, again := relayDo(t, "POST", s.URL+"/v1/relays/"+partial["id"].(string)+":redeliver", nil, "")
+	deliveries, _ := again["deliveries"].([]any)
+	if code != http.StatusCreated || len(deliveries) != 1 || deliveries[0].(map[string]any)["destination"].(map[string]any)["url"] != down.URL {
+		t.Fatalf("expected only the failed destination to be redelivered, got %d %v", code, again)
+	}
+
+	code, _ = relayDo(t, "POST", s.URL+"/v1/relays",
+		[]byte(`{"eventType":"x","destination":{"type":"webhook","url":"https://e"},"destinations":`+dests(ok.URL)+`,"payload":{}}`), "")
+	if code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for destination with destinations, got %d", code)
+	}
+}
@@ -0,0 +1,214 @@
+package pkg_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/segolab/relay-ref/server/go/pkg/api"
+	"github.com/segolab/relay-ref/server/go/pkg/auth"
+)
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func signES256(t *testing.T, key *ecdsa.PrivateKey, kid string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "typ": "JWT", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return signed + "." + b64(sig)
+}
+
+func writeJWKS(t *testing.T, key *ecdsa.PrivateKey, kid string) string {
+	t.Helper()
+	set := auth.JSONWebKeySet{Keys: []auth.JSONWebKey{{
+		Kty: "EC",
+		Kid: kid,
+		Use: "sig",
+		Crv: "P-256",
+		X:   b64(key.X.FillBytes(make([]byte, 32))),
+		Y:   b64(key.Y.FillBytes(make([]byte, 32))),
+	}}}
+	raw, _ := json.Marshal(set)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBearerJWTAuth(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	path := writeJWKS(t, key, "k1")
+
+	d := newTestDeps(t)
+	d.Config.JWTTenantClaim = "tenant"
+	d.TokenVerifier = &auth.Verifier{
+		Keys:     auth.NewJWKS(path, time.Minute, nil),
+		Issuer:   "https://issuer.test",
+		Audience: "relay-ref",
+	}
+	s := httptest.NewServer(api.NewApp(d).Router)
+	defer s.Close()
+
+	claims := map[string]any{
+		"iss":    "https://issuer.test",
+		"aud":    "relay-ref",
+		"sub":    "svc-orders",
+		"tenant": "default",
+		"scope":  "relays:read",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	}
+	get := func(token string) int {
+		req, _ := http.NewRequest("GET", s.URL+"/v1/relays", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := get(signES256(t, key, "k1", claims)); code != http.StatusOK {
+		t.Fatalf("expected 200 for valid token, got %d", code)
+	}
+
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if code := get(signES256(t, other, "k1", claims)); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for bad signature, got %d", code)
+	}
+
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	if code := get(signES256(t, key, "k1", claims)); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for expired token, got %d", code)
+	}
+
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	claims["aud"] = "someone-else"
+	if code := get(signES256(t, key, "k1", claims)); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for wrong audience, got %d", code)
+	}
+
+	// API keys keep working next to bearer tokens.
+	if code := adminDo(t, "GET", s.URL+"/v1/relays", "k", nil).StatusCode; code != http.StatusOK {
+		t.Fatalf("expected API key auth to still work, got %d", code)
+	}
+}
+
+func ecJWK(key *ecdsa.PrivateKey, kid string) auth.JSONWebKey {
+	return auth.JSONWebKey{
+		Kty: "EC",
+		Kid: kid,
+		Crv: "P-256",
+		X:   b64(key.X.FillBytes(make([]byte, 32))),
+		Y:   b64(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+// serveJWKS serves the key set currently held in set, counting fetches.
+func serveJWKS(t *testing.T, set *atomic.Pointer[auth.JSONWebKeySet], fetches *atomic.Int32) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fetches.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		_ = json.NewEncoder(w).Encode(set.Load())
+	}))
+}
+
+func TestJWKSReloadsOnUnknownKid(t *testing.T) {
+	k1, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	k2, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var set atomic.Pointer[auth.JSONWebKeySet]
+	var fetches atomic.Int32
+	set.Store(&auth.JSONWebKeySet{Keys: []auth.JSONWebKey{ecJWK(k1, "k1")}})
+	srv := serveJWKS(t, &set, &fetches)
+	defer srv.Close()
+
+	jwks := auth.NewJWKS(srv.URL, time.Hour, nil)
+	jwks.MinReloadInterval = 0
+	ctx := context.Background()
+	if _, err := jwks.Key(ctx, "k1", "ES256"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The issuer rotates to k2; the first token signed with it reloads.
+	set.Store(&auth.JSONWebKeySet{Keys: []auth.JSONWebKey{ecJWK(k2, "k2")}})
+	if _, err := jwks.Key(ctx, "k2", "ES256"); err != nil {
+		t.Fatalf("expected the rotated key after a reload, got %v", err)
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Fatalf("expected 2 fetches, got %d", n)
+	}
+
+	jwks.MinReloadInterval = time.Hour
+	if _, err := jwks.Key(ctx, "k3", "ES256"); !errors.Is(err, auth.ErrUnknownKey) {
+		t.Fatalf("expected an unknown key, got %v", err)
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Fatalf("expected unknown kids not to reload within the interval, got %d fetches", n)
+	}
+}
+
+func TestJWKSSharesFetchesAndChecksKeys(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	restricted := ecJWK(key, "es384-only")
+	restricted.Alg = "ES384"
+	var set atomic.Pointer[auth.JSONWebKeySet]
+	var fetches atomic.Int32
+	set.Store(&auth.JSONWebKeySet{Keys: []auth.JSONWebKey{
+		{Kty: "oct", Kid: "hmac"},
+		{Kty: "EC", Kid: "k256", Crv: "secp256k1"},
+		ecJWK(key, "k1"),
+		restricted,
+	}})
+	srv := serveJWKS(t, &set, &fetches)
+	defer srv.Close()
+
+	jwks := auth.NewJWKS(srv.URL, time.Hour, nil)
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := jwks.Key(ctx, "k1", "ES256")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("expected unsupported keys to be skipped, got %v", err)
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Fatalf("expected concurrent callers to share one fetch, got %d", n)
+	}
+	if _, err := jwks.Key(ctx, "es384-only", "ES256"); !errors.Is(err, auth.ErrKeyAlgMismatch) {
+		t.Fatalf("expected the key's alg to be enforced, got %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package pkg_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/segolab/relay-ref/server/go/pkg/api"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func issueCert(t *testing.T, tmpl *x509.Certificate, parent *testCert) *testCert {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotBefore = time.Now().Add(-time.Minute)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func TestMutualTLSClientCertAuth(t *testing.T) {
+	ca := issueCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test ca"},
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}, nil)
+	server := issueCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "relay-ref"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+	partnerURI, _ := url.Parse("spiffe://partners/acme")
+	client := issueCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "acme client"},
+		URIs:        []*url.URL{partnerURI},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+
+	dir := t.TempDir()
+	write := func(name string, b []byte) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	d := newTestDeps(t)
+	d.Config.TLSCertFile = write("server.crt", server.certPEM)
+	d.Config.TLSKeyFile = write("server.key", server.keyPEM)
+	d.Config.TLSClientCAFile = write("ca.crt", ca.certPEM)
+	d.Config.TLSClientAuth = api.ClientAuthRequest
+	d.Config.TLSClientTenants = map[string]string{"spiffe://partners/acme": "acme"}
+	d.Config.TLSClientScopes = []string{"relays:read"}
+
+	tlsCfg, err := api.NewTLSConfig(d.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := httptest.NewUnstartedServer(api.NewApp(d).Router)
+	s.TLS = tlsCfg
+	s.StartTLS()
+	defer s.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientPair, _ := tls.X509KeyPair(client.certPEM, client.keyPEM)
+	withCert := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{clientPair},
+	}}}
+	stranger := issueCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "stranger", Organization: []string{"acme"}},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+	strangerPair, _ := tls.X509KeyPair(stranger.certPEM, stranger.keyPEM)
+	withUnmappedCert := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{strangerPair},
+	}}}
+	withoutCert := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+
+	resp, err := withCert.Get(s.URL + "/v1/relays")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 with client certificate, got %d", resp.StatusCode)
+	}
+
+	// The subject organization does not stand in for a tenant mapping.
+	resp, err = withUnmappedCert.Get(s.URL + "/v1/relays")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with an unmapped client certificate, got %d", resp.StatusCode)
+	}
+
+	resp, err = withoutCert.Get(s.URL + "/v1/relays")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without credentials, got %d", resp.StatusCode)
+	}
+}
+
+func TestClientAuthRequiresServerCertificate(t *testing.T) {
+	cfg := newTestDeps(t).Config
+	cfg.TLSClientAuth = api.ClientAuthRequire
+	if _, err := api.NewTLSConfig(cfg); err == nil {
+		t.Fatal("expected client certificate auth without a server certificate to fail")
+	}
+}
@@ -0,0 +1,211 @@
+package pkg_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/segolab/relay-ref/server/go/pkg/api"
+	"github.com/segolab/relay-ref/server/go/pkg/delivery"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+)
+
+// orderedHook records the eventType of each request it receives and fails
+// the first `failing` of them.
+type orderedHook struct {
+	mu      sync.Mutex
+	seen    []string
+	failing atomic.Int32
+}
+
+func (h *orderedHook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.seen = append(h.seen, r.Header.Get("X-Relay-Event-Type"))
+	h.mu.Unlock()
+	if h.failing.Add(-1) >= 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+func (h *orderedHook) events() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return strings.Join(h.seen, ",")
+}
+
+func newOrderingTest(t *testing.T, policy model.OrderingPolicy, failing int32) (*httptest.Server, *orderedHook, *delivery.Dispatcher) {
+	t.Helper()
+	hook := &orderedHook{}
+	hook.failing.Store(failing)
+	hs := httptest.NewServer(hook)
+	t.Cleanup(hs.Close)
+
+	s, d := newBurstTestApp(t, 10, func(d *api.Dependencies) { d.Queues = delivery.NewQueues(100) })
+
+	for _, ev := range []string{"order.created", "order.paid"} {
+		code, m := relayDo(t, "POST", s.URL+"/v1/relays", []byte(`{"eventType":"`+ev+`",
+			"destination":{"type":"webhook","url":"`+hs.URL+`"},"payload":{},"orderingKey":"order-1"}`), "")
+		if code != http.StatusCreated || m["orderingKey"] != "order-1" {
+			t.Fatalf("expected 201 with orderingKey, got %d %v", code, m)
+		}
+	}
+	return s, hook, &delivery.Dispatcher{
+		Log:   d.Logger,
+		Store: d.RelayStore,
+		Sender: delivery.Drivers{
+			model.DestinationWebhook: delivery.WebhookSender{},
+			model.DestinationQueue:   d.Queues,
+		},
+		Concurrency: 4,
+		Timeout:     5 * time.Second,
+		MaxAttempts: 2,
+		BackoffBase: time.Second,
+		BackoffMax:  time.Second,
+
+		OrderingPolicy:          policy,
+		OrderingDeadLetterQueue: "ordering-dead-letters",
+	}
+}
+
+func TestOrderingKeyDeliversInOrder(t *testing.T) {
+	_, hook, dispatcher := newOrderingTest(t, model.OrderingSkip, 0)
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	if n := dispatcher.Tick(ctx, now); n != 1 {
+		t.Fatalf("expected only the head to be attempted, got %d", n)
+	}
+	if n := dispatcher.Tick(ctx, now); n != 1 {
+		t.Fatalf("expected the next relay once the head was delivered, got %d", n)
+	}
+	if got := hook.events(); got != "order.created,order.paid" {
+		t.Fatalf("expected delivery in enqueue order, got %s", got)
+	}
+}
+
+func TestOrderingFailurePolicies(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("skip", func(t *testing.T) {
+		s, hook, dispatcher := newOrderingTest(t, model.OrderingSkip, 2)
+		now := time.Now().UTC()
+		for i := 0; i < 3; i++ {
+			dispatcher.Tick(ctx, now.Add(time.Duration(i)*time.Minute))
+		}
+		if got := hook.events(); got != "order.created,order.created,order.paid" {
+			t.Fatalf("expected the head to fail then the next to proceed, got %s", got)
+		}
+		assertOrderedStatuses(t, s.URL, "failed", "delivered")
+
+		code, m := relayDo(t, "POST", s.URL+"/v1/queues/ordering-dead-letters:receive", []byte(`{"maxMessages":10}`), "")
+		items, _ := m["items"].([]any)
+		if code != http.StatusOK || len(items) != 1 || items[0].(map[string]any)["eventType"] != "order.created" {
+			t.Fatalf("expected the failed head in the dead-letter queue, got %d %v", code, m)
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		s, hook, dispatcher := newOrderingTest(t, model.OrderingBlock, 3)
+		now := time.Now().UTC()
+		for i := 0; i < 3; i++ {
+			dispatcher.Tick(ctx, now.Add(time.Duration(i)*time.Minute))
+		}
+		if got := hook.events(); got != "order.created,order.created,order.created" {
+			t.Fatalf("expected the head to keep retrying, got %s", got)
+		}
+		assertOrderedStatuses(t, s.URL, "queued", "queued")
+
+		dispatcher.Tick(ctx, now.Add(3*time.Minute))
+		dispatcher.Tick(ctx, now.Add(3*time.Minute))
+		assertOrderedStatuses(t, s.URL, "delivered", "delivered")
+	})
+}
+
+func TestOrderingCancelWaitsForAttemptInFlight(t *testing.T) {
+	s, _, dispatcher := newOrderingTest(t, model.OrderingSkip, 0)
+	relays := dispatcher.Store
+	now := time.Now().UTC()
+	lease := time.Minute
+
+	head := relays.ClaimDeliveries(now, lease, 10)
+	if len(head) != 1 || head[0].Relay.EventType != "order.created" {
+		t.Fatalf("expected only the head to be claimed, got %d", len(head))
+	}
+	if code, _ := relayDo(t, "POST", s.URL+"/v1/relays/"+head[0].Relay.ID.String()+":cancel", nil, ""); code != http.StatusOK {
+		t.Fatalf("expected the head to be cancelled, got %d", code)
+	}
+	if got := relays.ClaimDeliveries(now, lease, 10); len(got) != 0 {
+		t.Fatalf("expected the lane to wait for the attempt in flight, got %d claims", len(got))
+	}
+	if _, err := relays.CompleteDelivery(head[0].Relay.ID, head[0].Index, now, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := relays.ClaimDeliveries(now, lease, 10); len(got) != 1 || got[0].Relay.EventType != "order.paid" {
+		t.Fatalf("expected the next relay once the attempt completed, got %d claims", len(got))
+	}
+}
+
+func TestOrderingLaneMovesOnWhenAbandonedLeaseExpires(t *testing.T) {
+	s, _, dispatcher := newOrderingTest(t, model.OrderingSkip, 0)
+	relays := dispatcher.Store
+	now := time.Now().UTC()
+	lease := time.Minute
+
+	head := relays.ClaimDeliveries(now, lease, 10)
+	relayDo(t, "POST", s.URL+"/v1/relays/"+head[0].Relay.ID.String()+":cancel", nil, "")
+	// The attempt never completes, e.g. the dispatcher crashed.
+	if got := relays.ClaimDeliveries(now.Add(lease), lease, 10); len(got) != 1 || got[0].Relay.EventType != "order.paid" {
+		t.Fatalf("expected the next relay once the lease ran out, got %d claims", len(got))
+	}
+}
+
+func TestUnknownOrderingPolicyIsRejected(t *testing.T) {
+	t.Setenv("RELAY_ORDERING_FAILURE_POLICY", "dlq")
+	if _, err := api.LoadConfigFromEnv(); err == nil {
+		t.Fatal("expected an unknown ordering policy to be rejected")
+	}
+	t.Setenv("RELAY_ORDERING_FAILURE_POLICY", "Block")
+	if cfg, err := api.LoadConfigFromEnv(); err != nil || cfg.OrderingPolicy != model.OrderingBlock {
+		t.Fatalf("expected block, got %q (%v)", cfg.OrderingPolicy, err)
+	}
+}
+
+func TestOrderingKeyTooLong(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	code, _ := relayDo(t, "POST", s.URL+"/v1/relays", []byte(`{"eventType":"x",
+		"destination":{"type":"webhook","url":"https://e"},"payload":{},"orderingKey":"`+strings.Repeat("k", 129)+`"}`), "")
+	if code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", code)
+	}
+}
+
+// assertOrderedStatuses checks the statuses of order.created and order.paid.
+func assertOrderedStatuses(t *testing.T, base, created, paid string) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", base+"/v1/relays?pageSize=10", nil)
+	req.Header.Set("X-API-Key", "k")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var list model.ListRelaysResponse
+	_ = json.NewDecoder(resp.Body).Decode(&list)
+	if len(list.Items) != 2 {
+		t.Fatalf("expected 2 relays, got %d", len(list.Items))
+	}
+	want := map[string]string{"order.created": created, "order.paid": paid}
+	for _, r := range list.Items {
+		if string(r.Status) != want[r.EventType] {
+			t.Fatalf("expected %s to be %s, got %s", r.EventType, want[r.EventType], r.Status)
+		}
+	}
+}
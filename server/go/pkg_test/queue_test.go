@@ -0,0 +1,223 @@
+package pkg_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/segolab/relay-ref/server/go/pkg/admission"
+	"github.com/segolab/relay-ref/server/go/pkg/api"
+	"github.com/segolab/relay-ref/server/go/pkg/delivery"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+	"github.com/segolab/relay-ref/server/go/pkg/ratelimit"
+)
+
+// newQueueTestServer returns a server whose queue destinations are filled
+// by calling enqueue.
+func newQueueTestServer(t *testing.T, receiveBurst int) (s *httptest.Server, enqueue func(n int)) {
+	t.Helper()
+	s, d := newBurstTestApp(t, 20, func(d *api.Dependencies) {
+		d.Queues = delivery.NewQueues(0)
+		d.Limiter = ratelimit.NewTokenBucketLimiter(ratelimit.Config{
+			PostRPS: 0.001, PostBurst: 20, GetRPS: 50, GetBurst: 100,
+			ReceiveRPS: 0.001, ReceiveBurst: receiveBurst,
+		})
+	})
+	dispatcher := &delivery.Dispatcher{
+		Log:         d.Logger,
+		Store:       d.RelayStore,
+		Sender:      delivery.Drivers{model.DestinationQueue: d.Queues},
+		Concurrency: 10,
+		Timeout:     time.Second,
+		MaxAttempts: 1,
+	}
+	enqueue = func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			code, m := relayDo(t, "POST", s.URL+"/v1/relays",
+				[]byte(`{"eventType":"job","destination":{"type":"queue","url":"queue:jobs"},"payload":{}}`), "")
+			if code != http.StatusCreated {
+				t.Fatalf("expected 201, got %d %v", code, m)
+			}
+		}
+		dispatcher.Tick(context.Background(), time.Now().UTC())
+	}
+	return s, enqueue
+}
+
+func TestQueueLeases(t *testing.T) {
+	s, enqueue := newQueueTestServer(t, 20)
+	defer s.Close()
+	enqueue(2)
+
+	receive := func(body string) []any {
+		t.Helper()
+		code, m := relayDo(t, "POST", s.URL+"/v1/queues/jobs:receive", []byte(body), "")
+		if code != http.StatusOK {
+			t.Fatalf("expected 200, got %d %v", code, m)
+		}
+		return m["items"].([]any)
+	}
+	first := receive(`{}`)
+	second := receive(`{"maxMessages":5}`)
+	if len(first) != 1 || len(second) != 1 || len(receive(`{}`)) != 0 {
+		t.Fatalf("expected leased messages to be hidden, got %v then %v", first, second)
+	}
+	receipt := first[0].(map[string]any)["receiptHandle"].(string)
+
+	// A nack makes the message visible again under a new lease.
+	if code, _ := relayDo(t, "POST", s.URL+"/v1/queues/jobs:nack", []byte(`{"receiptHandle":"`+receipt+`"}`), ""); code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", code)
+	}
+	again := receive(`{}`)
+	if len(again) != 1 || again[0].(map[string]any)["receiveCount"] != float64(2) {
+		t.Fatalf("expected the nacked message again, got %v", again)
+	}
+	if code, _ := relayDo(t, "POST", s.URL+"/v1/queues/jobs:ack", []byte(`{"receiptHandle":"`+receipt+`"}`), ""); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a stale receipt, got %d", code)
+	}
+	receipt = again[0].(map[string]any)["receiptHandle"].(string)
+	if code, _ := relayDo(t, "POST", s.URL+"/v1/queues/jobs:ack", []byte(`{"receiptHandle":"`+receipt+`"}`), ""); code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", code)
+	}
+
+	// A delayed nack wakes a long poll once the message is visible again.
+	receipt = second[0].(map[string]any)["receiptHandle"].(string)
+	relayDo(t, "POST", s.URL+"/v1/queues/jobs:nack", []byte(`{"receiptHandle":"`+receipt+`","delaySeconds":1}`), "")
+	start := time.Now()
+	if got := receive(`{"waitSeconds":2}`); len(got) != 1 || time.Since(start) < 500*time.Millisecond {
+		t.Fatalf("expected the message after its delay, got %v", got)
+	}
+
+	if code, _ := relayDo(t, "POST", s.URL+"/v1/queues/jobs:receive", []byte(`{"waitSeconds":60}`), ""); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a wait above the maximum, got %d", code)
+	}
+}
+
+func TestQueueLongPollWakesOnDelivery(t *testing.T) {
+	s, enqueue := newQueueTestServer(t, 20)
+	defer s.Close()
+
+	done := make(chan []any, 1)
+	go func() {
+		_, m := relayDo(t, "POST", s.URL+"/v1/queues/jobs:receive", []byte(`{"waitSeconds":2}`), "")
+		items, _ := m["items"].([]any)
+		done <- items
+	}()
+	time.Sleep(100 * time.Millisecond)
+	enqueue(1)
+	select {
+	case items := <-done:
+		if len(items) != 1 {
+			t.Fatalf("expected the delivered message, got %v", items)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("long poll did not wake on delivery")
+	}
+}
+
+func TestQueueConsumerRateLimit(t *testing.T) {
+	s, _ := newQueueTestServer(t, 2)
+	defer s.Close()
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if code, _ := relayDo(t, "POST", s.URL+"/v1/queues/jobs:receive", nil, ""); code != want {
+			t.Fatalf("call %d: expected %d, got %d", i, want, code)
+		}
+	}
+	// Consumers are limited separately from producers.
+	code, _ := relayDo(t, "GET", s.URL+"/v1/relays", nil, "")
+	if code != http.StatusOK {
+		t.Fatalf("expected reads to be unaffected, got %d", code)
+	}
+}
+
+func TestQueueNackWakesLongPoll(t *testing.T) {
+	q := delivery.NewQueues(0)
+	relay := &model.Relay{ID: uuid.New(), Tenant: "t", EventType: "job", Payload: json.RawMessage(`{}`)}
+	dest := model.Delivery{Destination: model.Destination{Type: model.DestinationQueue, URL: "queue:jobs"}}
+	if err := q.Send(context.Background(), relay, dest); err != nil {
+		t.Fatal(err)
+	}
+	leased := q.Receive(context.Background(), "t", "jobs", 1, time.Minute, 0)
+	if len(leased) != 1 {
+		t.Fatalf("expected a message, got %v", leased)
+	}
+
+	done := make(chan []model.QueueMessage, 1)
+	go func() { done <- q.Receive(context.Background(), "t", "jobs", 1, time.Minute, 2*time.Second) }()
+	time.Sleep(100 * time.Millisecond)
+	// A delayed nack moves the message's visibility before its lease ends.
+	if err := q.Nack("t", "jobs", leased[0].ReceiptHandle, 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msgs := <-done:
+		if len(msgs) != 1 {
+			t.Fatalf("expected the nacked message, got %v", msgs)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("long poll did not wake on a delayed nack")
+	}
+}
+
+func TestQueueDeadLetters(t *testing.T) {
+	q := delivery.NewQueues(0)
+	q.MaxReceives = 2
+	relay := &model.Relay{ID: uuid.New(), Tenant: "t", EventType: "job", Payload: json.RawMessage(`{}`)}
+	dest := model.Delivery{Destination: model.Destination{Type: model.DestinationQueue, URL: "queue:jobs"}}
+	if err := q.Send(context.Background(), relay, dest); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		msgs := q.Receive(ctx, "t", "jobs", 1, time.Minute, 0)
+		if len(msgs) != 1 {
+			t.Fatalf("receive %d: expected the message, got %v", i+1, msgs)
+		}
+		if err := q.Nack("t", "jobs", msgs[0].ReceiptHandle, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if msgs := q.Receive(ctx, "t", "jobs", 1, time.Minute, 0); len(msgs) != 0 {
+		t.Fatalf("expected the message to be dead-lettered, got %v", msgs)
+	}
+	if msgs := q.ReceiveDeadLetters(ctx, "other", "jobs", 1, time.Minute, 0); len(msgs) != 0 {
+		t.Fatalf("expected dead letters to stay with their tenant, got %v", msgs)
+	}
+	dead := q.ReceiveDeadLetters(ctx, "t", "jobs", 1, time.Minute, 0)
+	if len(dead) != 1 || dead[0].RelayID != relay.ID || dead[0].ReceiveCount != 3 {
+		t.Fatalf("expected the dead letter, got %v", dead)
+	}
+	if err := q.Ack("t", "jobs", dead[0].ReceiptHandle); err != nil {
+		t.Fatalf("expected dead letters to be acked by receipt, got %v", err)
+	}
+	if msgs := q.ReceiveDeadLetters(ctx, "t", "jobs", 1, time.Minute, 0); len(msgs) != 0 {
+		t.Fatalf("expected the dead-letter queue to be empty, got %v", msgs)
+	}
+}
+
+func TestQueueLongPollsSkipAdmission(t *testing.T) {
+	d := newTestDeps(t)
+	d.Admission = admission.NewController(admission.Config{MaxInFlight: 1})
+	s := httptest.NewServer(api.NewApp(d).Router)
+	defer s.Close()
+
+	done := make(chan int, 1)
+	go func() {
+		code, _ := relayDo(t, "POST", s.URL+"/v1/queues/jobs:receive", []byte(`{"waitSeconds":1}`), "")
+		done <- code
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if code, m := relayDo(t, "GET", s.URL+"/v1/relays", nil, ""); code != http.StatusOK {
+		t.Fatalf("expected the long poll not to hold the only admission slot, got %d %v", code, m)
+	}
+	if code := <-done; code != http.StatusOK {
+		t.Fatalf("expected the long poll to succeed, got %d", code)
+	}
+}
@@ -0,0 +1,119 @@
+package pkg_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/segolab/relay-ref/server/go/pkg/api"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+)
+
+func TestRedeliverRelay(t *testing.T) {
+	s := newHighBurstTestServer(t)
+	defer s.Close()
+
+	raw := []byte(`{"eventType":"x","destination":{"type":"webhook","url":"https://e"},"payload":{"a":1}}`)
+	_, created := relayDo(t, "POST", s.URL+"/v1/relays", raw, "")
+	id := created["id"].(string)
+
+	code, body := relayDo(t, "POST", s.URL+"/v1/relays/"+id+":redeliver", nil, "")
+	if code != http.StatusConflict {
+		t.Fatalf("expected 409 while queued, got %d %v", code, body)
+	}
+
+	relayDo(t, "POST", s.URL+"/v1/relays/"+id+":cancel", nil, "")
+	code, redelivered := relayDo(t, "POST", s.URL+"/v1/relays/"+id+":redeliver", nil, "")
+	if code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d %v", code, redelivered)
+	}
+	if redelivered["redeliveryOf"] != id || redelivered["id"] == id || redelivered["status"] != "queued" {
+		t.Fatalf("expected new queued relay linked to %s, got %v", id, redelivered)
+	}
+}
+
+func TestReplayRelays(t *testing.T) {
+	s := newBurstTestServer(t, 12)
+	defer s.Close()
+
+	raw := []byte(`{"eventType":"x","destination":{"type":"webhook","url":"https://e"},"payload":{"a":1}}`)
+	for i := 0; i < 3; i++ {
+		_, created := relayDo(t, "POST", s.URL+"/v1/relays", raw, "")
+		relayDo(t, "POST", s.URL+"/v1/relays/"+created["id"].(string)+":cancel", nil, "")
+	}
+	relayDo(t, "POST", s.URL+"/v1/relays", []byte(`{"eventType":"y","destination":{"type":"webhook","url":"https://e"},"payload":{}}`), "")
+	// 7 of 12 tokens used.
+
+	filter := []byte(`{"filter":{"status":"cancelled","eventType":"x"},"dryRun":true}`)
+	code, preview := relayDo(t, "POST", s.URL+"/v1/relays:replay", filter, "")
+	if code != http.StatusOK || preview["matched"] != float64(3) || len(preview["created"].([]any)) != 0 {
+		t.Fatalf("expected dry run to match 3, got %d %v", code, preview)
+	}
+
+	filter = []byte(`{"filter":{"status":"cancelled","eventType":"x"}}`)
+	code, replayed := relayDo(t, "POST", s.URL+"/v1/relays:replay", filter, "")
+	if code != http.StatusOK || len(replayed["created"].([]any)) != 3 {
+		t.Fatalf("expected 3 redeliveries, got %d %v", code, replayed)
+	}
+
+	// One token left; replaying three more relays costs three.
+	code, _ = relayDo(t, "POST", s.URL+"/v1/relays:replay", filter, "")
+	if code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", code)
+	}
+
+	code, body := relayDo(t, "POST", s.URL+"/v1/relays:replay", []byte(`{"filter":{"status":"queued"}}`), "")
+	if code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for queued filter, got %d %v", code, body)
+	}
+}
+
+func TestReplayLargerThanBurstIsRejected(t *testing.T) {
+	s, d := newBurstTestApp(t, 2, nil)
+
+	dest := model.Destination{Type: model.DestinationWebhook, URL: "https://e"}
+	for i := 0; i < 3; i++ {
+		d.RelayStore.Create(&model.Relay{
+			ID: uuid.New(), Tenant: "default", EventType: "x", Payload: json.RawMessage(`{}`),
+			Destination: &dest, Status: model.RelayStatusFailed, CreatedAt: time.Now().UTC(),
+			Deliveries: []model.Delivery{{Destination: dest, Status: model.DeliveryStatusFailed}},
+		})
+	}
+
+	// Three relays cost more than the bucket can ever hold.
+	code, m := relayDo(t, "POST", s.URL+"/v1/relays:replay", []byte(`{"filter":{}}`), "")
+	if code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d %v", code, m)
+	}
+	// A dry run costs one token whatever it matches.
+	code, m = relayDo(t, "POST", s.URL+"/v1/relays:replay", []byte(`{"filter":{},"dryRun":true}`), "")
+	if code != http.StatusOK || m["matched"] != float64(3) {
+		t.Fatalf("expected a dry run to match 3, got %d %v", code, m)
+	}
+}
+
+func TestReplayOfTooManyRelaysIsRefusedBeforeChecking(t *testing.T) {
+	s, d := newBurstTestApp(t, 5, func(d *api.Dependencies) { d.Config.ReplayMaxItems = 2 })
+
+	dest := model.Destination{Type: model.DestinationWebhook, URL: "https://e"}
+	for i := 0; i < 3; i++ {
+		d.RelayStore.Create(&model.Relay{
+			ID: uuid.New(), Tenant: "default", EventType: "x", Payload: json.RawMessage(`{}`),
+			Destination: &dest, Status: model.RelayStatusFailed, CreatedAt: time.Now().UTC(),
+			Deliveries: []model.Delivery{{Destination: dest, Status: model.DeliveryStatusFailed}},
+		})
+	}
+
+	code, m := relayDo(t, "POST", s.URL+"/v1/relays:replay", []byte(`{"filter":{}}`), "")
+	if code != http.StatusBadRequest || m["code"] != "invalid_request" {
+		t.Fatalf("expected 400 invalid_request, got %d %v", code, m)
+	}
+	// A dry run still counts every match.
+	code, m = relayDo(t, "POST", s.URL+"/v1/relays:replay", []byte(`{"filter":{},"dryRun":true}`), "")
+	if code != http.StatusOK || m["matched"] != float64(3) {
+		t.Fatalf("expected a dry run to match 3, got %d %v", code, m)
+	}
+}
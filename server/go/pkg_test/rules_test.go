@@ -0,0 +1,225 @@
+package pkg_test
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/segolab/relay-ref/server/go/pkg/api"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+	"github.com/segolab/relay-ref/server/go/pkg/rules"
+	"github.com/segolab/relay-ref/server/go/pkg/store"
+)
+
+func TestRoutingRules(t *testing.T) {
+	s := newBurstTestServer(t, 20)
+	defer s.Close()
+
+	code, m := relayDo(t, "POST", s.URL+"/v1/rules",
+		[]byte(`{"name":"eu","condition":"payload.region == \"eu\" && payload.amount >= 100","action":"route","destination":{"type":"webhook","url":"https://eu"}}`), "")
+	if code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d %v", code, m)
+	}
+	routeID := m["id"].(string)
+	code, m = relayDo(t, "POST", s.URL+"/v1/rules",
+		[]byte(`{"name":"no tests","condition":"metadata.source == 'test'","action":"drop"}`), "")
+	if code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d %v", code, m)
+	}
+
+	code, m = relayDo(t, "POST", s.URL+"/v1/relays",
+		[]byte(`{"eventType":"order.created","payload":{"region":"eu","amount":250}}`), "")
+	if code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d %v", code, m)
+	}
+	deliveries := m["deliveries"].([]any)
+	if len(deliveries) != 1 || deliveries[0].(map[string]any)["ruleId"] != routeID {
+		t.Fatalf("expected one delivery routed by rule, got %v", deliveries)
+	}
+
+	code, m = relayDo(t, "POST", s.URL+"/v1/relays",
+		[]byte(`{"eventType":"order.created","payload":{"region":"eu","amount":250},"metadata":{"source":"test"}}`), "")
+	if code != http.StatusCreated || m["status"] != "dropped" {
+		t.Fatalf("expected 201 dropped, got %d %v", code, m)
+	}
+	// A dropped relay never resolved a destination, so it reports none
+	// rather than an empty one.
+	if _, ok := m["destination"]; ok {
+		t.Fatalf("expected no destination on a dropped relay, got %v", m["destination"])
+	}
+
+	code, m = relayDo(t, "POST", s.URL+"/v1/relays",
+		[]byte(`{"eventType":"order.created","payload":{"region":"us","amount":250}}`), "")
+	if code != http.StatusUnprocessableEntity || m["code"] != "no_subscribers" {
+		t.Fatalf("expected 422 no_subscribers, got %d %v", code, m)
+	}
+
+	if code, _ := relayDo(t, "DELETE", s.URL+"/v1/rules/"+routeID, nil, ""); code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", code)
+	}
+	_, list := relayDo(t, "GET", s.URL+"/v1/rules", nil, "")
+	if items := list["items"].([]any); len(items) != 1 {
+		t.Fatalf("expected 1 rule left, got %d", len(items))
+	}
+}
+
+func TestRuleTestEndpoint(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	code, m := relayDo(t, "POST", s.URL+"/v1/rules:test",
+		[]byte(`{"condition":"payload.items[1].sku == \"B\" || eventType == \"x\"","eventType":"order.created","payload":{"items":[{"sku":"A"},{"sku":"B"}]}}`), "")
+	if code != http.StatusOK || m["matched"] != true {
+		t.Fatalf("expected match, got %d %v", code, m)
+	}
+
+	code, m = relayDo(t, "POST", s.URL+"/v1/rules:test",
+		[]byte(`{"condition":"payload.missing == 1","payload":{}}`), "")
+	if code != http.StatusOK || m["matched"] != false {
+		t.Fatalf("expected no match, got %d %v", code, m)
+	}
+
+	code, m = relayDo(t, "POST", s.URL+"/v1/rules:test",
+		[]byte(`{"condition":"payload.region ==","payload":{}}`), "")
+	if code != http.StatusBadRequest || m["code"] != "invalid_condition" {
+		t.Fatalf("expected 400 invalid_condition, got %d %v", code, m)
+	}
+}
+
+func TestDroppedRelaysCanBeReplayed(t *testing.T) {
+	s := newBurstTestServer(t, 20)
+	defer s.Close()
+
+	relayDo(t, "POST", s.URL+"/v1/rules",
+		[]byte(`{"name":"eu","condition":"payload.region == 'eu'","action":"route","destination":{"type":"webhook","url":"https://eu"}}`), "")
+	_, drop := relayDo(t, "POST", s.URL+"/v1/rules", []byte(`{"name":"all","condition":"true","action":"drop"}`), "")
+	_, dropped := relayDo(t, "POST", s.URL+"/v1/relays", []byte(`{"eventType":"x","payload":{"region":"eu"}}`), "")
+	if dropped["status"] != "dropped" {
+		t.Fatalf("expected the relay to be dropped, got %v", dropped)
+	}
+
+	code, m := relayDo(t, "POST", s.URL+"/v1/relays:replay", []byte(`{"filter":{"status":"dropped"},"dryRun":true}`), "")
+	if code != http.StatusOK || m["matched"] != float64(1) {
+		t.Fatalf("expected the dropped relay to match a replay, got %d %v", code, m)
+	}
+
+	// Once the drop rule is gone, the relay is routed as if created now.
+	relayDo(t, "DELETE", s.URL+"/v1/rules/"+drop["id"].(string), nil, "")
+	code, m = relayDo(t, "POST", s.URL+"/v1/relays/"+dropped["id"].(string)+":redeliver", nil, "")
+	deliveries, _ := m["deliveries"].([]any)
+	if code != http.StatusCreated || m["status"] != "queued" || len(deliveries) != 1 {
+		t.Fatalf("expected the redelivery to be routed by the remaining rule, got %d %v", code, m)
+	}
+}
+
+func TestRuleExpressions(t *testing.T) {
+	env, err := rules.NewEnv("order.created", map[string]string{"source": "web"},
+		[]byte(`{"q":"say \"hi\"","apos":"it's","path":"a\\b","n":3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		expr string
+		want bool
+	}{
+		// && binds tighter than ||, and ! tighter than both.
+		{`true || false && false`, true},
+		{`(true || false) && false`, false},
+		{`!false && false`, false},
+		{`!(false && false)`, true},
+		{`payload.n > 2 && payload.n <= 3 || eventType == "other"`, true},
+		{`metadata.source == "web" && !payload.missing`, true},
+		// Both quote styles escape their quote and backslash.
+		{`payload.q == "say \"hi\""`, true},
+		{`payload.apos == 'it\'s'`, true},
+		{`payload.path == "a\\b"`, true},
+	}
+	for _, c := range cases {
+		expr, err := rules.Compile(c.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", c.expr, err)
+		}
+		if got := expr.Eval(env); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestRuleExpressionLimits(t *testing.T) {
+	nest := func(open, close string, n int) string {
+		return strings.Repeat(open, n) + "true" + strings.Repeat(close, n)
+	}
+	literal := func(n int) string {
+		prefix := `payload.s == "`
+		return prefix + strings.Repeat("x", n-len(prefix)-1) + `"`
+	}
+	cases := []struct {
+		name string
+		expr string
+		ok   bool
+	}{
+		{"parentheses at MaxDepth", nest("(", ")", rules.MaxDepth), true},
+		{"parentheses past MaxDepth", nest("(", ")", rules.MaxDepth+1), false},
+		{"negations at MaxDepth", nest("!", "", rules.MaxDepth), true},
+		{"negations past MaxDepth", nest("!", "", rules.MaxDepth+1), false},
+		{"selector at MaxDepth", "payload" + strings.Repeat(".a", rules.MaxDepth), true},
+		{"selector past MaxDepth", "payload" + strings.Repeat(".a", rules.MaxDepth+1), false},
+		{"MaxLength", literal(rules.MaxLength), true},
+		{"past MaxLength", literal(rules.MaxLength + 1), false},
+		{"unterminated string", `payload.s == "abc`, false},
+		{"trailing escape", `payload.s == "abc\`, false},
+	}
+	for _, c := range cases {
+		_, err := rules.Compile(c.expr)
+		var syntax *rules.SyntaxError
+		switch {
+		case c.ok && err != nil:
+			t.Errorf("%s: expected to compile, got %v", c.name, err)
+		case !c.ok && !errors.As(err, &syntax):
+			t.Errorf("%s: expected a syntax error, got %v", c.name, err)
+		}
+	}
+}
+
+func TestRulesAreBoundedPerTenant(t *testing.T) {
+	rs := store.NewInMemoryRuleStore()
+	s, _ := newBurstTestApp(t, 20, func(d *api.Dependencies) { d.Rules = rs })
+
+	cond, err := rules.Compile(`eventType == "a"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	add := func(tenant string) error {
+		return rs.Create(&model.Rule{ID: uuid.New(), Tenant: tenant, Name: "drop a", Condition: `eventType == "a"`,
+			Action: model.RuleActionDrop, CreatedAt: time.Now().UTC()}, cond, 100)
+	}
+	for i := 0; i < 100; i++ {
+		if err := add("other"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := add("other"); !errors.Is(err, store.ErrRuleLimit) {
+		t.Fatalf("expected ErrRuleLimit, got %v", err)
+	}
+
+	// Another tenant's rules do not apply.
+	code, m := relayDo(t, "POST", s.URL+"/v1/relays",
+		[]byte(`{"eventType":"a","destination":{"type":"webhook","url":"https://e"},"payload":{}}`), "")
+	if code != http.StatusCreated || m["status"] != "queued" {
+		t.Fatalf("expected a queued relay, got %d %v", code, m)
+	}
+
+	for i := 0; i < 100; i++ {
+		if err := add("default"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	code, m = relayDo(t, "POST", s.URL+"/v1/rules", []byte(`{"name":"x","condition":"true","action":"drop"}`), "")
+	if code != http.StatusConflict {
+		t.Fatalf("expected 409 at the rule limit, got %d %v", code, m)
+	}
+}
@@ -0,0 +1,122 @@
+package pkg_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/segolab/relay-ref/server/go/pkg/api"
+	"github.com/segolab/relay-ref/server/go/pkg/delivery"
+)
+
+func TestScheduledRelays(t *testing.T) {
+	s, d := newBurstTestApp(t, 10, nil)
+	sched := &delivery.Scheduler{Log: d.Logger, Store: d.RelayStore}
+
+	raw := []byte(`{"eventType":"x","destination":{"type":"webhook","url":"https://e"},"payload":{},"delaySeconds":60}`)
+	code, keep := relayDo(t, "POST", s.URL+"/v1/relays", raw, "")
+	if code != http.StatusCreated || keep["status"] != "scheduled" || keep["deliverAt"] == nil {
+		t.Fatalf("expected scheduled relay, got %d %v", code, keep)
+	}
+	_, drop := relayDo(t, "POST", s.URL+"/v1/relays", raw, "")
+	if code, body := relayDo(t, "POST", s.URL+"/v1/relays/"+drop["id"].(string)+":cancel", nil, ""); code != http.StatusOK {
+		t.Fatalf("expected scheduled relay to be cancellable, got %d %v", code, body)
+	}
+
+	if n := sched.Tick(time.Now().UTC()); n != 0 {
+		t.Fatalf("expected nothing due yet, promoted %d", n)
+	}
+	if n := sched.Tick(time.Now().UTC().Add(2 * time.Minute)); n != 1 {
+		t.Fatalf("expected only the uncancelled relay to be promoted, got %d", n)
+	}
+	_, got := relayDo(t, "GET", s.URL+"/v1/relays/"+keep["id"].(string), nil, "")
+	if got["status"] != "queued" {
+		t.Fatalf("expected queued after promotion, got %v", got["status"])
+	}
+
+	past := time.Now().UTC().Add(-time.Minute).Format(time.RFC3339)
+	_, now := relayDo(t, "POST", s.URL+"/v1/relays", []byte(`{"eventType":"x","destination":{"type":"webhook","url":"https://e"},"payload":{},"deliverAt":"`+past+`"}`), "")
+	if now["status"] != "queued" {
+		t.Fatalf("expected past deliverAt to queue immediately, got %v", now["status"])
+	}
+
+	code, _ = relayDo(t, "POST", s.URL+"/v1/relays", []byte(`{"eventType":"x","destination":{"type":"webhook","url":"https://e"},"payload":{},"deliverAt":"`+past+`","delaySeconds":5}`), "")
+	if code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for deliverAt with delaySeconds, got %d", code)
+	}
+}
+
+func TestRelayExpiry(t *testing.T) {
+	s, d := newBurstTestApp(t, 10, nil)
+	sched := &delivery.Scheduler{Log: d.Logger, Store: d.RelayStore}
+
+	create := func(extra string) map[string]any {
+		t.Helper()
+		code, m := relayDo(t, "POST", s.URL+"/v1/relays",
+			[]byte(`{"eventType":"x","destination":{"type":"webhook","url":"https://e"},"payload":{}`+extra+`}`), "")
+		if code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d %v", code, m)
+		}
+		return m
+	}
+	stale := create(`,"ttlSeconds":30`)
+	if stale["expiresAt"] == nil {
+		t.Fatalf("expected expiresAt on relay, got %v", stale)
+	}
+	later := create(`,"delaySeconds":10,"ttlSeconds":60`)
+	cancelled := create(`,"ttlSeconds":30`)
+	relayDo(t, "POST", s.URL+"/v1/relays/"+cancelled["id"].(string)+":cancel", nil, "")
+
+	sched.Tick(time.Now().UTC().Add(45 * time.Second))
+
+	want := map[string]string{
+		stale["id"].(string):     "expired",
+		later["id"].(string):     "queued",
+		cancelled["id"].(string): "cancelled",
+	}
+	for id, status := range want {
+		_, got := relayDo(t, "GET", s.URL+"/v1/relays/"+id, nil, "")
+		if got["status"] != status {
+			t.Fatalf("relay %s: expected %s, got %v", id, status, got["status"])
+		}
+		if status == "expired" && got["failureReason"] == nil {
+			t.Fatalf("expected failureReason on expired relay")
+		}
+	}
+
+	code, _ := relayDo(t, "POST", s.URL+"/v1/relays",
+		[]byte(`{"eventType":"x","destination":{"type":"webhook","url":"https://e"},"payload":{},"delaySeconds":60,"ttlSeconds":30}`), "")
+	if code != http.StatusBadRequest {
+		t.Fatalf("expected 400 when expiry precedes delivery, got %d", code)
+	}
+	farOff := time.Now().UTC().Add(31 * 24 * time.Hour).Format(time.RFC3339)
+	code, _ = relayDo(t, "POST", s.URL+"/v1/relays",
+		[]byte(`{"eventType":"x","destination":{"type":"webhook","url":"https://e"},"payload":{},"expiresAt":"`+farOff+`"}`), "")
+	if code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for expiresAt more than 30 days ahead, got %d", code)
+	}
+}
+
+func TestSchedulerIntervalsMustBePositive(t *testing.T) {
+	for _, env := range []string{"RELAY_SCHEDULER_INTERVAL_MS", "RELAY_DELIVERY_INTERVAL_MS"} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, "0")
+			if _, err := api.LoadConfigFromEnv(); err == nil {
+				t.Fatalf("expected %s=0 to be rejected", env)
+			}
+		})
+	}
+}
+
+func TestDeliverySettingsMustBePositive(t *testing.T) {
+	for _, env := range []string{"RELAY_DELIVERY_CONCURRENCY", "RELAY_DELIVERY_TIMEOUT_SECONDS"} {
+		for _, v := range []string{"0", "-1"} {
+			t.Run(env+"="+v, func(t *testing.T) {
+				t.Setenv(env, v)
+				if _, err := api.LoadConfigFromEnv(); err == nil {
+					t.Fatalf("expected %s=%s to be rejected", env, v)
+				}
+			})
+		}
+	}
+}
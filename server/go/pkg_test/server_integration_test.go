@@ -5,32 +5,57 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
 	"log/slog"
 
 	"github.com/segolab/relay-ref/server/go/pkg/api"
+	"github.com/segolab/relay-ref/server/go/pkg/openapi"
 	"github.com/segolab/relay-ref/server/go/pkg/ratelimit"
 	"github.com/segolab/relay-ref/server/go/pkg/store"
 )
 
 func newTestServer(t *testing.T) *httptest.Server {
 	t.Helper()
+	return httptest.NewServer(api.NewApp(newTestDeps(t)).Router)
+}
+
+var contract = sync.OnceValues(func() (*openapi.Spec, error) {
+	return openapi.Load("../../../api/openapi.yaml")
+})
+
+// newTestDeps returns the dependencies used by newTestServer so tests can
+// adjust configuration before building the app. Requests and responses are
+// checked against api/openapi.yaml.
+func newTestDeps(t *testing.T) api.Dependencies {
+	t.Helper()
+	spec, err := contract()
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	cfg := api.Config{
-		HTTPAddr:       ":0",
-		APIKeys:        map[string]struct{}{"k": {}},
-		MaxBodyBytes:   32768,
-		IdempotencyTTL: 1 * time.Hour,
-		LimitPostRPS:   1,
-		LimitPostBurst: 2, // burst > 1 is required to test idempotency: retries must still respect rate limits but not be blocked immediately
-		LimitGetRPS:    50,
-		LimitGetBurst:  100,
-		LogLevel:       slog.LevelInfo,
-	}
-
-	app := api.NewApp(api.Dependencies{
+		HTTPAddr:               ":0",
+		APIKeys:                map[string]struct{}{"k": {}, "admin": {}},
+		AdminKeys:              map[string]struct{}{"admin": {}},
+		MaxBodyBytes:           32768,
+		BatchMaxItems:          10,
+		BatchMaxBodyBytes:      65536,
+		ReplayMaxItems:         100,
+		QueueVisibilityTimeout: 30 * time.Second,
+		QueueMaxWait:           2 * time.Second,
+		IdempotencyTTL:         1 * time.Hour,
+		LimitPostRPS:           1,
+		LimitPostBurst:         2, // burst > 1 is required to test idempotency: retries must still respect rate limits but not be blocked immediately
+		LimitGetRPS:            50,
+		LimitGetBurst:          100,
+		ValidateResponses:      true,
+		LogLevel:               slog.LevelInfo,
+	}
+
+	return api.Dependencies{
 		Logger:      slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)),
 		Config:      cfg,
 		RelayStore:  store.NewInMemoryRelayStore(),
@@ -41,8 +66,44 @@ func newTestServer(t *testing.T) *httptest.Server {
 			GetRPS:    50,
 			GetBurst:  100,
 		}),
+		Contract: spec,
+	}
+}
+
+// newHighBurstTestServer allows a few writes in a row, for tests that
+// make several POST calls.
+func newHighBurstTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return newBurstTestServer(t, 5)
+}
+
+// newBurstTestServer allows postBurst writes in a row. Tokens effectively
+// do not refill during a test.
+func newBurstTestServer(t *testing.T, postBurst int) *httptest.Server {
+	t.Helper()
+	s, _ := newBurstTestApp(t, postBurst, nil)
+	return s
+}
+
+// newBurstTestApp is newBurstTestServer for tests that also drive the
+// server's stores, e.g. with a Scheduler or Dispatcher logging to d.Logger.
+// setup, if not nil, adjusts the dependencies before the server starts.
+// The server is closed when the test ends.
+func newBurstTestApp(t *testing.T, postBurst int, setup func(d *api.Dependencies)) (*httptest.Server, api.Dependencies) {
+	t.Helper()
+	d := newTestDeps(t)
+	d.Limiter = ratelimit.NewTokenBucketLimiter(ratelimit.Config{
+		PostRPS:   0.001,
+		PostBurst: postBurst,
+		GetRPS:    50,
+		GetBurst:  100,
 	})
-	return httptest.NewServer(app.Router)
+	if setup != nil {
+		setup(&d)
+	}
+	s := httptest.NewServer(api.NewApp(d).Router)
+	t.Cleanup(s.Close)
+	return s, d
 }
 
 func TestUnauthorized(t *testing.T) {
@@ -0,0 +1,186 @@
+package pkg_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/segolab/relay-ref/server/go/pkg/api"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+	"github.com/segolab/relay-ref/server/go/pkg/store"
+)
+
+func TestSubscriptionRouting(t *testing.T) {
+	s := newBurstTestServer(t, 20)
+	defer s.Close()
+
+	subscribe := func(body string) string {
+		t.Helper()
+		code, m := relayDo(t, "POST", s.URL+"/v1/subscriptions", []byte(body), "")
+		if code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d %v", code, m)
+		}
+		return m["id"].(string)
+	}
+	exact := subscribe(`{"eventType":"order.created","destination":{"type":"webhook","url":"https://a"}}`)
+	subscribe(`{"eventType":"order.","match":"prefix","metadata":{"region":"eu"},"destination":{"type":"webhook","url":"https://b"}}`)
+	subscribe(`{"eventType":"*.deleted","match":"glob","destination":{"type":"webhook","url":"https://c"}}`)
+
+	route := func(eventType, metadata string) []string {
+		t.Helper()
+		code, m := relayDo(t, "POST", s.URL+"/v1/relays",
+			[]byte(`{"eventType":"`+eventType+`","payload":{},"metadata":`+metadata+`}`), "")
+		if code != http.StatusCreated {
+			t.Fatalf("%s: expected 201, got %d %v", eventType, code, m)
+		}
+		var urls []string
+		for _, d := range m["deliveries"].([]any) {
+			d := d.(map[string]any)
+			if d["subscriptionId"] == nil {
+				t.Fatalf("expected subscriptionId on routed delivery, got %v", d)
+			}
+			urls = append(urls, d["destination"].(map[string]any)["url"].(string))
+		}
+		return urls
+	}
+	if got := route("order.created", `{"region":"eu"}`); len(got) != 2 || got[0] != "https://a" || got[1] != "https://b" {
+		t.Fatalf("expected exact and prefix subscriptions, got %v", got)
+	}
+	if got := route("order.created", `{"region":"us"}`); len(got) != 1 || got[0] != "https://a" {
+		t.Fatalf("expected metadata filter to exclude prefix subscription, got %v", got)
+	}
+	if got := route("user.deleted", `{}`); len(got) != 1 || got[0] != "https://c" {
+		t.Fatalf("expected glob subscription, got %v", got)
+	}
+
+	code, body := relayDo(t, "POST", s.URL+"/v1/relays", []byte(`{"eventType":"nobody.cares","payload":{}}`), "")
+	if code != http.StatusUnprocessableEntity || body["code"] != "no_subscribers" {
+		t.Fatalf("expected 422 no_subscribers, got %d %v", code, body)
+	}
+
+	if code, _ := relayDo(t, "DELETE", s.URL+"/v1/subscriptions/"+exact, nil, ""); code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", code)
+	}
+	_, list := relayDo(t, "GET", s.URL+"/v1/subscriptions", nil, "")
+	if items := list["items"].([]any); len(items) != 2 {
+		t.Fatalf("expected 2 subscriptions left, got %d", len(items))
+	}
+
+	code, _ = relayDo(t, "POST", s.URL+"/v1/subscriptions", []byte(`{"eventType":"x","match":"regex","destination":{"type":"webhook","url":"https://a"}}`), "")
+	if code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown match type, got %d", code)
+	}
+}
+
+func TestSubscriptionsArePaginated(t *testing.T) {
+	s := newBurstTestServer(t, 5)
+	defer s.Close()
+
+	for i := 0; i < 5; i++ {
+		body := `{"eventType":"e` + strconv.Itoa(i) + `","destination":{"type":"webhook","url":"https://a"}}`
+		if code, m := relayDo(t, "POST", s.URL+"/v1/subscriptions", []byte(body), ""); code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d %v", code, m)
+		}
+	}
+	var seen []string
+	url := s.URL + "/v1/subscriptions?pageSize=2"
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("expected 3 pages")
+		}
+		code, page := relayDo(t, "GET", url, nil, "")
+		if code != http.StatusOK {
+			t.Fatalf("expected 200, got %d %v", code, page)
+		}
+		for _, item := range page["items"].([]any) {
+			seen = append(seen, item.(map[string]any)["eventType"].(string))
+		}
+		next, _ := page["nextPageToken"].(string)
+		if next == "" {
+			break
+		}
+		url = s.URL + "/v1/subscriptions?pageSize=2&pageToken=" + next
+	}
+	if len(seen) != 5 || seen[0] != "e0" || seen[4] != "e4" {
+		t.Fatalf("expected all subscriptions in creation order, got %v", seen)
+	}
+}
+
+func TestSubscriptionPatternsRespectKeyPrefixes(t *testing.T) {
+	s := newBurstTestServer(t, 10)
+	defer s.Close()
+
+	resp := adminDo(t, "POST", s.URL+"/v1/admin/keys", "admin", model.CreateAPIKeyRequest{
+		Name:              "orders",
+		Tenant:            "default",
+		Scopes:            []string{"subscriptions:write"},
+		EventTypePrefixes: []string{"order."},
+	})
+	var key model.APIKeySecretResponse
+	_ = json.NewDecoder(resp.Body).Decode(&key)
+
+	dest := map[string]any{"type": "webhook", "url": "https://a"}
+	for _, c := range []struct {
+		eventType, match string
+		want             int
+	}{
+		{"order.created", "exact", http.StatusCreated},
+		{"order.", "prefix", http.StatusCreated},
+		{"order.*", "glob", http.StatusCreated},
+		{"user.created", "exact", http.StatusForbidden},
+		{"order", "prefix", http.StatusForbidden},
+		{"*", "glob", http.StatusForbidden},
+		{"*.created", "glob", http.StatusForbidden},
+		{"orde[r].*", "glob", http.StatusForbidden},
+	} {
+		body := map[string]any{"eventType": c.eventType, "match": c.match, "destination": dest}
+		if code := adminDo(t, "POST", s.URL+"/v1/subscriptions", key.Secret, body).StatusCode; code != c.want {
+			t.Fatalf("%s (%s): expected %d, got %d", c.eventType, c.match, c.want, code)
+		}
+	}
+}
+
+func TestSubscriptionsAreBounded(t *testing.T) {
+	subs := store.NewInMemorySubscriptionStore()
+	s, _ := newBurstTestApp(t, 20, func(d *api.Dependencies) { d.Subscriptions = subs })
+
+	// Another tenant's subscriptions neither count nor match.
+	for i := 0; i < 100; i++ {
+		sub := &model.Subscription{ID: uuid.New(), Tenant: "other", EventType: "a", Match: model.MatchExact,
+			Destination: model.Destination{Type: model.DestinationWebhook, URL: "https://other"}, CreatedAt: time.Now().UTC()}
+		if err := subs.Create(sub, 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	subscribe := func() (int, map[string]any) {
+		return relayDo(t, "POST", s.URL+"/v1/subscriptions",
+			[]byte(`{"eventType":"a","destination":{"type":"webhook","url":"https://e"}}`), "")
+	}
+	for i := 0; i < 11; i++ {
+		if code, m := subscribe(); code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d %v", code, m)
+		}
+	}
+
+	// Eleven matching subscriptions are more destinations than a relay may
+	// have.
+	code, m := relayDo(t, "POST", s.URL+"/v1/relays", []byte(`{"eventType":"a","payload":{}}`), "")
+	if code != http.StatusUnprocessableEntity || m["code"] != "too_many_destinations" {
+		t.Fatalf("expected 422 too_many_destinations, got %d %v", code, m)
+	}
+
+	for i := 0; i < 89; i++ {
+		sub := &model.Subscription{ID: uuid.New(), Tenant: "default", EventType: "b", Match: model.MatchExact,
+			Destination: model.Destination{Type: model.DestinationWebhook, URL: "https://e"}, CreatedAt: time.Now().UTC()}
+		if err := subs.Create(sub, 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if code, m := subscribe(); code != http.StatusConflict {
+		t.Fatalf("expected 409 at the subscription limit, got %d %v", code, m)
+	}
+}
@@ -0,0 +1,133 @@
+package pkg_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/segolab/relay-ref/server/go/pkg/delivery"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+	"github.com/segolab/relay-ref/server/go/pkg/transform"
+)
+
+func TestTransformPreview(t *testing.T) {
+	s := newBurstTestServer(t, 10)
+	defer s.Close()
+
+	code, m := relayDo(t, "POST", s.URL+"/v1/transforms:preview", []byte(`{
+		"transform":{"body":"{\"text\": {{json (printf \"%s from %s\" .eventType .metadata.source)}}}","headers":{"x-partner-event":"{{.payload.kind}}"}},
+		"eventType":"order.created","metadata":{"source":"shop"},"payload":{"kind":"retail"}}`), "")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %v", code, m)
+	}
+	if m["body"] != `{"text": "order.created from shop"}` {
+		t.Fatalf("unexpected body %q", m["body"])
+	}
+	if h := m["headers"].(map[string]any); h["X-Partner-Event"] != "retail" {
+		t.Fatalf("unexpected headers %v", h)
+	}
+
+	code, m = relayDo(t, "POST", s.URL+"/v1/transforms:preview", []byte(`{"transform":{"body":"{{.payload"}}`), "")
+	if code != http.StatusBadRequest || m["code"] != "invalid_transform" {
+		t.Fatalf("expected 400 invalid_transform, got %d %v", code, m)
+	}
+
+	// Templates are validated when a destination is configured.
+	for _, transform := range []string{
+		`{"body":"{{end}}"}`,
+		`{"body":"{{define \"a\"}}{{template \"a\"}}{{end}}"}`,
+		`{"headers":{"X-Relay-Id":"x"}}`,
+	} {
+		code, _ = relayDo(t, "POST", s.URL+"/v1/relays",
+			[]byte(`{"eventType":"x","destination":{"type":"webhook","url":"https://a","transform":`+transform+`},"payload":{}}`), "")
+		if code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", transform, code)
+		}
+	}
+}
+
+func TestWebhookSenderAppliesTransform(t *testing.T) {
+	var gotBody []byte
+	var gotHeader http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		gotHeader = r.Header
+	}))
+	defer srv.Close()
+
+	relay := &model.Relay{ID: uuid.New(), EventType: "user.signup", Payload: json.RawMessage(`{"name":"Ada"}`)}
+	d := model.Delivery{Destination: model.Destination{Type: "webhook", URL: srv.URL, Transform: &model.Transform{
+		Body:    `{"text":{{json .payload.name}},"id":"{{.id}}"}`,
+		Headers: map[string]string{"Content-Type": "application/vnd.partner+json"},
+	}}}
+	if err := (delivery.WebhookSender{}).Send(context.Background(), relay, d); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if string(gotBody) != `{"text":"Ada","id":"`+relay.ID.String()+`"}` {
+		t.Fatalf("unexpected body %s", gotBody)
+	}
+	if gotHeader.Get("Content-Type") != "application/vnd.partner+json" || gotHeader.Get("X-Relay-Id") != relay.ID.String() {
+		t.Fatalf("unexpected headers %v", gotHeader)
+	}
+}
+
+func TestTransformRenderingIsBounded(t *testing.T) {
+	s := newBurstTestServer(t, 10)
+	defer s.Close()
+
+	preview := func(body, payload string) (int, map[string]any) {
+		t.Helper()
+		req, _ := json.Marshal(map[string]any{
+			"transform": map[string]any{"body": body},
+			"eventType": "x",
+			"payload":   json.RawMessage(payload),
+		})
+		return relayDo(t, "POST", s.URL+"/v1/transforms:preview", req, "")
+	}
+
+	if code, m := preview(`{{.payload.missing}}`, `{}`); code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected a missing key to fail rendering, got %d %v", code, m)
+	}
+	if code, m := preview(`{{index .payload "name" | default "anonymous"}}`, `{}`); code != http.StatusOK || m["body"] != "anonymous" {
+		t.Fatalf("expected the default, got %d %v", code, m)
+	}
+	if code, m := preview(`{{printf "%05d" 7}}`, `{}`); code != http.StatusOK || m["body"] != "00007" {
+		t.Fatalf("expected a padded number, got %d %v", code, m)
+	}
+	for _, body := range []string{`{{printf "%0100000000d" 1}}`, `{{printf "%.*f" 100000000 1.0}}`} {
+		if code, m := preview(body, `{}`); code != http.StatusUnprocessableEntity {
+			t.Fatalf("%s: expected 422, got %d %v", body, code, m)
+		}
+	}
+	// 100^3 iterations produce no output but exceed the step budget.
+	items := "[" + strings.Repeat("0,", 99) + "0]"
+	nested := `{{range .payload}}{{range $.payload}}{{range $.payload}}{{end}}{{end}}{{end}}`
+	if code, m := preview(nested, items); code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected nested loops to exceed the budget, got %d %v", code, m)
+	}
+	if code, m := preview(`{{template "body"}}`, `{}`); code != http.StatusBadRequest {
+		t.Fatalf("expected template recursion to be rejected, got %d %v", code, m)
+	}
+}
+
+func TestTransformHeaderNamesAreChecked(t *testing.T) {
+	for _, name := range []string{"", "X Bad", "X:Bad", "X-Bad\r\n", "X-Bad\x00", "X-Bad\x7f", "X-Bäd", "X(Bad)", `X"Bad"`} {
+		if _, err := transform.Compile(&model.Transform{Headers: map[string]string{name: "v"}}); err == nil {
+			t.Errorf("expected header name %q to be rejected", name)
+		}
+	}
+	if _, err := transform.Compile(&model.Transform{Headers: map[string]string{"X-Tenant_Id.v2": "v"}}); err != nil {
+		t.Fatalf("expected a valid token to be accepted: %v", err)
+	}
+	// Both spellings would be sent as the same header.
+	_, err := transform.Compile(&model.Transform{Headers: map[string]string{"x-tenant": "a", "X-TENANT": "b"}})
+	if err == nil {
+		t.Fatal("expected header names differing only in case to be rejected")
+	}
+}
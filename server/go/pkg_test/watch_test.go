@@ -0,0 +1,174 @@
+package pkg_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segolab/relay-ref/server/go/pkg/api"
+	"github.com/segolab/relay-ref/server/go/pkg/model"
+	"github.com/segolab/relay-ref/server/go/pkg/store"
+)
+
+type sseEvent struct {
+	id, event string
+	data      map[string]any
+}
+
+// watch opens an SSE stream and returns its events on a channel.
+func watch(t *testing.T, url, lastEventID string) (<-chan sseEvent, func()) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("X-API-Key", "k")
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer close(events)
+		sc := bufio.NewScanner(resp.Body)
+		var ev sseEvent
+		for sc.Scan() {
+			line := sc.Text()
+			switch {
+			case line == "":
+				if ev.event != "" {
+					events <- ev
+				}
+				ev = sseEvent{}
+			case strings.HasPrefix(line, "id: "):
+				ev.id = line[4:]
+			case strings.HasPrefix(line, "event: "):
+				ev.event = line[7:]
+			case strings.HasPrefix(line, "data: "):
+				_ = json.Unmarshal([]byte(line[6:]), &ev.data)
+			}
+		}
+	}()
+	return events, func() { resp.Body.Close() }
+}
+
+func nextEvent(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event")
+		return sseEvent{}
+	}
+}
+
+func TestWatchRelays(t *testing.T) {
+	s := newBurstTestServer(t, 10)
+	defer s.Close()
+
+	events, stop := watch(t, s.URL+"/v1/relays:watch?eventType=order.created", "")
+	defer stop()
+
+	relayDo(t, "POST", s.URL+"/v1/relays", []byte(`{"eventType":"other","destination":{"type":"webhook","url":"https://a"},"payload":{}}`), "")
+	_, created := relayDo(t, "POST", s.URL+"/v1/relays", []byte(`{"eventType":"order.created","destination":{"type":"webhook","url":"https://a"},"payload":{}}`), "")
+	id := created["id"].(string)
+	relayDo(t, "POST", s.URL+"/v1/relays/"+id+":cancel", nil, "")
+
+	first := nextEvent(t, events)
+	if first.event != "status" || first.data["relayId"] != id || first.data["status"] != "queued" {
+		t.Fatalf("expected the filtered relay to be queued, got %+v", first)
+	}
+	second := nextEvent(t, events)
+	if second.data["status"] != "cancelled" || second.data["previousStatus"] != "queued" {
+		t.Fatalf("expected queued -> cancelled, got %+v", second)
+	}
+	stop()
+
+	// Resuming after the first event replays only what followed it.
+	resumed, stopResumed := watch(t, s.URL+"/v1/relays:watch?status=cancelled", first.id)
+	defer stopResumed()
+	if ev := nextEvent(t, resumed); ev.id != second.id {
+		t.Fatalf("expected to resume at %s, got %+v", second.id, ev)
+	}
+
+	if code, _ := relayDo(t, "GET", s.URL+"/v1/relays:watch?status=bogus", nil, ""); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown status, got %d", code)
+	}
+}
+
+func TestWatchResumesFromAheadOfTheLog(t *testing.T) {
+	s := newBurstTestServer(t, 10)
+	defer s.Close()
+
+	// An ID from before a restart is ahead of the fresh log.
+	events, stop := watch(t, s.URL+"/v1/relays:watch", "999999")
+	defer stop()
+	if ev := nextEvent(t, events); ev.event != "truncated" {
+		t.Fatalf("expected a truncated event, got %+v", ev)
+	}
+	_, created := relayDo(t, "POST", s.URL+"/v1/relays", []byte(`{"eventType":"order.created","destination":{"type":"webhook","url":"https://a"},"payload":{}}`), "")
+	if ev := nextEvent(t, events); ev.data["relayId"] != created["id"] {
+		t.Fatalf("expected the stream to continue from the current position, got %+v", ev)
+	}
+
+	if code, _ := relayDo(t, "GET", s.URL+"/v1/relays:watch?lastEventId=abc", nil, ""); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a non-numeric Last-Event-ID, got %d", code)
+	}
+}
+
+func TestWatchStreamsAreCappedPerKey(t *testing.T) {
+	d := newTestDeps(t)
+	d.Config.WatchMaxStreams = 1
+	s := httptest.NewServer(api.NewApp(d).Router)
+	defer s.Close()
+
+	_, stop := watch(t, s.URL+"/v1/relays:watch", "")
+	defer stop()
+	code, m := relayDo(t, "GET", s.URL+"/v1/relays:watch", nil, "")
+	if code != http.StatusTooManyRequests || m["code"] != "too_many_streams" {
+		t.Fatalf("expected 429 too_many_streams, got %d %v", code, m)
+	}
+}
+
+func TestChangeLogKeepsTenantsApart(t *testing.T) {
+	log := store.NewChangeLog(2)
+	now := time.Now()
+	b := uuid.New()
+	log.Record(&model.Relay{ID: b, Tenant: "b", Status: model.RelayStatusQueued}, "", now)
+	a := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	for _, id := range a {
+		log.Record(&model.Relay{ID: id, Tenant: "a", Status: model.RelayStatusQueued}, "", now)
+	}
+
+	if changes, truncated, _ := log.Since("b", 0); truncated || len(changes) != 1 || changes[0].RelayID != b {
+		t.Fatalf("expected another tenant's churn to leave b intact, got %v truncated=%v", changes, truncated)
+	}
+	if changes, truncated, _ := log.Since("a", 0); !truncated || len(changes) != 2 || changes[0].RelayID != a[1] {
+		t.Fatalf("expected a's oldest change to be dropped, got %v truncated=%v", changes, truncated)
+	}
+	if _, truncated, _ := log.Since("a", 2); truncated {
+		t.Fatal("expected no truncation when resuming after the dropped change")
+	}
+
+	// Wrapping around the window several times keeps the latest changes in
+	// order.
+	for i := 0; i < 7; i++ {
+		log.Record(&model.Relay{ID: uuid.New(), Tenant: "a", Status: model.RelayStatusQueued}, "", now)
+	}
+	changes, truncated, _ := log.Since("a", 0)
+	if !truncated || len(changes) != 2 || changes[0].Seq != 10 || changes[1].Seq != 11 {
+		t.Fatalf("expected changes 10 and 11, got %v truncated=%v", changes, truncated)
+	}
+	if changes, truncated, _ := log.Since("a", 10); truncated || len(changes) != 1 || changes[0].Seq != 11 {
+		t.Fatalf("expected change 11 alone, got %v truncated=%v", changes, truncated)
+	}
+}